@@ -0,0 +1,231 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+)
+
+// Encrypted backups are ordinary zip archives wrapped in the age format
+// (https://age-encryption.org), either for a passphrase or for the X25519
+// public keys listed in backup_recipients. They are written next to plain
+// archives with an extra .age extension.
+const encryptedSuffix = ".age"
+
+// passphraseEnv is read before prompting, for scripts and cron jobs.
+const passphraseEnv = "KG_BACKUP_PASSPHRASE"
+
+// backupPassphrase remembers the passphrase once it has been entered, so a
+// restore that decrypts one backup and writes a safety backup asks once.
+var backupPassphrase string
+
+func newBackupKeygenCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "keygen",
+		Short: "Generate a key pair for encrypting backups",
+		Long: `Generate an X25519 identity for encrypted backups. The identity is written
+to --output (or printed) and its public key printed, ready to be added to
+backup_recipients. Keep the identity file safe: backups encrypted to its
+public key cannot be restored without it.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			output, _ := cmd.Flags().GetString("output")
+			return generateBackupKey(output)
+		},
+	}
+
+	cmd.Flags().StringP("output", "o", "", "File to write the identity to (default stdout)")
+
+	return cmd
+}
+
+func generateBackupKey(output string) error {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	if output == "" {
+		fmt.Println(identity.String())
+	} else {
+		f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to create identity file: %w", err)
+		}
+		defer f.Close()
+		if _, err := fmt.Fprintf(f, "# public key: %s\n%s\n", identity.Recipient(), identity); err != nil {
+			return fmt.Errorf("failed to write identity file: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Identity written to %s\n", output)
+	}
+
+	fmt.Fprintf(os.Stderr, "Public key: %s\n", identity.Recipient())
+	return nil
+}
+
+// backupRecipients returns who a new backup is encrypted for: the configured
+// public keys, or else a passphrase.
+func backupRecipients(opts backupOptions) ([]age.Recipient, error) {
+	if len(opts.Recipients) > 0 {
+		recipients, err := age.ParseRecipients(strings.NewReader(strings.Join(opts.Recipients, "\n")))
+		if err != nil {
+			return nil, fmt.Errorf("invalid backup recipient: %w", err)
+		}
+		return recipients, nil
+	}
+
+	passphrase, err := readPassphrase(true)
+	if err != nil {
+		return nil, err
+	}
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key from passphrase: %w", err)
+	}
+	return []age.Recipient{recipient}, nil
+}
+
+// backupIdentities returns the keys encrypted backups are opened with: the
+// identity file from backup_identity (or --identity), or else a passphrase.
+func backupIdentities() ([]age.Identity, error) {
+	if path := viper.GetString("backup_identity"); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open identity file: %w", err)
+		}
+		defer f.Close()
+		identities, err := age.ParseIdentities(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse identity file %s: %w", path, err)
+		}
+		return identities, nil
+	}
+
+	passphrase, err := readPassphrase(false)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key from passphrase: %w", err)
+	}
+	return []age.Identity{identity}, nil
+}
+
+// readPassphrase returns the backup passphrase from the environment or the
+// terminal. When confirm is set, a passphrase typed in is asked for twice.
+func readPassphrase(confirm bool) (string, error) {
+	if backupPassphrase != "" {
+		return backupPassphrase, nil
+	}
+	if p := os.Getenv(passphraseEnv); p != "" {
+		backupPassphrase = p
+		return p, nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("backup passphrase required: set %s, configure backup_recipients, or run kg from a terminal", passphraseEnv)
+	}
+
+	fmt.Fprint(os.Stderr, "Backup passphrase: ")
+	p, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	if len(p) == 0 {
+		return "", fmt.Errorf("backup passphrase must not be empty")
+	}
+
+	if confirm {
+		fmt.Fprint(os.Stderr, "Confirm passphrase: ")
+		again, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		if !bytes.Equal(p, again) {
+			return "", fmt.Errorf("passphrases do not match")
+		}
+	}
+
+	backupPassphrase = string(p)
+	return backupPassphrase, nil
+}
+
+// encryptWriter wraps w so everything written to it is encrypted for opts'
+// recipients. The returned writer must be closed to finish the archive.
+func encryptWriter(w io.Writer, opts backupOptions) (io.WriteCloser, error) {
+	recipients, err := backupRecipients(opts)
+	if err != nil {
+		return nil, err
+	}
+	ew, err := age.Encrypt(w, recipients...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt backup: %w", err)
+	}
+	return ew, nil
+}
+
+// openZipBackup opens a zip backup for reading, decrypting it first if it
+// is encrypted. The returned function releases the archive.
+func openZipBackup(b backupInfo) (*zip.Reader, func() error, error) {
+	if !b.Encrypted {
+		r, err := zip.OpenReader(b.Path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open backup: %w", err)
+		}
+		return &r.Reader, r.Close, nil
+	}
+
+	data, err := decryptBackup(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open backup: %w", err)
+	}
+	return r, func() error { return nil }, nil
+}
+
+func decryptBackup(b backupInfo) ([]byte, error) {
+	identities, err := backupIdentities()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(b.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer f.Close()
+
+	r, err := age.Decrypt(f, identities...)
+	if err != nil {
+		var noMatch *age.NoIdentityMatchError
+		if errors.As(err, &noMatch) {
+			if viper.GetString("backup_identity") != "" {
+				return nil, fmt.Errorf("cannot decrypt backup %s: it was not encrypted for the identity in %s", b.ID, viper.GetString("backup_identity"))
+			}
+			return nil, fmt.Errorf("cannot decrypt backup %s: wrong passphrase, or it was encrypted for a public key (set backup_identity or pass --identity)", b.ID)
+		}
+		return nil, fmt.Errorf("cannot decrypt backup %s: %w", b.ID, err)
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("backup %s is corrupt: %w", b.ID, err)
+	}
+	return data, nil
+}
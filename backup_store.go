@@ -0,0 +1,440 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// The content-addressed backup store keeps every distinct file once, as a
+// gzip-compressed blob named by the SHA-256 of its contents, and records
+// each backup as a JSON manifest mapping paths to blobs:
+//
+//	<backup_dir>/store/blobs/ab/cdef...   file contents
+//	<backup_dir>/store/snapshots/<id>.json
+
+type snapshotManifest struct {
+	ID      string          `json:"id"`
+	Created time.Time       `json:"created"`
+	Files   []manifestEntry `json:"files"`
+}
+
+type manifestEntry struct {
+	Path    string    `json:"path"`
+	SHA256  string    `json:"sha256"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+}
+
+func newBackupVerifyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "verify [id]",
+		Short: "Check that backups can be read and their contents are intact",
+		Long: `Verify every backup, or only the given one. Zip archives are read in full
+so their checksums are checked, after decrypting them if they are encrypted; store snapshots have every referenced blob
+re-hashed against its SHA-256.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id := ""
+			if len(args) == 1 {
+				id = args[0]
+			}
+			return verifyBackups(id)
+		},
+	}
+}
+
+func newBackupGCCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Delete store blobs no snapshot refers to",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			return collectGarbage(dryRun)
+		},
+	}
+
+	cmd.Flags().Bool("dry-run", false, "Show what would be deleted without deleting it")
+
+	return cmd
+}
+
+func storeDir(backupDir string) string {
+	return filepath.Join(backupDir, "store")
+}
+
+func blobPath(backupDir, sum string) string {
+	return filepath.Join(storeDir(backupDir), "blobs", sum[:2], sum[2:])
+}
+
+// writeSnapshot adds files from kgDir to the store and writes a manifest for
+// them. Blobs that are already in the store are not written again.
+func writeSnapshot(kgDir, backupDir, id string, files []string) (string, error) {
+	manifestPath := filepath.Join(storeDir(backupDir), "snapshots", id+".json")
+	if fileExists(manifestPath) {
+		return "", fmt.Errorf("snapshot %s already exists, try again in a second", id)
+	}
+	if err := os.MkdirAll(filepath.Dir(manifestPath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create store directory: %w", err)
+	}
+
+	manifest := snapshotManifest{ID: id, Created: time.Now(), Files: []manifestEntry{}}
+	newBlobs := 0
+	for _, relPath := range files {
+		path := filepath.Join(kgDir, filepath.FromSlash(relPath))
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to stat %s: %w", relPath, err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", relPath, err)
+		}
+
+		sum := sha256.Sum256(data)
+		hexSum := hex.EncodeToString(sum[:])
+		written, err := writeBlob(backupDir, hexSum, data)
+		if err != nil {
+			return "", fmt.Errorf("failed to store %s: %w", relPath, err)
+		}
+		if written {
+			newBlobs++
+		}
+
+		manifest.Files = append(manifest.Files, manifestEntry{
+			Path:    relPath,
+			SHA256:  hexSum,
+			Size:    int64(len(data)),
+			ModTime: info.ModTime(),
+		})
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := writeFileAtomic(manifestPath, data); err != nil {
+		return "", fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	fmt.Printf("Stored %d files (%d new blobs)\n", len(manifest.Files), newBlobs)
+	return manifestPath, nil
+}
+
+// writeBlob stores data under its hash unless it is already present, and
+// reports whether it wrote anything.
+func writeBlob(backupDir, sum string, data []byte) (bool, error) {
+	path := blobPath(backupDir, sum)
+	if fileExists(path) {
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, err
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return false, err
+	}
+	if err := zw.Close(); err != nil {
+		return false, err
+	}
+
+	return true, writeFileAtomic(path, buf.Bytes())
+}
+
+// readBlob returns the contents of a blob, checking them against its hash.
+func readBlob(backupDir, sum string) ([]byte, error) {
+	raw, err := os.ReadFile(blobPath(backupDir, sum))
+	if err != nil {
+		return nil, err
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("blob %s is corrupt: %w", sum, err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("blob %s is corrupt: %w", sum, err)
+	}
+
+	actual := sha256.Sum256(data)
+	if hex.EncodeToString(actual[:]) != sum {
+		return nil, fmt.Errorf("blob %s does not match its hash", sum)
+	}
+	return data, nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it into place, so an interrupted backup never leaves a partial file. The
+// file keeps the mode it had, or gets 0644 if it is new.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), fileMode(path)); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// fileMode returns the permissions of the file at path, or 0644 if there
+// is none, for files replaced through a temporary file.
+func fileMode(path string) os.FileMode {
+	if info, err := os.Stat(path); err == nil {
+		return info.Mode().Perm()
+	}
+	return 0644
+}
+
+func readManifest(path string) (snapshotManifest, error) {
+	var manifest snapshotManifest
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return manifest, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("failed to parse manifest %s: %w", filepath.Base(path), err)
+	}
+	// Hashes name blob files, so one that is truncated or edited by hand
+	// must not reach the filesystem.
+	for _, f := range manifest.Files {
+		if !isBlobSum(f.SHA256) {
+			return manifest, fmt.Errorf("manifest %s: entry %s has an invalid sha256 %q", filepath.Base(path), f.Path, f.SHA256)
+		}
+	}
+	return manifest, nil
+}
+
+// isBlobSum reports whether sum is a SHA-256 in lowercase hex, as blobs are
+// named.
+func isBlobSum(sum string) bool {
+	if len(sum) != sha256.Size*2 {
+		return false
+	}
+	for _, r := range sum {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// listSnapshots returns the snapshots in the store as backups. Size is the
+// total size of the files the snapshot refers to.
+func listSnapshots(backupDir string) ([]backupInfo, error) {
+	paths, err := filepath.Glob(filepath.Join(storeDir(backupDir), "snapshots", "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	var snapshots []backupInfo
+	for _, path := range paths {
+		id := strings.TrimSuffix(filepath.Base(path), ".json")
+		manifest, err := readManifest(path)
+		if err != nil {
+			// A damaged snapshot is still listed, so that verify can
+			// report it; reading it again fails with the reason.
+			info, statErr := os.Stat(path)
+			if statErr != nil {
+				return nil, err
+			}
+			snapshots = append(snapshots, backupInfo{ID: id, Kind: "store", Path: path, Created: info.ModTime()})
+			continue
+		}
+		var size int64
+		for _, f := range manifest.Files {
+			size += f.Size
+		}
+		snapshots = append(snapshots, backupInfo{
+			ID:      id,
+			Kind:    "store",
+			Path:    path,
+			Created: manifest.Created,
+			Size:    size,
+		})
+	}
+	return snapshots, nil
+}
+
+func readSnapshotFiles(b backupInfo) (map[string][]byte, error) {
+	manifest, err := readManifest(b.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	backupDir := filepath.Dir(filepath.Dir(filepath.Dir(b.Path)))
+	files := make(map[string][]byte, len(manifest.Files))
+	for _, f := range manifest.Files {
+		data, err := readBlob(backupDir, f.SHA256)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s from snapshot: %w", f.Path, err)
+		}
+		files[f.Path] = data
+	}
+	return files, nil
+}
+
+func verifyBackups(id string) error {
+	_, backupDir, err := backupDirs()
+	if err != nil {
+		return err
+	}
+
+	var backups []backupInfo
+	if id != "" {
+		b, err := findBackup(backupDir, id)
+		if err != nil {
+			return err
+		}
+		backups = []backupInfo{b}
+	} else if backups, err = listBackups(backupDir); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, b := range backups {
+		problems := verifyBackup(backupDir, b)
+		if len(problems) == 0 {
+			fmt.Printf("OK      %s (%s)\n", b.ID, b.Kind)
+			continue
+		}
+		failed++
+		fmt.Printf("FAILED  %s (%s)\n", b.ID, b.Kind)
+		for _, problem := range problems {
+			fmt.Printf("        %s\n", problem)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d backups failed verification", failed, len(backups))
+	}
+	fmt.Printf("%d backups verified\n", len(backups))
+	return nil
+}
+
+func verifyBackup(backupDir string, b backupInfo) []string {
+	var problems []string
+
+	if b.Kind == "store" {
+		manifest, err := readManifest(b.Path)
+		if err != nil {
+			return []string{err.Error()}
+		}
+		for _, f := range manifest.Files {
+			data, err := readBlob(backupDir, f.SHA256)
+			switch {
+			case err != nil:
+				problems = append(problems, fmt.Sprintf("%s: %v", f.Path, err))
+			case int64(len(data)) != f.Size:
+				problems = append(problems, fmt.Sprintf("%s: size %d, manifest says %d", f.Path, len(data), f.Size))
+			}
+		}
+		return problems
+	}
+
+	r, closeBackup, err := openZipBackup(b)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	defer closeBackup()
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", f.Name, err))
+			continue
+		}
+		// Reading to EOF makes archive/zip check the CRC-32.
+		if _, err := io.Copy(io.Discard, rc); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", f.Name, err))
+		}
+		rc.Close()
+	}
+	return problems
+}
+
+// collectGarbage deletes blobs that no snapshot manifest refers to.
+func collectGarbage(dryRun bool) error {
+	_, backupDir, err := backupDirs()
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := listSnapshots(backupDir)
+	if err != nil {
+		return err
+	}
+	referenced := make(map[string]bool)
+	for _, s := range snapshots {
+		manifest, err := readManifest(s.Path)
+		if err != nil {
+			return err
+		}
+		for _, f := range manifest.Files {
+			referenced[f.SHA256] = true
+		}
+	}
+
+	blobsDir := filepath.Join(storeDir(backupDir), "blobs")
+	var unreferenced []string
+	var freed int64
+	err = filepath.Walk(blobsDir, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		sum := filepath.Base(filepath.Dir(path)) + info.Name()
+		if !referenced[sum] {
+			unreferenced = append(unreferenced, path)
+			freed += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to scan blobs: %w", err)
+	}
+	sort.Strings(unreferenced)
+
+	if dryRun {
+		fmt.Printf("Would delete %d unreferenced blobs (%s) kept by %d snapshots\n", len(unreferenced), formatSize(freed), len(snapshots))
+		return nil
+	}
+
+	for _, path := range unreferenced {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to delete blob: %w", err)
+		}
+		os.Remove(filepath.Dir(path)) // only succeeds once the directory is empty
+	}
+	fmt.Printf("Deleted %d unreferenced blobs, freed %s\n", len(unreferenced), formatSize(freed))
+	return nil
+}
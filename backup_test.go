@@ -0,0 +1,77 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadManifest(t *testing.T) {
+	const sum = "4260f68f42020e91860792b5496d2a51b41a02a3dc6a6f79f04697e814f03622"
+	tests := []struct {
+		name    string
+		sha256  string
+		wantErr string
+	}{
+		{"valid", sum, ""},
+		{"truncated", sum[:4], `entry a.md has an invalid sha256 "4260"`},
+		{"empty", "", "entry a.md has an invalid sha256"},
+		{"path", "../" + sum[3:], "entry a.md has an invalid sha256"},
+		{"upper case", strings.ToUpper(sum), "entry a.md has an invalid sha256"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeVault(t, map[string]string{
+				"snap.json": `{"id": "snap", "files": [{"path": "a.md", "sha256": "` + tt.sha256 + `", "size": 1}]}`,
+			})
+			manifest, err := readManifest(filepath.Join(dir, "snap.json"))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("readManifest() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(manifest.Files) != 1 || manifest.Files[0].SHA256 != sum {
+				t.Errorf("files = %+v", manifest.Files)
+			}
+		})
+	}
+}
+
+func TestSelectBackupFiles(t *testing.T) {
+	files := map[string][]byte{"a/todo.md": nil, "b/todo.md": nil, "web-server.md": nil, "notes/idea.md": nil}
+	tests := []struct {
+		name     string
+		selected []string
+		want     []string
+		wantErr  string
+	}{
+		{"everything", nil, []string{"a/todo.md", "b/todo.md", "notes/idea.md", "web-server.md"}, ""},
+		{"title", []string{"Web Server"}, []string{"web-server.md"}, ""},
+		{"unique file name", []string{"idea.md"}, []string{"notes/idea.md"}, ""},
+		{"path", []string{"b/todo.md", "a/todo.md"}, []string{"b/todo.md", "a/todo.md"}, ""},
+		{"shared file name", []string{"todo"}, nil, "'todo' matches several notes: a/todo.md, b/todo.md"},
+		{"missing", []string{"Nothing"}, nil, "note 'Nothing' not found in backup"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectBackupFiles(files, tt.selected)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("selectBackupFiles() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectBackupFiles(%q) = %q, want %q", tt.selected, got, tt.want)
+			}
+		})
+	}
+}
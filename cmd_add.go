@@ -59,12 +59,15 @@ func addNote(title string) error {
 	}
 
 	fmt.Printf("Note created: %s\n", filePath)
+	commitNotes(fmt.Sprintf("Add note %q", title), filename)
 	return nil
 }
 
 func generateFilename(title string) string {
 	// Convert title to kebab-case
 	kebabTitle := strings.ToLower(strings.ReplaceAll(title, " ", "-"))
+	// Namespaced titles such as "lang/go" must not create subdirectories
+	kebabTitle = strings.NewReplacer("/", "-", "\\", "-").Replace(kebabTitle)
 	return kebabTitle + ".md"
 }
 
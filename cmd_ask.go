@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/blevesearch/bleve"
+	"github.com/pkoukk/tiktoken-go"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/openai"
+)
+
+func newAskCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ask [question]",
+		Short: "Answer a question from your notes",
+		Long: `Answer a question using the notes most relevant to it. Notes are found
+with the search index, and with embeddings when --embeddings is set or
+embeddings have been cached by an earlier run, then expanded with the notes
+they link to. As much of them as fits in --max-tokens is sent to the model,
+and the answer is streamed with citations to the notes it draws on.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			top, _ := cmd.Flags().GetInt("top")
+			hops, _ := cmd.Flags().GetInt("hops")
+			maxTokens, _ := cmd.Flags().GetInt("max-tokens")
+			embeddings, _ := cmd.Flags().GetBool("embeddings")
+			showContext, _ := cmd.Flags().GetBool("show-context")
+
+			return askNotes(strings.Join(args, " "), askOptions{
+				Top:         top,
+				Hops:        hops,
+				MaxTokens:   maxTokens,
+				Embeddings:  embeddings,
+				ShowContext: showContext,
+			})
+		},
+	}
+
+	cmd.Flags().IntP("top", "n", 5, "Number of notes to retrieve before expanding")
+	cmd.Flags().Int("hops", 1, "How many links to follow from the retrieved notes")
+	cmd.Flags().Int("max-tokens", 3000, "Token budget for the notes sent to the model")
+	cmd.Flags().Bool("embeddings", false, "Also rank notes by embedding similarity")
+	cmd.Flags().Bool("show-context", false, "Print the prompt sent to the model")
+
+	return cmd
+}
+
+type askOptions struct {
+	Top         int
+	Hops        int
+	MaxTokens   int
+	Embeddings  bool
+	ShowContext bool
+}
+
+// askSystemPrompt tells the model how to answer and cite.
+const askSystemPrompt = `You answer questions using only the user's notes, which are given below, each headed by its title and file path.
+Cite the notes you use inline, right after the statement they support, as [Title](path).
+If the notes do not answer the question, say so rather than guessing.`
+
+// contextNote is a note, or the part of one that fit the token budget,
+// chosen as context for a question.
+type contextNote struct {
+	Title string
+	Path  string
+	Text  string
+}
+
+func askNotes(question string, opts askOptions) error {
+	notesDir := viper.GetString("notes_directory")
+	store, err := openEdgeStore(notesDir)
+	if err != nil {
+		return err
+	}
+
+	ranked, err := retrieveNotes(notesDir, store, question, opts)
+	if err != nil {
+		return err
+	}
+	if len(ranked) == 0 {
+		fmt.Println("No notes match the question")
+		return nil
+	}
+	ranked = expandNeighbours(store, ranked, opts.Hops)
+
+	count := newTokenCounter()
+	var selected []contextNote
+	remaining := opts.MaxTokens
+	for _, i := range ranked {
+		rel, err := filepath.Rel(notesDir, store.paths[i])
+		if err != nil {
+			rel = store.paths[i]
+		}
+		note := contextNote{Title: store.notes[i].Title, Path: rel}
+		text, used := fitTokens(count, strings.TrimSpace(store.notes[i].Content), remaining-count(contextHeader(note)))
+		if text == "" {
+			continue
+		}
+		note.Text = text
+		selected = append(selected, note)
+		remaining -= used + count(contextHeader(note))
+	}
+	if len(selected) == 0 {
+		return fmt.Errorf("no note fits in %d tokens; raise --max-tokens", opts.MaxTokens)
+	}
+
+	prompt := buildAskPrompt(question, selected)
+	if opts.ShowContext {
+		fmt.Printf("--- system ---\n%s\n\n--- user ---\n%s\n\n--- answer ---\n", askSystemPrompt, prompt)
+	}
+
+	llm, err := openai.New()
+	if err != nil {
+		return fmt.Errorf("failed to create OpenAI client: %w", err)
+	}
+	_, err = llm.GenerateContent(context.TODO(), []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeSystem, askSystemPrompt),
+		llms.TextParts(llms.ChatMessageTypeHuman, prompt),
+	}, llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
+		_, err := os.Stdout.Write(chunk)
+		return err
+	}))
+	if err != nil {
+		return fmt.Errorf("failed to generate answer: %w", err)
+	}
+
+	fmt.Println("\n\nSources:")
+	for _, note := range selected {
+		fmt.Printf("- %s (%s)\n", note.Title, note.Path)
+	}
+	return nil
+}
+
+// retrieveNotes returns the indexes of the notes most relevant to the
+// question, best first. Search and embedding rankings are merged by
+// reciprocal rank fusion, so neither scale needs calibrating.
+func retrieveNotes(notesDir string, store *edgeStore, question string, opts askOptions) ([]int, error) {
+	const rrfK = 60
+	scores := make(map[int]float64)
+
+	byPath := make(map[string]int, len(store.paths))
+	for i, path := range store.paths {
+		byPath[path] = i
+	}
+	index, err := createIndex()
+	if err != nil {
+		return nil, err
+	}
+	defer index.Close()
+	request := bleve.NewSearchRequest(bleve.NewMatchQuery(question))
+	request.Size = opts.Top * 4
+	results, err := index.Search(request)
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+	for rank, hit := range results.Hits {
+		if i, ok := byPath[hit.ID]; ok {
+			scores[i] += 1 / float64(rrfK+rank+1)
+		}
+	}
+
+	if _, err := os.Stat(embeddingCachePath(notesDir)); opts.Embeddings || err == nil {
+		vectors, err := noteEmbeddings(notesDir, store.notes, store.paths)
+		if err != nil {
+			return nil, err
+		}
+		query, err := embedText(question)
+		if err != nil {
+			return nil, err
+		}
+		order := make([]int, len(vectors))
+		similarity := make([]float64, len(vectors))
+		for i, v := range vectors {
+			order[i] = i
+			similarity[i] = cosineSimilarity(query, v)
+		}
+		sort.SliceStable(order, func(a, b int) bool { return similarity[order[a]] > similarity[order[b]] })
+		for rank, i := range order[:min(len(order), opts.Top*4)] {
+			scores[i] += 1 / float64(rrfK+rank+1)
+		}
+	}
+
+	ranked := make([]int, 0, len(scores))
+	for i := range scores {
+		ranked = append(ranked, i)
+	}
+	sort.Slice(ranked, func(a, b int) bool {
+		if scores[ranked[a]] != scores[ranked[b]] {
+			return scores[ranked[a]] > scores[ranked[b]]
+		}
+		return ranked[a] < ranked[b]
+	})
+	if len(ranked) > opts.Top {
+		ranked = ranked[:opts.Top]
+	}
+	return ranked, nil
+}
+
+// expandNeighbours appends the notes linked from or to the ranked notes, by
+// relation or wikilink, up to hops links away, after the notes themselves.
+func expandNeighbours(store *edgeStore, ranked []int, hops int) []int {
+	neighbours := make(map[int][]int)
+	link := func(i, j int) {
+		if i != j {
+			neighbours[i] = append(neighbours[i], j)
+			neighbours[j] = append(neighbours[j], i)
+		}
+	}
+	for i, note := range store.notes {
+		for _, rel := range note.Relations {
+			if j, ok := store.index[noteKey(rel.Target)]; ok {
+				link(i, j)
+			}
+		}
+		for _, l := range extractWikilinks(note.Content) {
+			if j, ok := store.index[noteKey(l.Target)]; ok {
+				link(i, j)
+			}
+		}
+	}
+
+	seen := make(map[int]bool, len(ranked))
+	for _, i := range ranked {
+		seen[i] = true
+	}
+	frontier := ranked
+	for h := 0; h < hops; h++ {
+		var next []int
+		for _, i := range frontier {
+			for _, j := range neighbours[i] {
+				if !seen[j] {
+					seen[j] = true
+					next = append(next, j)
+				}
+			}
+		}
+		ranked = append(ranked, next...)
+		frontier = next
+	}
+	return ranked
+}
+
+// newTokenCounter returns a function counting tokens as the model does,
+// or approximately if the tokenizer is unavailable.
+func newTokenCounter() func(string) int {
+	enc, err := tiktoken.GetEncoding("cl100k_base")
+	if err != nil {
+		return func(s string) int { return len(s)/4 + 1 }
+	}
+	return func(s string) int { return len(enc.Encode(s, nil, nil)) }
+}
+
+// fitTokens returns as many whole paragraphs from the start of text as fit
+// in budget tokens, and the number of tokens they use.
+func fitTokens(count func(string) int, text string, budget int) (string, int) {
+	if budget <= 0 {
+		return "", 0
+	}
+	if n := count(text); n <= budget {
+		return text, n
+	}
+	var kept []string
+	used := 0
+	for _, para := range strings.Split(text, "\n\n") {
+		n := count(para + "\n\n")
+		if used+n > budget {
+			break
+		}
+		kept = append(kept, para)
+		used += n
+	}
+	return strings.Join(kept, "\n\n"), used
+}
+
+func contextHeader(note contextNote) string {
+	return fmt.Sprintf("## %s (%s)\n\n", note.Title, note.Path)
+}
+
+func buildAskPrompt(question string, notes []contextNote) string {
+	var b strings.Builder
+	b.WriteString("Notes:\n\n")
+	for _, note := range notes {
+		b.WriteString(contextHeader(note))
+		b.WriteString(note.Text)
+		b.WriteString("\n\n")
+	}
+	fmt.Fprintf(&b, "Question: %s", question)
+	return b.String()
+}
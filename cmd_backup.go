@@ -7,6 +7,8 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -14,119 +16,872 @@ import (
 )
 
 func newBackupCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "backup",
 		Short: "Create compressed, timestamped backups",
+		Long: `Create a compressed, timestamped backup of every note. Use the subcommands
+to list backups, inspect one against the current vault or restore from it.
+
+With --format store (or backup_format: store in .kgrc), backups go into a
+content-addressed store where each distinct file is kept once and every
+backup is a small manifest, which suits frequent backups of large vaults.
+
+With --encrypt (or backup_encrypt: true), zip backups are encrypted with a
+passphrase, read from the terminal or KG_BACKUP_PASSPHRASE. If public keys
+are listed in backup_recipients (see 'kg backup keygen'), backups are
+encrypted for them instead and restored with the matching identity file,
+given by backup_identity or --identity.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := backupOptionsFromConfig()
+			if cmd.Flags().Changed("format") {
+				opts.Format, _ = cmd.Flags().GetString("format")
+			}
+			if cmd.Flags().Changed("attachments") {
+				opts.Attachments, _ = cmd.Flags().GetBool("attachments")
+			}
+			if cmd.Flags().Changed("include-config") {
+				opts.Config, _ = cmd.Flags().GetBool("include-config")
+			}
+			if cmd.Flags().Changed("encrypt") {
+				opts.Encrypt, _ = cmd.Flags().GetBool("encrypt")
+			}
+			if cmd.Flags().Changed("recipient") {
+				opts.Recipients, _ = cmd.Flags().GetStringSlice("recipient")
+				opts.Encrypt = true
+			}
+			if err := opts.validate(); err != nil {
+				return err
+			}
+			return createBackup(opts)
+		},
+	}
+
+	cmd.Flags().String("format", "zip", "Backup format (zip or store)")
+	cmd.Flags().Bool("attachments", false, "Include attachments, not just markdown notes")
+	cmd.Flags().Bool("include-config", false, "Include .kgrc and the .kg directory")
+	cmd.Flags().Bool("encrypt", false, "Encrypt the backup with a passphrase or backup_recipients")
+	cmd.Flags().StringSlice("recipient", nil, "Encrypt for this public key instead of backup_recipients (repeatable)")
+	cmd.PersistentFlags().String("identity", "", "Identity file for opening encrypted backups (default backup_identity)")
+	viper.BindPFlag("backup_identity", cmd.PersistentFlags().Lookup("identity"))
+
+	cmd.AddCommand(
+		newBackupListCmd(),
+		newBackupShowCmd(),
+		newBackupRestoreCmd(),
+		newBackupVerifyCmd(),
+		newBackupGCCmd(),
+		newBackupKeygenCmd(),
+	)
+
+	return cmd
+}
+
+func newBackupListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List available backups",
+		Args:  cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return createBackup()
+			return listBackupsCmd()
 		},
 	}
 }
 
-func createBackup() error {
-	// Get the knowledge graph directory from config
-	kgDir := viper.GetString("knowledge_graph_dir")
+func newBackupShowCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "show [id]",
+		Short: "List the files in a backup and how they differ from the vault",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			patch, _ := cmd.Flags().GetBool("patch")
+			return showBackup(args[0], patch)
+		},
+	}
+
+	cmd.Flags().BoolP("patch", "p", false, "Show a line diff for each modified note")
+
+	return cmd
+}
+
+func newBackupRestoreCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "restore [id] [note]...",
+		Short: "Restore all notes, or the named ones, from a backup",
+		Long: `Restore notes from a backup. With no notes named, every note in the backup
+is restored; otherwise only the given notes, matched by path, filename or
+title. A safety backup of the current vault is taken first unless
+--no-snapshot is given.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			onConflict, _ := cmd.Flags().GetString("on-conflict")
+			noSnapshot, _ := cmd.Flags().GetBool("no-snapshot")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+			switch onConflict {
+			case "overwrite", "skip", "rename":
+			default:
+				return fmt.Errorf("unsupported conflict strategy: %s. Use 'overwrite', 'skip' or 'rename'", onConflict)
+			}
+
+			return restoreBackup(args[0], args[1:], restoreOptions{
+				OnConflict: onConflict,
+				Snapshot:   !noSnapshot,
+				DryRun:     dryRun,
+			})
+		},
+	}
+
+	cmd.Flags().String("on-conflict", "overwrite", "What to do with notes that changed since the backup (overwrite, skip, rename)")
+	cmd.Flags().Bool("no-snapshot", false, "Do not back up the current vault before restoring")
+	cmd.Flags().Bool("dry-run", false, "Show what would be restored without writing anything")
+
+	return cmd
+}
+
+// backupDirs returns the notes directory and the directory backups are
+// kept in. knowledge_graph_dir is still honoured for configs written before
+// backups used notes_directory like every other command.
+func backupDirs() (string, string, error) {
+	kgDir := viper.GetString("notes_directory")
+	if kgDir == "" {
+		kgDir = viper.GetString("knowledge_graph_dir")
+	}
 	if kgDir == "" {
-		return fmt.Errorf("knowledge graph directory not set in config")
+		return "", "", fmt.Errorf("notes directory not set in config")
 	}
 
-	// Create a timestamped directory for the backup
 	backupDir := viper.GetString("backup_dir")
 	if backupDir == "" {
 		backupDir = filepath.Join(kgDir, "backups")
 	}
+
+	return kgDir, backupDir, nil
+}
+
+// backupOptions controls what a backup contains and how it is stored.
+type backupOptions struct {
+	Format      string
+	Attachments bool
+	Config      bool
+	Encrypt     bool
+	Recipients  []string
+}
+
+func backupOptionsFromConfig() backupOptions {
+	opts := backupOptions{
+		Format:      viper.GetString("backup_format"),
+		Attachments: viper.GetBool("backup_include_attachments"),
+		Config:      viper.GetBool("backup_include_config"),
+		Encrypt:     viper.GetBool("backup_encrypt"),
+		Recipients:  viper.GetStringSlice("backup_recipients"),
+	}
+	if len(opts.Recipients) > 0 {
+		opts.Encrypt = true
+	}
+	if opts.Format == "" {
+		opts.Format = "zip"
+	}
+	return opts
+}
+
+// validate reports options that cannot be combined, whether they came from
+// flags or the config file.
+func (o backupOptions) validate() error {
+	if o.Format != "zip" && o.Format != "store" {
+		return fmt.Errorf("unsupported backup format: %s. Use 'zip' or 'store'", o.Format)
+	}
+	if o.Encrypt && o.Format == "store" {
+		return fmt.Errorf("encryption is only supported for zip backups")
+	}
+	return nil
+}
+
+func createBackup(opts backupOptions) error {
+	kgDir, backupDir, err := backupDirs()
+	if err != nil {
+		return err
+	}
+
+	backupPath, err := writeBackup(kgDir, backupDir, opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Backup created: %s\n", backupPath)
+
+	// Implement rotation of old backups
+	if err := rotateBackups(backupDir); err != nil {
+		return fmt.Errorf("failed to rotate backups: %w", err)
+	}
+
+	return nil
+}
+
+// writeBackup stores a new timestamped backup of kgDir in backupDir, in the
+// format opts asks for, and returns its path.
+func writeBackup(kgDir, backupDir string, opts backupOptions) (string, error) {
 	if err := os.MkdirAll(backupDir, 0755); err != nil {
-		return fmt.Errorf("failed to create backup directory: %w", err)
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	files, err := collectBackupFiles(kgDir, backupDir, opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup: %w", err)
 	}
 
 	timestamp := time.Now().Format("20060102_150405")
+	if opts.Format == "store" {
+		return writeSnapshot(kgDir, backupDir, timestamp, files)
+	}
+
 	backupName := fmt.Sprintf("kg_backup_%s.zip", timestamp)
+	if opts.Encrypt {
+		backupName += encryptedSuffix
+	}
 	backupPath := filepath.Join(backupDir, backupName)
+	if fileExists(backupPath) {
+		return "", fmt.Errorf("backup %s already exists, try again in a second", backupName)
+	}
 
 	// Create a new zip file
 	zipFile, err := os.Create(backupPath)
 	if err != nil {
-		return fmt.Errorf("failed to create zip file: %w", err)
+		return "", fmt.Errorf("failed to create zip file: %w", err)
 	}
 	defer zipFile.Close()
 
-	zipWriter := zip.NewWriter(zipFile)
-	defer zipWriter.Close()
+	var out io.Writer = zipFile
+	var encrypted io.WriteCloser
+	if opts.Encrypt {
+		if encrypted, err = encryptWriter(zipFile, opts); err != nil {
+			os.Remove(backupPath)
+			return "", err
+		}
+		out = encrypted
+	}
 
-	// Walk through the knowledge graph directory and add files to the zip
-	err = filepath.Walk(kgDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	zipWriter := zip.NewWriter(out)
+
+	for _, relPath := range files {
+		if err := addFileToZip(zipWriter, kgDir, relPath); err != nil {
+			os.Remove(backupPath)
+			return "", fmt.Errorf("failed to create backup: %w", err)
 		}
+	}
 
-		// Skip directories and non-markdown files
-		if info.IsDir() || filepath.Ext(path) != ".md" {
-			return nil
+	if err := zipWriter.Close(); err != nil {
+		os.Remove(backupPath)
+		return "", fmt.Errorf("failed to finish zip file: %w", err)
+	}
+	if encrypted != nil {
+		if err := encrypted.Close(); err != nil {
+			os.Remove(backupPath)
+			return "", fmt.Errorf("failed to finish encrypted backup: %w", err)
+		}
+	}
+
+	return backupPath, nil
+}
+
+func addFileToZip(zipWriter *zip.Writer, kgDir, relPath string) error {
+	zipFile, err := zipWriter.Create(relPath)
+	if err != nil {
+		return fmt.Errorf("failed to create file in zip: %w", err)
+	}
+
+	file, err := os.Open(filepath.Join(kgDir, filepath.FromSlash(relPath)))
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(zipFile, file); err != nil {
+		return fmt.Errorf("failed to copy file to zip: %w", err)
+	}
+
+	return nil
+}
+
+// collectBackupFiles lists the files a backup of kgDir should contain, as
+// sorted slash-separated relative paths. Markdown notes are always
+// included; attachments and kg's own configuration only when asked for.
+// The backup directory and the search index are never included.
+func collectBackupFiles(kgDir, backupDir string, opts backupOptions) ([]string, error) {
+	var files []string
+	err := filepath.Walk(kgDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
 		}
 
 		relPath, err := filepath.Rel(kgDir, path)
 		if err != nil {
 			return fmt.Errorf("failed to get relative path: %w", err)
 		}
+		relPath = filepath.ToSlash(relPath)
+
+		if info.IsDir() {
+			if path == backupDir || info.Name() == ".kg_search_index" {
+				return filepath.SkipDir
+			}
+			if path != kgDir && strings.HasPrefix(info.Name(), ".") && !(opts.Config && relPath == ".kg") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		switch {
+		case filepath.Ext(path) == ".md" && !strings.HasPrefix(relPath, ".kg/"):
+		case opts.Config && (relPath == ".kgrc" || strings.HasPrefix(relPath, ".kg/")):
+		case opts.Attachments && !strings.HasPrefix(info.Name(), "."):
+		default:
+			return nil
+		}
+
+		files = append(files, relPath)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+func rotateBackups(backupDir string) error {
+	backups, err := listBackups(backupDir)
+	if err != nil {
+		return err
+	}
+
+	keep := retentionPolicyFromConfig().keep(backups)
+	removedSnapshots := false
+	for _, backup := range backups {
+		if keep[backup.ID] {
+			continue
+		}
+		if err := os.Remove(backup.Path); err != nil {
+			return fmt.Errorf("failed to remove old backup %s: %w", backup.Path, err)
+		}
+		if backup.Kind == "store" {
+			removedSnapshots = true
+		}
+		fmt.Printf("Removed old backup: %s\n", backup.Path)
+	}
+
+	if removedSnapshots {
+		fmt.Println("Run 'kg backup gc' to free space used only by removed snapshots")
+	}
+
+	return nil
+}
+
+// retentionPolicy decides which backups survive rotation. A backup is kept
+// if it is one of the Last most recent, or the newest backup of one of the
+// most recent Hourly hours, Daily days, Weekly weeks or Monthly months.
+type retentionPolicy struct {
+	Last    int
+	Hourly  int
+	Daily   int
+	Weekly  int
+	Monthly int
+}
+
+func retentionPolicyFromConfig() retentionPolicy {
+	p := retentionPolicy{
+		Last:    viper.GetInt("max_backups"),
+		Hourly:  viper.GetInt("retention.hourly"),
+		Daily:   viper.GetInt("retention.daily"),
+		Weekly:  viper.GetInt("retention.weekly"),
+		Monthly: viper.GetInt("retention.monthly"),
+	}
+	if p.Last <= 0 && p.Hourly <= 0 && p.Daily <= 0 && p.Weekly <= 0 && p.Monthly <= 0 {
+		p.Last = 5 // Default to keeping 5 most recent backups
+	}
+	return p
+}
+
+// keep returns the IDs of the backups to keep. backups must be sorted
+// newest first, as listBackups returns them.
+func (p retentionPolicy) keep(backups []backupInfo) map[string]bool {
+	keep := make(map[string]bool)
+	for i := 0; i < p.Last && i < len(backups); i++ {
+		keep[backups[i].ID] = true
+	}
+
+	bucket := func(n int, period func(time.Time) string) {
+		seen := make(map[string]bool)
+		for _, b := range backups {
+			if len(seen) >= n {
+				break
+			}
+			key := period(b.Created)
+			if !seen[key] {
+				seen[key] = true
+				keep[b.ID] = true
+			}
+		}
+	}
+	bucket(p.Hourly, func(t time.Time) string { return t.Format("2006-01-02 15") })
+	bucket(p.Daily, func(t time.Time) string { return t.Format("2006-01-02") })
+	bucket(p.Weekly, func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	})
+	bucket(p.Monthly, func(t time.Time) string { return t.Format("2006-01") })
+
+	return keep
+}
+
+// backupInfo describes one backup, either a zip archive or a snapshot in
+// the content-addressed store. ID is the timestamp it was taken at, which
+// is what the backup subcommands take as an argument.
+type backupInfo struct {
+	ID        string
+	Kind      string // "zip" or "store"
+	Encrypted bool
+	Path      string
+	Created   time.Time
+	Size      int64
+}
 
-		zipFile, err := zipWriter.Create(relPath)
+// listBackups returns the backups in backupDir, newest first.
+func listBackups(backupDir string) ([]backupInfo, error) {
+	paths, err := filepath.Glob(filepath.Join(backupDir, "kg_backup_*.zip*"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	var backups []backupInfo
+	for _, path := range paths {
+		encrypted := strings.HasSuffix(path, ".zip"+encryptedSuffix)
+		if !encrypted && !strings.HasSuffix(path, ".zip") {
+			continue
+		}
+		info, err := os.Stat(path)
 		if err != nil {
-			return fmt.Errorf("failed to create file in zip: %w", err)
+			return nil, fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		id := backupID(path)
+		created, err := time.ParseInLocation("20060102_150405", id, time.Local)
+		if err != nil {
+			created = info.ModTime()
+		}
+		backups = append(backups, backupInfo{ID: id, Kind: "zip", Encrypted: encrypted, Path: path, Created: created, Size: info.Size()})
+	}
+
+	snapshots, err := listSnapshots(backupDir)
+	if err != nil {
+		return nil, err
+	}
+	backups = append(backups, snapshots...)
+
+	sort.Slice(backups, func(i, j int) bool { return backups[i].ID > backups[j].ID })
+	return backups, nil
+}
+
+// findBackup resolves a backup by ID, file name, unique ID prefix or
+// "latest".
+func findBackup(backupDir, id string) (backupInfo, error) {
+	backups, err := listBackups(backupDir)
+	if err != nil {
+		return backupInfo{}, err
+	}
+	if len(backups) == 0 {
+		return backupInfo{}, fmt.Errorf("no backups found in %s", backupDir)
+	}
+	if id == "latest" {
+		return backups[0], nil
+	}
+
+	id = backupID(id)
+	var matches []backupInfo
+	for _, b := range backups {
+		if b.ID == id {
+			return b, nil
+		}
+		if strings.HasPrefix(b.ID, id) {
+			matches = append(matches, b)
 		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return backupInfo{}, fmt.Errorf("backup '%s' not found", id)
+	case 1:
+		return matches[0], nil
+	default:
+		return backupInfo{}, fmt.Errorf("backup '%s' is ambiguous: matches %d backups", id, len(matches))
+	}
+}
+
+// backupID returns the ID of a backup given its file name or path.
+func backupID(name string) string {
+	name = strings.TrimSuffix(filepath.Base(name), encryptedSuffix)
+	return strings.TrimSuffix(strings.TrimPrefix(name, "kg_backup_"), ".zip")
+}
 
-		file, err := os.Open(path)
+// readBackupFiles returns the contents of every file in a backup, keyed by
+// slash-separated path relative to the notes directory.
+func readBackupFiles(b backupInfo) (map[string][]byte, error) {
+	if b.Kind == "store" {
+		return readSnapshotFiles(b)
+	}
+
+	r, closeBackup, err := openZipBackup(b)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBackup()
+
+	files := make(map[string][]byte, len(r.File))
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s in backup: %w", f.Name, err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
 		if err != nil {
-			return fmt.Errorf("failed to open file: %w", err)
+			return nil, fmt.Errorf("failed to read %s in backup: %w", f.Name, err)
 		}
-		defer file.Close()
+		files[f.Name] = data
+	}
+
+	return files, nil
+}
 
-		_, err = io.Copy(zipFile, file)
+// readVaultFiles returns the current contents of the files a backup with
+// opts would contain, in the same form as readBackupFiles.
+func readVaultFiles(kgDir, backupDir string, opts backupOptions) (map[string][]byte, error) {
+	paths, err := collectBackupFiles(kgDir, backupDir, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notes: %w", err)
+	}
+
+	files := make(map[string][]byte, len(paths))
+	for _, relPath := range paths {
+		data, err := os.ReadFile(filepath.Join(kgDir, filepath.FromSlash(relPath)))
 		if err != nil {
-			return fmt.Errorf("failed to copy file to zip: %w", err)
+			return nil, fmt.Errorf("failed to read notes: %w", err)
 		}
+		files[relPath] = data
+	}
+	return files, nil
+}
 
+// contentOptions infers what a backup was told to include from the files it
+// contains, so it can be compared against the matching part of the vault.
+func contentOptions(files map[string][]byte) backupOptions {
+	var opts backupOptions
+	for path := range files {
+		switch {
+		case path == ".kgrc" || strings.HasPrefix(path, ".kg/"):
+			opts.Config = true
+		case filepath.Ext(path) != ".md":
+			opts.Attachments = true
+		}
+	}
+	return opts
+}
+
+func listBackupsCmd() error {
+	_, backupDir, err := backupDirs()
+	if err != nil {
+		return err
+	}
+
+	backups, err := listBackups(backupDir)
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 {
+		fmt.Printf("No backups found in %s\n", backupDir)
 		return nil
-	})
+	}
 
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCreated\tFormat\tFiles\tSize")
+	fmt.Fprintln(w, "--\t-------\t------\t-----\t----")
+	for _, b := range backups {
+		files := "?"
+		if n, err := backupFileCount(b); err == nil {
+			files = fmt.Sprint(n)
+		}
+		format := b.Kind
+		if b.Encrypted {
+			format += " (encrypted)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", b.ID, b.Created.Format("2006-01-02 15:04:05"), format, files, formatSize(b.Size))
+	}
+	return w.Flush()
+}
+
+func backupFileCount(b backupInfo) (int, error) {
+	if b.Kind == "store" {
+		manifest, err := readManifest(b.Path)
+		if err != nil {
+			return 0, err
+		}
+		return len(manifest.Files), nil
+	}
+	if b.Encrypted {
+		// Counting would mean asking for the key just to list backups.
+		return 0, fmt.Errorf("backup is encrypted")
+	}
+
+	r, err := zip.OpenReader(b.Path)
 	if err != nil {
-		return fmt.Errorf("failed to create backup: %w", err)
+		return 0, err
 	}
+	defer r.Close()
+	return len(r.File), nil
+}
 
-	fmt.Printf("Backup created: %s\n", backupPath)
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
 
-	// Implement rotation of old backups
-	if err := rotateBackups(backupDir); err != nil {
-		return fmt.Errorf("failed to rotate backups: %w", err)
+// backupChange is the state of one file in a backup relative to the vault.
+type backupChange struct {
+	Path   string
+	Status string // unchanged, modified, deleted (only in backup) or added (only in vault)
+}
+
+func compareBackup(backupFiles, vaultFiles map[string][]byte) []backupChange {
+	var changes []backupChange
+	for path, data := range backupFiles {
+		current, ok := vaultFiles[path]
+		switch {
+		case !ok:
+			changes = append(changes, backupChange{path, "deleted"})
+		case string(current) != string(data):
+			changes = append(changes, backupChange{path, "modified"})
+		default:
+			changes = append(changes, backupChange{path, "unchanged"})
+		}
+	}
+	for path := range vaultFiles {
+		if _, ok := backupFiles[path]; !ok {
+			changes = append(changes, backupChange{path, "added"})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+func showBackup(id string, patch bool) error {
+	kgDir, backupDir, err := backupDirs()
+	if err != nil {
+		return err
+	}
+
+	b, err := findBackup(backupDir, id)
+	if err != nil {
+		return err
+	}
+	backupFiles, err := readBackupFiles(b)
+	if err != nil {
+		return err
+	}
+	vaultFiles, err := readVaultFiles(kgDir, backupDir, contentOptions(backupFiles))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Backup %s (%s, %d files, %s)\n\n", b.ID, b.Created.Format("2006-01-02 15:04:05"), len(backupFiles), formatSize(b.Size))
+
+	changes := compareBackup(backupFiles, vaultFiles)
+	counts := make(map[string]int)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Status\tFile\tSize")
+	fmt.Fprintln(w, "------\t----\t----")
+	for _, c := range changes {
+		counts[c.Status]++
+		size := len(backupFiles[c.Path])
+		if c.Status == "added" {
+			size = len(vaultFiles[c.Path])
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", c.Status, c.Path, formatSize(int64(size)))
+	}
+	w.Flush()
+
+	fmt.Printf("\n%d unchanged, %d modified, %d deleted since backup, %d added since backup\n",
+		counts["unchanged"], counts["modified"], counts["deleted"], counts["added"])
+
+	if patch {
+		for _, c := range changes {
+			if c.Status != "modified" {
+				continue
+			}
+			fmt.Println()
+			fmt.Print(unifiedDiff(string(backupFiles[c.Path]), string(vaultFiles[c.Path]), "backup/"+c.Path, "vault/"+c.Path))
+		}
 	}
 
 	return nil
 }
 
-func rotateBackups(backupDir string) error {
-	maxBackups := viper.GetInt("max_backups")
-	if maxBackups <= 0 {
-		maxBackups = 5 // Default to keeping 5 most recent backups
+type restoreOptions struct {
+	OnConflict string
+	Snapshot   bool
+	DryRun     bool
+}
+
+func restoreBackup(id string, selected []string, opts restoreOptions) error {
+	kgDir, backupDir, err := backupDirs()
+	if err != nil {
+		return err
+	}
+
+	b, err := findBackup(backupDir, id)
+	if err != nil {
+		return err
+	}
+	backupFiles, err := readBackupFiles(b)
+	if err != nil {
+		return err
 	}
 
-	backups, err := filepath.Glob(filepath.Join(backupDir, "kg_backup_*.zip"))
+	paths, err := selectBackupFiles(backupFiles, selected)
 	if err != nil {
-		return fmt.Errorf("failed to list backups: %w", err)
+		return err
 	}
 
-	if len(backups) <= maxBackups {
-		return nil
+	// Check every entry before anything is printed or written, so that a
+	// crafted archive cannot place files outside the vault
+	dests := make(map[string]string, len(paths))
+	for _, path := range paths {
+		dest, err := restoreDest(kgDir, path)
+		if err != nil {
+			return err
+		}
+		dests[path] = dest
 	}
 
-	sort.Slice(backups, func(i, j int) bool {
-		return backups[i] > backups[j] // Sort in descending order
-	})
+	if opts.Snapshot && !opts.DryRun {
+		snapshotOpts := backupOptionsFromConfig()
+		if err := snapshotOpts.validate(); err != nil {
+			return fmt.Errorf("failed to create safety backup: %w", err)
+		}
+		snapshot, err := writeBackup(kgDir, backupDir, snapshotOpts)
+		if err != nil {
+			return fmt.Errorf("failed to create safety backup: %w", err)
+		}
+		fmt.Printf("Safety backup created: %s\n", snapshot)
+	}
+
+	restored, skipped := 0, 0
+	for _, path := range paths {
+		data := backupFiles[path]
+		dest := dests[path]
+
+		action := "restore"
+		if current, err := os.ReadFile(dest); err == nil {
+			if string(current) == string(data) {
+				continue
+			}
+			action = opts.OnConflict
+		}
+
+		switch action {
+		case "skip":
+			fmt.Printf("Skipped %s (changed since backup)\n", path)
+			skipped++
+			continue
+		case "rename":
+			ext := filepath.Ext(dest)
+			dest = strings.TrimSuffix(dest, ext) + ".restored-" + b.ID + ext
+		}
 
-	for _, backup := range backups[maxBackups:] {
-		if err := os.Remove(backup); err != nil {
-			return fmt.Errorf("failed to remove old backup %s: %w", backup, err)
+		if opts.DryRun {
+			fmt.Printf("Would restore %s to %s\n", path, dest)
+			restored++
+			continue
 		}
-		fmt.Printf("Removed old backup: %s\n", backup)
+
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", path, err)
+		}
+		if err := os.WriteFile(dest, data, 0644); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", path, err)
+		}
+		fmt.Printf("Restored %s\n", dest)
+		restored++
 	}
 
+	verb := "Restored"
+	if opts.DryRun {
+		verb = "Would restore"
+	}
+	fmt.Printf("%s %d notes from backup %s (%d skipped)\n", verb, restored, b.ID, skipped)
 	return nil
-}
\ No newline at end of file
+}
+
+// restoreDest returns where a backup entry is restored to, refusing
+// entries that would land outside the vault.
+func restoreDest(kgDir, path string) (string, error) {
+	if filepath.IsAbs(filepath.FromSlash(path)) || strings.HasPrefix(path, "/") {
+		return "", fmt.Errorf("refusing to restore %s: absolute path in backup", path)
+	}
+	dest := filepath.Join(kgDir, filepath.FromSlash(path))
+	rel, err := filepath.Rel(kgDir, dest)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("refusing to restore %s: outside the notes directory", path)
+	}
+	return dest, nil
+}
+
+// selectBackupFiles picks the files named on the command line out of a
+// backup, matching by path, file name or note title. A file name or title
+// that several files share must be given as a path instead. With no names
+// given, every file is selected.
+func selectBackupFiles(files map[string][]byte, selected []string) ([]string, error) {
+	var paths []string
+	if len(selected) == 0 {
+		for path := range files {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		return paths, nil
+	}
+
+	for _, name := range selected {
+		match := filepath.ToSlash(name)
+		if _, ok := files[match]; !ok {
+			var matches []string
+			for path := range files {
+				base := filepath.Base(path)
+				if base == name || base == generateFilename(name) {
+					matches = append(matches, path)
+				}
+			}
+			sort.Strings(matches)
+			switch len(matches) {
+			case 0:
+				return nil, fmt.Errorf("note '%s' not found in backup", name)
+			case 1:
+				match = matches[0]
+			default:
+				return nil, fmt.Errorf("'%s' matches several notes: %s; give the path of the one to restore", name, strings.Join(matches, ", "))
+			}
+		}
+		if !containsString(paths, match) {
+			paths = append(paths, match)
+		}
+	}
+	return paths, nil
+}
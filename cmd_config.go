@@ -121,9 +121,29 @@ func unsetConfig(key string) error {
 
 func validateConfigKey(key string) error {
 	validKeys := []string{
+		"notes_directory",
 		"knowledge_graph_dir",
 		"backup_dir",
 		"max_backups",
+		"backup_format",
+		"backup_include_attachments",
+		"backup_include_config",
+		"backup_encrypt",
+		"backup_recipients",
+		"backup_identity",
+		"retention.hourly",
+		"retention.daily",
+		"retention.weekly",
+		"retention.monthly",
+		"git.auto_commit",
+		"relation_types",
+		"embedding_model",
+		"llm_price_per_1k_tokens",
+		"tag_aliases_file",
+		"normalize.rules",
+		"normalize.tag_case",
+		"normalize.date_fields",
+		"normalize.key_order",
 		"editor",
 		"default_tags",
 		"date_format",
@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -16,55 +18,130 @@ import (
 )
 
 func newConnectCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "connect [concept1] [concept2]",
 		Short: "Link two concepts with AI-generated content",
-		Args:  cobra.ExactArgs(2),
+		Long: `Link two concepts with AI-generated content.
+
+By default the notes are recorded as connected_to each other. With --rel the
+link is typed and directed: "kg connect A B --rel depends_on" records
+depends_on: [B] on A and the inverse, required_by: [A], on B. The relation
+types and their inverses can be extended with relation_types in the config
+file.
+
+The explanation is generated from both notes' content and cites the
+passages it drew on as footnotes. --note decides where it goes: a new
+"<a>-<b>-connection" note, appended to concept1's note, or nowhere, in
+which case only the relation is recorded. --review opens the explanation in
+your editor before anything is written.`,
+		Args:              cobra.ExactArgs(2),
+		ValidArgsFunction: completeNotes(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return connectConcepts(args[0], args[1])
+			rel, _ := cmd.Flags().GetString("rel")
+			noteMode, _ := cmd.Flags().GetString("note")
+			review, _ := cmd.Flags().GetBool("review")
+
+			switch noteMode {
+			case "new", "append", "none":
+			default:
+				return fmt.Errorf("unsupported note mode: %s. Use 'new', 'append' or 'none'", noteMode)
+			}
+			if review && noteMode == "none" {
+				return fmt.Errorf("--review has nothing to review with --note=none")
+			}
+
+			return connectConcepts(args[0], args[1], connectOptions{
+				Rel:    rel,
+				Note:   noteMode,
+				Review: review,
+			})
 		},
 	}
+
+	cmd.Flags().String("rel", defaultRelation, "Relation type from concept1 to concept2")
+	cmd.Flags().String("note", "new", "Where to write the explanation (new, append or none)")
+	cmd.Flags().Bool("review", false, "Edit the explanation before anything is written")
+
+	return cmd
 }
 
-func connectConcepts(concept1, concept2 string) error {
+type connectOptions struct {
+	Rel    string
+	Note   string
+	Review bool
+}
+
+func connectConcepts(concept1, concept2 string, opts connectOptions) error {
 	// Verify both concepts exist as notes
 	notesDir := viper.GetString("notes_directory")
-	if notesDir == "" {
-		return fmt.Errorf("notes directory not set in config")
+	store, err := openEdgeStore(notesDir)
+	if err != nil {
+		return err
 	}
 
-	concept1Path := filepath.Join(notesDir, generateFilename(concept1))
-	concept2Path := filepath.Join(notesDir, generateFilename(concept2))
-
-	if !fileExists(concept1Path) {
-		return fmt.Errorf("concept '%s' does not exist as a note", concept1)
-	}
-	if !fileExists(concept2Path) {
-		return fmt.Errorf("concept '%s' does not exist as a note", concept2)
+	note1, path1, err := store.Note(concept1)
+	if err != nil {
+		return err
 	}
-
-	// Generate content linking the two concepts
-	content, err := generateLinkingContent(concept1, concept2)
+	note2, path2, err := store.Note(concept2)
 	if err != nil {
-		return fmt.Errorf("failed to generate linking content: %w", err)
+		return err
+	}
+	if path1 == path2 {
+		return fmt.Errorf("cannot connect '%s' to itself", note1.Title)
+	}
+	if !store.vocab.Known(opts.Rel) {
+		return store.unknownRelation(opts.Rel)
 	}
 
-	// Create a new note with the generated content
-	newNoteTitle := fmt.Sprintf("%s-%s-connection", concept1, concept2)
+	newNoteTitle := fmt.Sprintf("%s-%s-connection", note1.Title, note2.Title)
 	newNotePath := filepath.Join(notesDir, generateFilename(newNoteTitle))
-	if err := createNewNote(newNotePath, newNoteTitle, content, []string{concept1, concept2}); err != nil {
-		return fmt.Errorf("failed to create new note: %w", err)
+	if opts.Note == "new" && fileExists(newNotePath) {
+		return fmt.Errorf("connection note %s already exists; use --note=append or --note=none", newNotePath)
+	}
+
+	var content string
+	if opts.Note != "none" {
+		// Generate content linking the two concepts
+		content, err = generateLinkingContent(note1, note2, opts.Rel)
+		if err != nil {
+			return fmt.Errorf("failed to generate linking content: %w", err)
+		}
+		if opts.Review {
+			if content, err = reviewInEditor(content); err != nil {
+				return err
+			}
+			if content == "" {
+				fmt.Println("Explanation is empty, nothing written")
+				return nil
+			}
+		}
+	}
+
+	changed := []string{path1, path2}
+	switch opts.Note {
+	case "new":
+		if err := createNewNote(newNotePath, newNoteTitle, content, []string{note1.Title, note2.Title}); err != nil {
+			return fmt.Errorf("failed to create new note: %w", err)
+		}
+		changed = append(changed, newNotePath)
+		fmt.Printf("Created new note connecting %s and %s: %s\n", note1.Title, note2.Title, newNotePath)
+	case "append":
+		if err := appendConnection(path1, note2.Title, opts.Rel, content); err != nil {
+			return fmt.Errorf("failed to update %s: %w", note1.Title, err)
+		}
+		fmt.Printf("Appended connection to %s to %s\n", note2.Title, path1)
 	}
 
-	// Update frontmatter of involved notes
-	if err := updateFrontmatter(concept1Path, "connected_to", concept2); err != nil {
-		return fmt.Errorf("failed to update frontmatter of %s: %w", concept1, err)
+	// Record the relation on the first note and its inverse on the second
+	if _, err := store.Add(path1, opts.Rel, path2); err != nil {
+		return fmt.Errorf("failed to connect %s and %s: %w", note1.Title, note2.Title, err)
 	}
-	if err := updateFrontmatter(concept2Path, "connected_to", concept1); err != nil {
-		return fmt.Errorf("failed to update frontmatter of %s: %w", concept2, err)
+	if opts.Note == "none" {
+		fmt.Printf("Connected %s and %s\n", note1.Title, note2.Title)
 	}
 
-	fmt.Printf("Created new note connecting %s and %s: %s\n", concept1, concept2, newNotePath)
+	commitNotes(fmt.Sprintf("Connect %q and %q", note1.Title, note2.Title), changed...)
 	return nil
 }
 
@@ -73,21 +150,182 @@ func fileExists(path string) bool {
 	return !os.IsNotExist(err)
 }
 
-func generateLinkingContent(concept1, concept2 string) (string, error) {
+// maxPassageChars bounds how much of each note is sent to the model, and
+// maxParagraphChars how much of any one paragraph, so that a long first
+// paragraph does not crowd out the rest of the note.
+const (
+	maxPassageChars   = 6000
+	maxParagraphChars = 2000
+)
+
+// passage is a paragraph of a note that generated text may cite. Label is
+// how the model refers to it, such as A2 for the second paragraph of the
+// first note.
+type passage struct {
+	Label string
+	Note  string
+	Text  string
+}
+
+// notePassages splits a note into labelled paragraphs, shortening long
+// ones and skipping those that no longer fit in maxPassageChars.
+func notePassages(note Note, prefix string) []passage {
+	var passages []passage
+	total := 0
+	for _, para := range strings.Split(note.Content, "\n\n") {
+		para = strings.TrimSpace(para)
+		if para == "" || strings.HasPrefix(para, "# ") && !strings.Contains(para, "\n") {
+			continue
+		}
+		if len(para) > maxParagraphChars {
+			para = excerpt(para, maxParagraphChars)
+		}
+		if total+len(para) > maxPassageChars {
+			continue
+		}
+		total += len(para)
+		passages = append(passages, passage{
+			Label: fmt.Sprintf("%s%d", prefix, len(passages)+1),
+			Note:  note.Title,
+			Text:  para,
+		})
+	}
+	return passages
+}
+
+func generateLinkingContent(note1, note2 Note, rel string) (string, error) {
 	llm, err := openai.New()
 	if err != nil {
 		return "", fmt.Errorf("failed to create OpenAI client: %w", err)
 	}
 
-	prompt := fmt.Sprintf("Generate a short paragraph (3-5 sentences) explaining the connection between %s and %s.", concept1, concept2)
+	passages := append(notePassages(note1, "A"), notePassages(note2, "B")...)
+
+	var prompt strings.Builder
+	if rel != defaultRelation {
+		fmt.Fprintf(&prompt, "Write a short paragraph (3-5 sentences) explaining how %q %s %q.", note1.Title, strings.ReplaceAll(rel, "_", " "), note2.Title)
+	} else {
+		fmt.Fprintf(&prompt, "Write a short paragraph (3-5 sentences) explaining the connection between %q and %q.", note1.Title, note2.Title)
+	}
+	prompt.WriteString(" Base it on the passages from both notes below. After each claim, cite the passages it draws on by label in square brackets, such as [A1] or [B2]. Only cite passages you used.\n")
+	for _, note := range []Note{note1, note2} {
+		fmt.Fprintf(&prompt, "\nPassages from %q:\n", note.Title)
+		for _, p := range passages {
+			if p.Note == note.Title {
+				fmt.Fprintf(&prompt, "[%s] %s\n", p.Label, p.Text)
+			}
+		}
+	}
+
 	res, err := llm.GenerateContent(context.TODO(), []llms.MessageContent{
-		llms.TextParts(llms.ChatMessageTypeHuman, prompt),
+		llms.TextParts(llms.ChatMessageTypeHuman, prompt.String()),
 	})
 	if err != nil {
 		return "", fmt.Errorf("failed to generate content: %w", err)
 	}
 
-	return res.Choices[0].Content, err
+	return citePassages(strings.TrimSpace(res.Choices[0].Content), passages), nil
+}
+
+var citationPattern = regexp.MustCompile(`\[([AB]\d+)\]`)
+
+// citePassages turns [A1]-style citations into markdown footnotes quoting
+// the cited passage. Labels that match no passage are left as they are.
+func citePassages(text string, passages []passage) string {
+	byLabel := make(map[string]passage, len(passages))
+	for _, p := range passages {
+		byLabel[p.Label] = p
+	}
+
+	var cited []passage
+	footnote := func(p passage) string {
+		return fmt.Sprintf("%s-%s", noteKey(p.Note), strings.ToLower(p.Label[1:]))
+	}
+	text = citationPattern.ReplaceAllStringFunc(text, func(s string) string {
+		p, ok := byLabel[citationPattern.FindStringSubmatch(s)[1]]
+		if !ok {
+			return s
+		}
+		for _, c := range cited {
+			if c.Label == p.Label {
+				return "[^" + footnote(p) + "]"
+			}
+		}
+		cited = append(cited, p)
+		return "[^" + footnote(p) + "]"
+	})
+
+	if len(cited) == 0 {
+		return text
+	}
+	var out strings.Builder
+	out.WriteString(text)
+	out.WriteString("\n")
+	for _, p := range cited {
+		fmt.Fprintf(&out, "\n[^%s]: [[%s]]: %q", footnote(p), p.Note, excerpt(p.Text, 160))
+	}
+	return out.String()
+}
+
+// excerpt collapses whitespace in s and shortens it to at most n bytes,
+// at a word break where there is one and never inside a UTF-8 sequence.
+func excerpt(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) <= n {
+		return s
+	}
+	cut := strings.LastIndex(s[:n], " ")
+	if cut <= 0 {
+		cut = n
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+	}
+	return s[:cut] + "…"
+}
+
+// appendConnection adds an explanation of how the note at path relates to
+// target as a new section at the end of the note.
+func appendConnection(path, target, rel, content string) error {
+	existing, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	heading := "Connection to"
+	if rel != defaultRelation {
+		heading = strings.ReplaceAll(rel, "_", " ")
+		heading = strings.ToUpper(heading[:1]) + heading[1:]
+	}
+
+	updated := fmt.Sprintf("%s\n\n## %s [[%s]]\n\n%s\n", strings.TrimRight(string(existing), "\n"), heading, target, content)
+	return os.WriteFile(path, []byte(updated), 0644)
+}
+
+// reviewInEditor opens text in the user's editor and returns what was
+// saved, trimmed.
+func reviewInEditor(text string) (string, error) {
+	tempFile, err := os.CreateTemp("", "kg-review-*.md")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tempFile.Name())
+
+	if _, err := tempFile.WriteString(text + "\n"); err != nil {
+		tempFile.Close()
+		return "", fmt.Errorf("failed to write to temporary file: %w", err)
+	}
+	tempFile.Close()
+
+	if err := runEditor(tempFile.Name()); err != nil {
+		return "", err
+	}
+
+	edited, err := os.ReadFile(tempFile.Name())
+	if err != nil {
+		return "", fmt.Errorf("failed to read edited content: %w", err)
+	}
+	return strings.TrimSpace(string(edited)), nil
 }
 
 func createNewNote(path, title, content string, tags []string) error {
@@ -118,38 +356,3 @@ func createNewNote(path, title, content string, tags []string) error {
 
 	return nil
 }
-
-func updateFrontmatter(path, key, value string) error {
-	content, err := os.ReadFile(path)
-	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
-	}
-
-	parts := strings.SplitN(string(content), "---", 3)
-	if len(parts) != 3 {
-		return fmt.Errorf("invalid frontmatter format")
-	}
-
-	var frontmatter map[string]interface{}
-	if err := yaml.Unmarshal([]byte(parts[1]), &frontmatter); err != nil {
-		return fmt.Errorf("failed to unmarshal frontmatter: %w", err)
-	}
-
-	if existing, ok := frontmatter[key].([]string); ok {
-		frontmatter[key] = append(existing, value)
-	} else {
-		frontmatter[key] = []string{value}
-	}
-
-	updatedYaml, err := yaml.Marshal(frontmatter)
-	if err != nil {
-		return fmt.Errorf("failed to marshal updated frontmatter: %w", err)
-	}
-
-	updatedContent := fmt.Sprintf("---\n%s---\n%s", string(updatedYaml), parts[2])
-	if err := os.WriteFile(path, []byte(updatedContent), 0644); err != nil {
-		return fmt.Errorf("failed to write updated content: %w", err)
-	}
-
-	return nil
-}
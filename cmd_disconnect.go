@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func newDisconnectCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "disconnect [concept1] [concept2]",
+		Short: "Remove the relations between two notes",
+		Long: `Remove every relation between two notes, in both directions. With --rel,
+only that relation from concept1 to concept2 and its inverse are removed.
+Notes that were not related are left untouched.`,
+		Args:              cobra.ExactArgs(2),
+		ValidArgsFunction: completeNotes(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rel, _ := cmd.Flags().GetString("rel")
+			return disconnectConcepts(args[0], args[1], rel)
+		},
+	}
+
+	cmd.Flags().String("rel", "", "Only remove this relation type")
+
+	return cmd
+}
+
+func disconnectConcepts(concept1, concept2, rel string) error {
+	store, err := openEdgeStore(viper.GetString("notes_directory"))
+	if err != nil {
+		return err
+	}
+
+	note1, path1, err := store.Note(concept1)
+	if err != nil {
+		return err
+	}
+	note2, path2, err := store.Note(concept2)
+	if err != nil {
+		return err
+	}
+
+	changed, err := store.Remove(path1, rel, path2)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		fmt.Printf("%s and %s are not connected\n", note1.Title, note2.Title)
+		return nil
+	}
+
+	fmt.Printf("Disconnected %s and %s\n", note1.Title, note2.Title)
+	commitNotes(fmt.Sprintf("Disconnect %q and %q", note1.Title, note2.Title), path1, path2)
+	return nil
+}
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+func newDoctorCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the vault for problems",
+		Long: `Check every note for problems that make kg commands fail or give wrong
+results: missing or invalid frontmatter, duplicate titles, file names that
+do not match titles, relations to notes that do not exist or that are
+missing their inverse, orphan and empty notes, broken wikilinks and files
+that are not UTF-8.
+
+With --fix, problems that can be fixed safely are: missing titles and dates
+are filled in, files are renamed to match their titles, and missing inverse
+relations are added. The command fails if any errors remain.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format, _ := cmd.Flags().GetString("format")
+			fix, _ := cmd.Flags().GetBool("fix")
+			switch format {
+			case "text", "json", "sarif":
+			default:
+				return fmt.Errorf("unsupported format: %s. Use 'text', 'json' or 'sarif'", format)
+			}
+
+			errors, err := runDoctor(format, fix)
+			if err != nil {
+				return err
+			}
+			if errors > 0 {
+				cmd.SilenceUsage = true
+				return fmt.Errorf("%d errors found", errors)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("format", "o", "text", "Output format (text, json or sarif)")
+	cmd.Flags().Bool("fix", false, "Apply safe automatic fixes")
+
+	return cmd
+}
+
+// doctorCheck describes one kind of problem kg doctor looks for.
+type doctorCheck struct {
+	ID          string
+	Level       string
+	Description string
+}
+
+var doctorChecks = []doctorCheck{
+	{"non-utf8", "error", "File is not valid UTF-8"},
+	{"frontmatter-missing", "error", "Note has no frontmatter"},
+	{"frontmatter-invalid", "error", "Frontmatter is not valid YAML"},
+	{"title-missing", "error", "Frontmatter has no title"},
+	{"date-missing", "warning", "Frontmatter has no date"},
+	{"date-invalid", "warning", "Date is not in a recognized format"},
+	{"duplicate-title", "error", "Several notes have the same title"},
+	{"filename-mismatch", "warning", "File name does not match the title"},
+	{"dangling-relation", "warning", "Relation points to a note that does not exist"},
+	{"one-way-relation", "warning", "Relation is missing its inverse on the other note"},
+	{"broken-link", "warning", "Wikilink points to a note that does not exist"},
+	{"empty-note", "warning", "Note has no content"},
+	{"orphan", "note", "Note has no relations or links"},
+}
+
+// doctorFinding is one problem found in the vault. fix, when set, repairs
+// it.
+type doctorFinding struct {
+	Check   string `json:"check"`
+	Level   string `json:"level"`
+	Path    string `json:"path"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+	Fixable bool   `json:"fixable"`
+
+	// fix repairs the problem; fixes run in ascending order, so that files
+	// are renamed only after their contents have been fixed. touches are
+	// the files fix writes, renames or removes, for committing them.
+	fix     func() error
+	order   int
+	touches []string
+}
+
+// runDoctor checks the vault, fixing what it can if asked, prints what
+// remains and returns the number of errors.
+func runDoctor(format string, fix bool) (int, error) {
+	notesDir := viper.GetString("notes_directory")
+	if notesDir == "" {
+		return 0, fmt.Errorf("notes directory not set in config")
+	}
+
+	findings, err := diagnoseVault(notesDir)
+	if err != nil {
+		return 0, err
+	}
+
+	// A fix can reveal problems it hides, such as a file name that does not
+	// match a title that was missing, so fix until nothing more can be.
+	for pass := 0; fix && pass < 3; pass++ {
+		var fixable []doctorFinding
+		for _, f := range findings {
+			if f.fix != nil {
+				fixable = append(fixable, f)
+			}
+		}
+		if len(fixable) == 0 {
+			break
+		}
+		sort.SliceStable(fixable, func(i, j int) bool { return fixable[i].order < fixable[j].order })
+
+		fixed := 0
+		var touched []string
+		for _, f := range fixable {
+			if err := f.fix(); err != nil {
+				fmt.Fprintf(os.Stderr, "Could not fix %s: %s: %v\n", f.Path, f.Message, err)
+				continue
+			}
+			fixed++
+			for _, path := range f.touches {
+				if !containsString(touched, path) {
+					touched = append(touched, path)
+				}
+			}
+			if format == "text" {
+				fmt.Printf("Fixed %s: %s\n", f.Path, f.Message)
+			}
+		}
+		if fixed > 0 {
+			commitNotes(fmt.Sprintf("Fix %d problems found by kg doctor", fixed), touched...)
+		}
+		if findings, err = diagnoseVault(notesDir); err != nil {
+			return 0, err
+		}
+		if fixed == 0 {
+			break
+		}
+	}
+
+	errors := 0
+	for _, f := range findings {
+		if f.Level == "error" {
+			errors++
+		}
+	}
+
+	switch format {
+	case "json":
+		if findings == nil {
+			findings = []doctorFinding{}
+		}
+		data, err := json.MarshalIndent(findings, "", "  ")
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode findings: %w", err)
+		}
+		fmt.Println(string(data))
+	case "sarif":
+		data, err := json.MarshalIndent(sarifReport(findings), "", "  ")
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode findings: %w", err)
+		}
+		fmt.Println(string(data))
+	default:
+		printFindings(findings)
+	}
+	return errors, nil
+}
+
+// diagnoseVault runs every check over the notes in notesDir.
+func diagnoseVault(notesDir string) ([]doctorFinding, error) {
+	var findings []doctorFinding
+	// Fixes touch the note the finding is about unless they name the files
+	// they touch.
+	add := func(check, path string, line int, message string, fix func() error, order int, touches ...string) {
+		if fix != nil && len(touches) == 0 {
+			touches = []string{filepath.Join(notesDir, path)}
+		}
+		f := doctorFinding{Check: check, Path: path, Line: line, Message: message, fix: fix, order: order, Fixable: fix != nil, touches: touches}
+		for _, c := range doctorChecks {
+			if c.ID == check {
+				f.Level = c.Level
+			}
+		}
+		findings = append(findings, f)
+	}
+
+	var notes []Note
+	var paths []string
+	err := filepath.Walk(notesDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".md") {
+			return nil
+		}
+		rel, err := filepath.Rel(notesDir, path)
+		if err != nil {
+			return err
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", rel, err)
+		}
+		if !utf8.Valid(data) {
+			add("non-utf8", rel, 0, "file is not valid UTF-8", nil, 0)
+			return nil
+		}
+		content := string(data)
+		modDate := info.ModTime().Format("2006-01-02")
+
+		if !strings.HasPrefix(content, "---") {
+			add("frontmatter-missing", rel, 1, "note has no frontmatter", func() error {
+				frontmatter := map[string]interface{}{"title": titleFromFilename(path), "date": modDate}
+				yamlData, err := encodeFrontmatter(frontmatter)
+				if err != nil {
+					return err
+				}
+				return os.WriteFile(path, []byte(fmt.Sprintf("---\n%s---\n\n%s", yamlData, content)), 0644)
+			}, 0)
+			return nil
+		}
+		frontmatter, _, err := parseFrontmatter(content)
+		if err != nil {
+			add("frontmatter-invalid", rel, 1, err.Error(), nil, 0)
+			return nil
+		}
+		if frontmatter == nil {
+			frontmatter = map[string]interface{}{}
+		}
+
+		if title, ok := frontmatter["title"].(string); !ok || strings.TrimSpace(title) == "" {
+			title := titleFromFilename(path)
+			if v, ok := frontmatter["title"]; ok && v != nil && fmt.Sprint(v) != "" {
+				title = fmt.Sprint(v)
+			}
+			add("title-missing", rel, 1, fmt.Sprintf("frontmatter has no title; it could be '%s'", title),
+				setFrontmatterFix(path, "title", title), 0)
+			return nil
+		}
+
+		switch date := frontmatter["date"].(type) {
+		case nil:
+			add("date-missing", rel, 1, "frontmatter has no date", setFrontmatterFix(path, "date", modDate), 0)
+		case time.Time:
+		case string:
+			if _, err := time.Parse("2006-01-02", date); err != nil {
+				var fix func() error
+				for _, layout := range dateLayouts {
+					if t, err := time.Parse(layout, strings.TrimSpace(date)); err == nil {
+						fix = setFrontmatterFix(path, "date", t.Format("2006-01-02"))
+						break
+					}
+				}
+				add("date-invalid", rel, 1, fmt.Sprintf("date '%s' is not in YYYY-MM-DD form", date), fix, 0)
+			}
+		default:
+			add("date-invalid", rel, 1, fmt.Sprintf("date '%v' is not a date", date), nil, 0)
+		}
+
+		note, err := parseNote(path)
+		if err != nil {
+			add("frontmatter-invalid", rel, 1, err.Error(), nil, 0)
+			return nil
+		}
+		notes = append(notes, note)
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk notes directory: %w", err)
+	}
+
+	relPath := func(i int) string {
+		rel, _ := filepath.Rel(notesDir, paths[i])
+		return rel
+	}
+	vocab := relationVocabularyFromConfig()
+	index := buildNoteIndex(notes)
+	// Fixes share one store over the notes that parsed, so that notes kg
+	// cannot read do not stop the others from being fixed.
+	store := &edgeStore{dir: notesDir, vocab: vocab, notes: notes, paths: paths, index: index}
+
+	byTitle := make(map[string][]int)
+	for i, note := range notes {
+		byTitle[noteKey(note.Title)] = append(byTitle[noteKey(note.Title)], i)
+	}
+
+	linked := make([]bool, len(notes))
+	referenced := make(map[string]bool)
+	for i, note := range notes {
+		rel := relPath(i)
+
+		if dups := byTitle[noteKey(note.Title)]; len(dups) > 1 {
+			var others []string
+			for _, j := range dups {
+				if j != i {
+					others = append(others, relPath(j))
+				}
+			}
+			add("duplicate-title", rel, 1, fmt.Sprintf("title '%s' is also used by %s", note.Title, strings.Join(others, ", ")), nil, 0)
+		}
+
+		if strings.TrimSpace(note.Content) == "" {
+			add("empty-note", rel, 0, "note has no content", nil, 0)
+		}
+
+		for _, r := range note.Relations {
+			j, ok := index[noteKey(r.Target)]
+			if !ok {
+				add("dangling-relation", rel, frontmatterLine(paths[i], r.Target),
+					fmt.Sprintf("%s target '%s' does not exist", r.Type, r.Target), nil, 0)
+				continue
+			}
+			linked[i], linked[j] = true, true
+			referenced[noteKey(r.Target)] = true
+			inverse := vocab.Inverse(r.Type)
+			if inverse == "" || j == i {
+				continue
+			}
+			hasInverse := false
+			for _, back := range notes[j].Relations {
+				if back.Type == inverse && index[noteKey(back.Target)] == i {
+					hasInverse = true
+					break
+				}
+			}
+			if !hasInverse {
+				source, t, target := paths[i], r.Type, paths[j]
+				add("one-way-relation", rel, frontmatterLine(paths[i], r.Target),
+					fmt.Sprintf("%s '%s' has no %s back to this note", t, notes[j].Title, inverse),
+					func() error {
+						_, err := store.Add(source, t, target)
+						return err
+					}, 1, source, target)
+			}
+		}
+
+		for n, line := range strings.Split(note.Content, "\n") {
+			for _, link := range extractWikilinks(line) {
+				if link.Target == "" {
+					continue
+				}
+				j, ok := index[noteKey(link.Target)]
+				if !ok {
+					add("broken-link", rel, bodyLine(paths[i], n), fmt.Sprintf("link to '%s' does not match any note", link.Target), nil, 0)
+					continue
+				}
+				linked[i], linked[j] = true, true
+				referenced[noteKey(link.Target)] = true
+			}
+		}
+	}
+
+	for i, note := range notes {
+		want := generateFilename(note.Title)
+		if want == note.Filename || len(byTitle[noteKey(note.Title)]) > 1 {
+			continue
+		}
+		// Renaming is only safe when nothing refers to the note by its
+		// current file name, and no other file has the new one.
+		var fix func() error
+		from, target := paths[i], filepath.Join(filepath.Dir(paths[i]), want)
+		if _, err := os.Stat(target); os.IsNotExist(err) && !referenced[noteKey(note.Filename)] {
+			fix = func() error { return os.Rename(from, target) }
+		}
+		add("filename-mismatch", relPath(i), 0, fmt.Sprintf("file name for title '%s' should be %s", note.Title, want), fix, 2, from, target)
+	}
+	for i := range notes {
+		if !linked[i] {
+			add("orphan", relPath(i), 0, "note has no relations or links", nil, 0)
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Path != findings[j].Path {
+			return findings[i].Path < findings[j].Path
+		}
+		return findings[i].Line < findings[j].Line
+	})
+	return findings, nil
+}
+
+// setFrontmatterFix returns a fix that sets a frontmatter field.
+func setFrontmatterFix(path, key, value string) func() error {
+	return func() error {
+		_, _, err := updateFileField(path, frontmatterEdit{
+			Op:     "set",
+			Key:    key,
+			Values: []*yaml.Node{{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}},
+		}, false)
+		return err
+	}
+}
+
+// titleFromFilename guesses a title from a note's file name.
+func titleFromFilename(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), ".md")
+	words := strings.Fields(strings.NewReplacer("-", " ", "_", " ").Replace(name))
+	for i, w := range words {
+		r, size := utf8.DecodeRuneInString(w)
+		words[i] = string(unicode.ToUpper(r)) + w[size:]
+	}
+	return strings.Join(words, " ")
+}
+
+// frontmatterLine returns the line of the note at path on which value
+// first appears within the frontmatter, or 1.
+func frontmatterLine(path, value string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 1
+	}
+	lines := strings.Split(string(data), "\n")
+	for i := 1; i < len(lines) && !strings.HasPrefix(lines[i], "---"); i++ {
+		if strings.Contains(lines[i], value) {
+			return i + 1
+		}
+	}
+	return 1
+}
+
+// bodyLine converts a line index within a note's trimmed content to a line
+// number in the file.
+func bodyLine(path string, n int) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	parts := strings.SplitN(string(data), "---", 3)
+	if len(parts) != 3 {
+		return 0
+	}
+	header := strings.Count(parts[0]+"---"+parts[1]+"---", "\n")
+	leading := len(parts[2]) - len(strings.TrimLeft(parts[2], " \t\r\n"))
+	return header + strings.Count(parts[2][:leading], "\n") + n + 1
+}
+
+func printFindings(findings []doctorFinding) {
+	if len(findings) == 0 {
+		fmt.Println("No problems found")
+		return
+	}
+
+	counts := make(map[string]int)
+	for _, f := range findings {
+		location := f.Path
+		if f.Line > 0 {
+			location = fmt.Sprintf("%s:%d", f.Path, f.Line)
+		}
+		fixable := ""
+		if f.Fixable {
+			fixable = " (fixable)"
+		}
+		fmt.Printf("%s: %s: %s [%s]%s\n", location, f.Level, f.Message, f.Check, fixable)
+		counts[f.Level]++
+	}
+	fmt.Printf("\n%d errors, %d warnings, %d notes\n", counts["error"], counts["warning"], counts["note"])
+}
+
+// sarifReport converts findings to a SARIF 2.1.0 log, for code scanning
+// tools.
+func sarifReport(findings []doctorFinding) map[string]interface{} {
+	rules := make([]map[string]interface{}, 0, len(doctorChecks))
+	for _, c := range doctorChecks {
+		rules = append(rules, map[string]interface{}{
+			"id":                   c.ID,
+			"shortDescription":     map[string]string{"text": c.Description},
+			"defaultConfiguration": map[string]string{"level": c.Level},
+		})
+	}
+
+	results := make([]map[string]interface{}, 0, len(findings))
+	for _, f := range findings {
+		location := map[string]interface{}{
+			"artifactLocation": map[string]string{"uri": filepath.ToSlash(f.Path)},
+		}
+		if f.Line > 0 {
+			location["region"] = map[string]int{"startLine": f.Line}
+		}
+		results = append(results, map[string]interface{}{
+			"ruleId":    f.Check,
+			"level":     f.Level,
+			"message":   map[string]string{"text": f.Message},
+			"locations": []map[string]interface{}{{"physicalLocation": location}},
+		})
+	}
+
+	return map[string]interface{}{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs": []map[string]interface{}{{
+			"tool": map[string]interface{}{
+				"driver": map[string]interface{}{
+					"name":           "kg doctor",
+					"informationUri": "https://github.com/tmc/kg",
+					"rules":          rules,
+				},
+			},
+			"results": results,
+		}},
+	}
+}
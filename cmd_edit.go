@@ -15,9 +15,10 @@ import (
 
 func newEditCmd() *cobra.Command {
 	return &cobra.Command{
-		Use:   "edit [title]",
-		Short: "Modify existing notes, preserving frontmatter",
-		Args:  cobra.ExactArgs(1),
+		Use:               "edit [title]",
+		Short:             "Modify existing notes, preserving frontmatter",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeNotes(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return editNote(args[0])
 		},
@@ -34,11 +35,26 @@ func editNote(title string) error {
 	filename := generateFilename(title)
 	filePath := filepath.Join(notesDir, filename)
 
-	// Check if the file exists
+	// Fall back to resolving the title against the vault when it does not
+	// name a file directly
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return fmt.Errorf("note '%s' does not exist", title)
+		store, err := openEdgeStore(notesDir)
+		if err != nil {
+			return err
+		}
+		note, path, err := store.Note(title)
+		if err != nil {
+			return err
+		}
+		filePath, title = path, note.Title
 	}
 
+	return editNoteFile(filePath, title)
+}
+
+// editNoteFile opens the note at filePath in the editor through a temporary
+// copy, and saves the edit if its frontmatter is still valid.
+func editNoteFile(filePath, title string) error {
 	// Load existing note content
 	content, err := ioutil.ReadFile(filePath)
 	if err != nil {
@@ -62,28 +78,16 @@ func editNote(title string) error {
 	defer os.Remove(tempFile.Name())
 
 	// Write the content to the temporary file
-	_, err = tempFile.WriteString(fmt.Sprintf("---\n%s---\n%s", frontmatter, body))
+	// frontmatter and body keep the newlines that followed each "---".
+	_, err = tempFile.WriteString(fmt.Sprintf("---%s---%s", frontmatter, body))
 	if err != nil {
 		return fmt.Errorf("failed to write to temporary file: %w", err)
 	}
 	tempFile.Close()
 
 	// Open the note in the user's preferred editor
-	editor := viper.GetString("editor")
-	if editor == "" {
-		editor = os.Getenv("EDITOR")
-	}
-	if editor == "" {
-		editor = "nano" // Default to nano if no editor is specified
-	}
-
-	cmd := exec.Command(editor, tempFile.Name())
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err = cmd.Run()
-	if err != nil {
-		return fmt.Errorf("failed to run editor: %w", err)
+	if err := runEditor(tempFile.Name()); err != nil {
+		return err
 	}
 
 	// Read the edited content
@@ -119,5 +123,27 @@ func editNote(title string) error {
 	}
 
 	fmt.Printf("Note '%s' updated successfully\n", title)
+	commitNotes(fmt.Sprintf("Edit note %q", title), filePath)
+	return nil
+}
+
+// runEditor opens path in the configured editor, then $EDITOR, then nano,
+// and waits for it to exit.
+func runEditor(path string) error {
+	editor := viper.GetString("editor")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "nano" // Default to nano if no editor is specified
+	}
+
+	cmd := exec.Command(editor, path)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to run editor: %w", err)
+	}
 	return nil
 }
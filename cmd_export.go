@@ -4,7 +4,10 @@ import (
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -13,111 +16,320 @@ import (
 )
 
 func newExportCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "export [format]",
-		Short: "Output to JSON/CSV, including frontmatter",
-		Long:  `Export the knowledge graph to JSON or CSV format, including all frontmatter data.`,
-		Args:  cobra.ExactArgs(1),
+		Short: "Output to JSON/JSONL/CSV, including frontmatter",
+		Long: `Export the knowledge graph to JSON, JSONL or CSV format, including all frontmatter data.
+
+Use -o to choose where the export is written, or "-" for stdout. JSONL output
+is streamed one note per line, so large vaults are never held in memory.
+CSV exports write nodes to the output path and edges to a sibling
+"_edges.csv" file unless --edges-output says otherwise.`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			format := strings.ToLower(args[0])
-			if format != "json" && format != "csv" {
-				return fmt.Errorf("unsupported format: %s. Use 'json' or 'csv'", format)
+			if format != "json" && format != "jsonl" && format != "csv" {
+				return fmt.Errorf("unsupported format: %s. Use 'json', 'jsonl' or 'csv'", format)
 			}
-			return exportGraph(format)
+
+			output, _ := cmd.Flags().GetString("output")
+			edgesOutput, _ := cmd.Flags().GetString("edges-output")
+			filter, _ := cmd.Flags().GetString("filter")
+			fields, _ := cmd.Flags().GetStringSlice("fields")
+			includeContent, _ := cmd.Flags().GetBool("include-content")
+
+			return exportGraph(format, exportOptions{
+				Output:         output,
+				EdgesOutput:    edgesOutput,
+				Filter:         parseNoteQuery(filter),
+				Fields:         fields,
+				IncludeContent: includeContent,
+			})
 		},
 	}
+
+	cmd.Flags().StringP("output", "o", "", "Output file, or - for stdout")
+	cmd.Flags().String("edges-output", "", "Output file for CSV edges")
+	cmd.Flags().String("filter", "", "Only export notes matching a search query")
+	cmd.Flags().StringSlice("fields", nil, "Frontmatter fields to export (default all)")
+	cmd.Flags().Bool("include-content", true, "Include note content in the export")
+
+	return cmd
 }
 
 type Note struct {
 	Title       string                 `json:"title"`
 	Filename    string                 `json:"filename"`
 	Frontmatter map[string]interface{} `json:"frontmatter"`
-	Content     string                 `json:"content"`
+	Content     string                 `json:"content,omitempty"`
 	Connections []string               `json:"connections"`
+	Relations   []Relation             `json:"relations"`
 
 	Tags []string  `json:"tags"`
 	Date time.Time `json:"date"`
 }
 
-func exportGraph(format string) error {
+type exportOptions struct {
+	Output         string
+	EdgesOutput    string
+	Filter         noteQuery
+	Fields         []string
+	IncludeContent bool
+}
+
+func exportGraph(format string, opts exportOptions) error {
 	notesDir := viper.GetString("notes_directory")
 	if notesDir == "" {
 		return fmt.Errorf("notes directory not set in config")
 	}
 
+	if format == "jsonl" {
+		return exportJSONL(notesDir, opts)
+	}
+
 	notes, err := loadNotes(notesDir)
 	if err != nil {
 		return fmt.Errorf("failed to load notes: %w", err)
 	}
 
+	var selected []Note
+	for _, note := range notes {
+		if opts.Filter.Match(note) {
+			selected = append(selected, opts.project(note))
+		}
+	}
+
 	if format == "json" {
-		return exportJSON(notes)
+		return exportJSON(selected, opts)
 	} else {
-		return exportCSV(notes)
+		return exportCSV(selected, opts)
+	}
+}
+
+// project trims a note down to the requested fields and content.
+func (opts exportOptions) project(note Note) Note {
+	if len(opts.Fields) > 0 {
+		frontmatter := make(map[string]interface{}, len(opts.Fields))
+		for _, field := range opts.Fields {
+			if value, ok := note.Frontmatter[field]; ok {
+				frontmatter[field] = value
+			}
+		}
+		note.Frontmatter = frontmatter
+	}
+	if !opts.IncludeContent {
+		note.Content = ""
+	}
+	return note
+}
+
+// openExportOutput opens path for writing, treating "-" as stdout. The
+// returned close function is safe to call for stdout.
+func openExportOutput(path string) (io.Writer, func() error, error) {
+	if path == "-" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
 	}
+	return file, file.Close, nil
 }
 
-func exportJSON(notes []Note) error {
+// reportExport prints where an export went. Nothing is printed when the
+// export itself went to stdout, to keep piped output clean.
+func reportExport(paths ...string) {
+	var files []string
+	for _, path := range paths {
+		if path != "" && path != "-" {
+			files = append(files, path)
+		}
+	}
+	if len(files) > 0 {
+		fmt.Fprintf(os.Stderr, "Exported knowledge graph to %s\n", strings.Join(files, " and "))
+	}
+}
+
+func exportJSON(notes []Note, opts exportOptions) error {
+	output := opts.Output
+	if output == "" {
+		output = "knowledge_graph_export.json"
+	}
+
 	jsonData, err := json.MarshalIndent(notes, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal notes to JSON: %w", err)
 	}
 
-	if err := os.WriteFile("knowledge_graph_export.json", jsonData, 0644); err != nil {
+	w, closeOutput, err := openExportOutput(output)
+	if err != nil {
+		return fmt.Errorf("failed to create JSON file: %w", err)
+	}
+	defer closeOutput()
+
+	if _, err := w.Write(append(jsonData, '\n')); err != nil {
+		return fmt.Errorf("failed to write JSON file: %w", err)
+	}
+	if err := closeOutput(); err != nil {
 		return fmt.Errorf("failed to write JSON file: %w", err)
 	}
 
-	fmt.Println("Exported knowledge graph to knowledge_graph_export.json")
+	reportExport(output)
 	return nil
 }
 
-func exportCSV(notes []Note) error {
-	nodesFile, err := os.Create("knowledge_graph_nodes.csv")
+func exportJSONL(notesDir string, opts exportOptions) error {
+	output := opts.Output
+	if output == "" {
+		output = "knowledge_graph_export.jsonl"
+	}
+
+	w, closeOutput, err := openExportOutput(output)
 	if err != nil {
-		return fmt.Errorf("failed to create nodes CSV file: %w", err)
+		return fmt.Errorf("failed to create JSONL file: %w", err)
 	}
-	defer nodesFile.Close()
+	defer closeOutput()
 
-	edgesFile, err := os.Create("knowledge_graph_edges.csv")
+	encoder := json.NewEncoder(w)
+	err = walkNotes(notesDir, func(path string, note Note) error {
+		if !opts.Filter.Match(note) {
+			return nil
+		}
+		return encoder.Encode(opts.project(note))
+	})
 	if err != nil {
-		return fmt.Errorf("failed to create edges CSV file: %w", err)
+		return fmt.Errorf("failed to write JSONL export: %w", err)
+	}
+	if err := closeOutput(); err != nil {
+		return fmt.Errorf("failed to write JSONL file: %w", err)
 	}
-	defer edgesFile.Close()
 
-	nodesWriter := csv.NewWriter(nodesFile)
-	edgesWriter := csv.NewWriter(edgesFile)
+	reportExport(output)
+	return nil
+}
+
+func exportCSV(notes []Note, opts exportOptions) error {
+	nodesPath := opts.Output
+	if nodesPath == "" {
+		nodesPath = "knowledge_graph_nodes.csv"
+	}
+	edgesPath := opts.EdgesOutput
+	if edgesPath == "" {
+		switch {
+		case opts.Output == "":
+			edgesPath = "knowledge_graph_edges.csv"
+		case opts.Output != "-":
+			edgesPath = strings.TrimSuffix(nodesPath, filepath.Ext(nodesPath)) + "_edges.csv"
+		}
+	}
+
+	nodesOut, closeNodes, err := openExportOutput(nodesPath)
+	if err != nil {
+		return fmt.Errorf("failed to create nodes CSV file: %w", err)
+	}
+	defer closeNodes()
+
+	nodesWriter := csv.NewWriter(nodesOut)
 
 	// Write headers
-	nodesWriter.Write([]string{"ID", "Title", "Filename", "Tags", "Date", "LastMod"})
-	edgesWriter.Write([]string{"Source", "Target"})
+	columns := opts.Fields
+	if len(columns) == 0 {
+		columns = frontmatterKeys(notes)
+	}
+	header := []string{"ID", "Title", "Filename"}
+	header = append(header, columns...)
+	if opts.IncludeContent {
+		header = append(header, "Content")
+	}
+	nodesWriter.Write(header)
 
 	for _, note := range notes {
-		// Write node
-		nodesWriter.Write([]string{
-			note.Filename,
-			note.Title,
-			note.Filename,
-			strings.Join(note.Frontmatter["tags"].([]string), "|"),
-			note.Frontmatter["date"].(string),
-			note.Frontmatter["lastmod"].(string),
-		})
-
-		// Write edges
-		for _, connection := range note.Connections {
-			edgesWriter.Write([]string{note.Filename, connection})
+		record := []string{note.Filename, note.Title, note.Filename}
+		for _, column := range columns {
+			record = append(record, formatFieldValue(note.Frontmatter[column]))
+		}
+		if opts.IncludeContent {
+			record = append(record, note.Content)
 		}
+		nodesWriter.Write(record)
 	}
 
 	nodesWriter.Flush()
-	edgesWriter.Flush()
-
 	if err := nodesWriter.Error(); err != nil {
 		return fmt.Errorf("error writing nodes CSV: %w", err)
 	}
+	if err := closeNodes(); err != nil {
+		return fmt.Errorf("error writing nodes CSV: %w", err)
+	}
+
+	if edgesPath == "" {
+		reportExport(nodesPath)
+		return nil
+	}
+
+	edgesOut, closeEdges, err := openExportOutput(edgesPath)
+	if err != nil {
+		return fmt.Errorf("failed to create edges CSV file: %w", err)
+	}
+	defer closeEdges()
+
+	edgesWriter := csv.NewWriter(edgesOut)
+	edgesWriter.Write([]string{"Source", "Target", "Type"})
+	for _, note := range notes {
+		for _, relation := range note.Relations {
+			edgesWriter.Write([]string{note.Filename, relation.Target, relation.Type})
+		}
+	}
+
+	edgesWriter.Flush()
 	if err := edgesWriter.Error(); err != nil {
 		return fmt.Errorf("error writing edges CSV: %w", err)
 	}
+	if err := closeEdges(); err != nil {
+		return fmt.Errorf("error writing edges CSV: %w", err)
+	}
 
-	fmt.Println("Exported knowledge graph to knowledge_graph_nodes.csv and knowledge_graph_edges.csv")
+	reportExport(nodesPath, edgesPath)
 	return nil
 }
+
+// frontmatterKeys returns every frontmatter key used across notes, sorted,
+// leaving out title since it already has its own column.
+func frontmatterKeys(notes []Note) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, note := range notes {
+		for key := range note.Frontmatter {
+			if key == "title" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatFieldValue renders a frontmatter value as a single CSV cell. Lists
+// are joined with "|" and nested maps are encoded as JSON.
+func formatFieldValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format("2006-01-02")
+	case []interface{}, []string:
+		return strings.Join(stringList(v), "|")
+	case map[string]interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -29,143 +31,445 @@ func newFrontmatterCmd() *cobra.Command {
 }
 
 func newFrontmatterNormalizeCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "normalize",
 		Short: "Normalize frontmatter across all notes",
+		Long: `Apply the normalization rules to the frontmatter of every note, rewriting
+only the notes that change. The rules to run, and their order, are set with
+normalize.rules in the config file; by default all rules run. Use
+--list-rules to see them.
+
+With --check nothing is written: the changes are printed as a diff and the
+command fails if any note is not normalized, for use in pre-commit hooks.`,
+		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return normalizeFrontmatter()
+			listRules, _ := cmd.Flags().GetBool("list-rules")
+			if listRules {
+				return listNormalizeRules()
+			}
+			check, _ := cmd.Flags().GetBool("check")
+			rules, _ := cmd.Flags().GetStringSlice("rules")
+
+			changed, err := normalizeFrontmatter(check, rules)
+			if err != nil {
+				return err
+			}
+			if check && len(changed) > 0 {
+				cmd.SilenceUsage = true
+				return fmt.Errorf("%d notes need normalizing; run 'kg frontmatter normalize'", len(changed))
+			}
+			if !check {
+				commitNotes("Normalize frontmatter", changed...)
+			}
+			return nil
 		},
 	}
+
+	cmd.Flags().Bool("check", false, "Print a diff and fail if any note would change, without writing")
+	cmd.Flags().StringSlice("rules", nil, "Rules to run instead of the configured ones")
+	cmd.Flags().Bool("list-rules", false, "List the available rules")
+
+	return cmd
 }
 
 func newFrontmatterUpdateCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "update [node] [key] [value]",
-		Short: "Bulk update a frontmatter field across all notes",
-		Args:  cobra.ExactArgs(3),
+		Use:   "update [set|unset|append|remove] [key] [value...]",
+		Short: "Bulk update a frontmatter field across notes",
+		Long: `Change a frontmatter field in every note matching the selectors:
+
+  set key value...     set key, to a list if several values are given
+  unset key            remove key
+  append key value...  add values to the list in key, if not already present
+  remove key value...  remove values from the list in key
+
+Notes are selected with --where, a search query such as "tag:go -draft",
+--path, a glob relative to the notes directory, and --field, a predicate on
+a frontmatter field: key=value, key!=value, key>value, key>=value,
+key<value, key<=value, key~substring, key (present) or !key (missing).
+Selectors combine with AND; with none, every note is updated.
+
+Values are typed: true and false become booleans, numbers become numbers,
+and [a, b] becomes a list. Use --type to force string, bool, int, float,
+date (written in date_format) or list (comma separated).
+
+The changes are shown as a diff and applied, to every note or none, once
+confirmed.`,
+		Args: cobra.MinimumNArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return updateFrontmatter(args[1], args[2], args[3])
+			where, _ := cmd.Flags().GetString("where")
+			paths, _ := cmd.Flags().GetStringArray("path")
+			fields, _ := cmd.Flags().GetStringArray("field")
+			valueType, _ := cmd.Flags().GetString("type")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			yes, _ := cmd.Flags().GetBool("yes")
+
+			edit, err := parseFrontmatterEdit(args[0], args[1], args[2:], valueType)
+			if err != nil {
+				return err
+			}
+			selector, err := parseNoteSelector(where, paths, fields)
+			if err != nil {
+				return err
+			}
+			return bulkUpdateFrontmatter(selector, edit, dryRun, yes)
 		},
 	}
 
+	cmd.Flags().StringP("where", "w", "", "Only update notes matching this search query")
+	cmd.Flags().StringArray("path", nil, "Only update notes whose path matches this glob (repeatable)")
+	cmd.Flags().StringArrayP("field", "f", nil, "Only update notes matching this field predicate (repeatable)")
+	cmd.Flags().StringP("type", "t", "auto", "Value type (auto, string, bool, int, float, date or list)")
+	cmd.Flags().Bool("dry-run", false, "Show the diff without writing")
+	cmd.Flags().BoolP("yes", "y", false, "Do not ask for confirmation")
+
 	return cmd
 }
 
-func normalizeFrontmatter() error {
+// bulkUpdateFrontmatter applies edit to every selected note, after showing
+// the changes and asking for confirmation.
+func bulkUpdateFrontmatter(selector noteSelector, edit frontmatterEdit, dryRun, yes bool) error {
 	notesDir := viper.GetString("notes_directory")
 	if notesDir == "" {
 		return fmt.Errorf("notes directory not set in config")
 	}
 
-	return filepath.Walk(notesDir, func(path string, info os.FileInfo, err error) error {
+	files := make(map[string][]byte)
+	var paths []string
+	err := walkNotes(notesDir, func(path string, note Note) error {
+		rel, err := filepath.Rel(notesDir, path)
+		if err != nil {
+			return err
+		}
+		if !selector.Match(rel, note) {
+			return nil
+		}
+		before, after, err := updateFileField(path, edit, true)
+		if err != nil {
+			return fmt.Errorf("failed to update %s: %w", rel, err)
+		}
+		if before == after {
+			return nil
+		}
+		fmt.Print(unifiedDiff(before, after, "a/"+rel, "b/"+rel))
+		files[path] = []byte(after)
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		fmt.Println("No notes changed")
+		return nil
+	}
+	if dryRun {
+		fmt.Printf("Would update %d notes\n", len(files))
+		return nil
+	}
+	if !yes {
+		fmt.Printf("Update %d notes? [y/N]: ", len(files))
+		input, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if answer := strings.ToLower(strings.TrimSpace(input)); answer != "y" && answer != "yes" {
+			return nil
+		}
+	}
+
+	if err := writeFilesAtomic(files); err != nil {
+		return fmt.Errorf("failed to update notes: %w", err)
+	}
+	commitNotes(fmt.Sprintf("Update frontmatter %s (%s) in %d notes", edit.Key, edit.Op, len(paths)), paths...)
+	fmt.Printf("Updated %d notes\n", len(files))
+	return nil
+}
+
+// normalizeFrontmatter normalizes every note and returns the paths of the
+// notes that changed, or with check set, would change.
+func normalizeFrontmatter(check bool, ruleNames []string) ([]string, error) {
+	notesDir := viper.GetString("notes_directory")
+	if notesDir == "" {
+		return nil, fmt.Errorf("notes directory not set in config")
+	}
+
+	cfg, err := normalizeConfigFromViper()
+	if err != nil {
+		return nil, err
+	}
+	if len(ruleNames) > 0 {
+		if cfg.Rules, err = lookupNormalizeRules(ruleNames); err != nil {
+			return nil, err
+		}
+	}
+
+	var changed []string
+	err = filepath.Walk(notesDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
 		if !info.IsDir() && strings.HasSuffix(info.Name(), ".md") {
-			if err := normalizeFile(path); err != nil {
+			fileChanged, err := normalizeFile(notesDir, path, cfg, check)
+			if err != nil {
 				return fmt.Errorf("failed to normalize %s: %w", path, err)
 			}
+			if fileChanged {
+				changed = append(changed, path)
+			}
 		}
 
 		return nil
 	})
+	return changed, err
 }
 
-func normalizeFile(path string) error {
-	content, err := ioutil.ReadFile(path)
+func normalizeFile(notesDir, path string, cfg normalizeConfig, check bool) (bool, error) {
+	content, err := os.ReadFile(path)
 	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
+		return false, fmt.Errorf("failed to read file: %w", err)
 	}
 
-	parts := strings.SplitN(string(content), "---", 3)
-	if len(parts) != 3 {
-		return fmt.Errorf("invalid frontmatter format")
+	normalized, err := normalizeContent(string(content), cfg)
+	if err != nil {
+		return false, err
+	}
+	if normalized == string(content) {
+		return false, nil
 	}
 
-	var frontmatter map[string]interface{}
-	if err := yaml.Unmarshal([]byte(parts[1]), &frontmatter); err != nil {
-		return fmt.Errorf("failed to parse frontmatter: %w", err)
+	if check {
+		rel, err := filepath.Rel(notesDir, path)
+		if err != nil {
+			rel = path
+		}
+		fmt.Print(unifiedDiff(string(content), normalized, "a/"+rel, "b/"+rel))
+		return true, nil
 	}
 
-	// Apply normalization rules
-	frontmatter = normalizeFields(frontmatter)
+	if err := os.WriteFile(path, []byte(normalized), 0644); err != nil {
+		return false, fmt.Errorf("failed to write normalized content: %w", err)
+	}
 
-	// Marshal the normalized frontmatter
-	normalizedYaml, err := yaml.Marshal(frontmatter)
+	fmt.Printf("Normalized frontmatter in %s\n", path)
+	return true, nil
+}
+
+func listNormalizeRules() error {
+	cfg, err := normalizeConfigFromViper()
 	if err != nil {
-		return fmt.Errorf("failed to marshal normalized frontmatter: %w", err)
+		return err
+	}
+	enabled := make(map[string]bool, len(cfg.Rules))
+	for _, rule := range cfg.Rules {
+		enabled[rule.Name] = true
 	}
 
-	// Reconstruct the file content
-	normalizedContent := fmt.Sprintf("---\n%s---\n%s", string(normalizedYaml), parts[2])
-
-	// Write the normalized content back to the file
-	if err := ioutil.WriteFile(path, []byte(normalizedContent), 0644); err != nil {
-		return fmt.Errorf("failed to write normalized content: %w", err)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Rule\tEnabled\tDescription")
+	fmt.Fprintln(w, "----\t-------\t-----------")
+	for _, rule := range normalizeRules {
+		on := "no"
+		if enabled[rule.Name] {
+			on = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", rule.Name, on, rule.Description)
 	}
+	return w.Flush()
+}
 
-	fmt.Printf("Normalized frontmatter in %s\n", path)
-	return nil
+// frontmatterEdit is one change to a frontmatter field, made by
+// 'kg frontmatter update'.
+type frontmatterEdit struct {
+	Op     string
+	Key    string
+	Values []*yaml.Node
 }
 
-func normalizeFields(frontmatter map[string]interface{}) map[string]interface{} {
-	// Normalize date formats
-	if date, ok := frontmatter["date"].(string); ok {
-		if parsedDate, err := time.Parse("2006-01-02", date); err == nil {
-			frontmatter["date"] = parsedDate.Format("2006-01-02")
+func parseFrontmatterEdit(op, key string, values []string, valueType string) (frontmatterEdit, error) {
+	edit := frontmatterEdit{Op: op, Key: key}
+	switch op {
+	case "unset":
+		if len(values) > 0 {
+			return edit, fmt.Errorf("unset takes no values")
 		}
+		return edit, nil
+	case "set", "append", "remove":
+		if len(values) == 0 {
+			return edit, fmt.Errorf("%s needs at least one value", op)
+		}
+	default:
+		return edit, fmt.Errorf("unsupported operation: %s. Use 'set', 'unset', 'append' or 'remove'", op)
 	}
 
-	// Normalize tag capitalization
-	if tags, ok := frontmatter["tags"].([]interface{}); ok {
-		normalizedTags := make([]string, len(tags))
-		for i, tag := range tags {
-			if strTag, ok := tag.(string); ok {
-				normalizedTags[i] = strings.ToLower(strTag)
-			}
+	for _, v := range values {
+		node, err := typedValueNode(v, valueType)
+		if err != nil {
+			return edit, err
 		}
-		frontmatter["tags"] = normalizedTags
+		if node.Kind == yaml.SequenceNode && op != "set" {
+			edit.Values = append(edit.Values, node.Content...)
+			continue
+		}
+		edit.Values = append(edit.Values, node)
 	}
-
-	// Add more normalization rules as needed
-
-	return frontmatter
+	return edit, nil
 }
 
-func updateFileField(path, key, value string) error {
-	content, err := ioutil.ReadFile(path)
-	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
+// typedValueNode converts a value given on the command line to a YAML node
+// of the requested type, or with "auto", of the type it looks like.
+func typedValueNode(value, valueType string) (*yaml.Node, error) {
+	scalar := func(tag, v string) *yaml.Node {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: v}
 	}
 
-	parts := strings.SplitN(string(content), "---", 3)
-	if len(parts) != 3 {
-		return fmt.Errorf("invalid frontmatter format")
+	switch valueType {
+	case "string":
+		return scalar("!!str", value), nil
+	case "bool":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bool: %s", value)
+		}
+		return scalar("!!bool", strconv.FormatBool(b)), nil
+	case "int":
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid int: %s", value)
+		}
+		return scalar("!!int", strconv.FormatInt(i, 10)), nil
+	case "float":
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float: %s", value)
+		}
+		return scalar("!!float", strconv.FormatFloat(f, 'f', -1, 64)), nil
+	case "date":
+		cfg, err := normalizeConfigFromViper()
+		if err != nil {
+			return nil, err
+		}
+		for _, layout := range append([]string{cfg.DateFormat}, dateLayouts...) {
+			if t, err := time.Parse(layout, value); err == nil {
+				// kg stores dates as strings, which is what the rest of kg reads.
+				return scalar("!!str", t.Format(cfg.DateFormat)), nil
+			}
+		}
+		return nil, fmt.Errorf("invalid date: %s", value)
+	case "list":
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return stringSequenceNode(items), nil
+	case "auto":
+		var doc yaml.Node
+		if err := yaml.Unmarshal([]byte(value), &doc); err != nil || len(doc.Content) != 1 {
+			return scalar("!!str", value), nil
+		}
+		node := doc.Content[0]
+		switch {
+		case node.Kind == yaml.SequenceNode:
+			node.Style = 0
+			return node, nil
+		case node.Kind == yaml.ScalarNode && (node.Tag == "!!bool" || node.Tag == "!!int" || node.Tag == "!!float"):
+			return scalar(node.Tag, node.Value), nil
+		}
+		return scalar("!!str", value), nil
 	}
+	return nil, fmt.Errorf("unsupported type: %s. Use auto, string, bool, int, float, date or list", valueType)
+}
 
-	var frontmatter map[string]interface{}
-	if err := yaml.Unmarshal([]byte(parts[1]), &frontmatter); err != nil {
-		return fmt.Errorf("failed to parse frontmatter: %w", err)
+// Apply makes the edit to a frontmatter mapping node.
+func (e frontmatterEdit) Apply(fm *yaml.Node) {
+	switch e.Op {
+	case "set":
+		if len(e.Values) == 1 {
+			setMappingValue(fm, e.Key, e.Values[0])
+			return
+		}
+		seq := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: e.Values}
+		setMappingValue(fm, e.Key, seq)
+
+	case "unset":
+		deleteMappingValue(fm, e.Key)
+
+	case "append":
+		list := mappingValue(fm, e.Key)
+		switch {
+		case list == nil || list.Kind == yaml.ScalarNode && list.Tag == "!!null":
+			list = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		case list.Kind == yaml.ScalarNode:
+			list = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: []*yaml.Node{list}}
+		}
+		for _, v := range e.Values {
+			if !sequenceContains(list, v.Value) {
+				list.Content = append(list.Content, v)
+			}
+		}
+		setMappingValue(fm, e.Key, list)
+
+	case "remove":
+		list := mappingValue(fm, e.Key)
+		if list == nil {
+			return
+		}
+		drop := func(n *yaml.Node) bool {
+			for _, v := range e.Values {
+				if n.Kind == yaml.ScalarNode && n.Value == v.Value {
+					return true
+				}
+			}
+			return false
+		}
+		if list.Kind == yaml.ScalarNode {
+			if drop(list) {
+				deleteMappingValue(fm, e.Key)
+			}
+			return
+		}
+		kept := list.Content[:0]
+		for _, item := range list.Content {
+			if !drop(item) {
+				kept = append(kept, item)
+			}
+		}
+		list.Content = kept
+		if len(kept) == 0 {
+			deleteMappingValue(fm, e.Key)
+		}
 	}
+}
 
-	// Update the specified field
-	frontmatter[key] = value
+func sequenceContains(seq *yaml.Node, value string) bool {
+	for _, item := range seq.Content {
+		if item.Kind == yaml.ScalarNode && item.Value == value {
+			return true
+		}
+	}
+	return false
+}
 
-	// Marshal the updated frontmatter
-	updatedYaml, err := yaml.Marshal(frontmatter)
+// updateFileField applies edit to the frontmatter of the note at path,
+// keeping the order and formatting of the other keys, and returns the
+// note's contents before and after. With dryRun set the note is not
+// written.
+func updateFileField(path string, edit frontmatterEdit, dryRun bool) (string, string, error) {
+	content, err := os.ReadFile(path)
 	if err != nil {
-		return fmt.Errorf("failed to marshal updated frontmatter: %w", err)
+		return "", "", fmt.Errorf("failed to read file: %w", err)
 	}
 
-	// Reconstruct the file content
-	updatedContent := fmt.Sprintf("---\n%s---\n%s", string(updatedYaml), parts[2])
-
-	// Write the updated content back to the file
-	if err := ioutil.WriteFile(path, []byte(updatedContent), 0644); err != nil {
-		return fmt.Errorf("failed to write updated content: %w", err)
+	updated, err := editFrontmatterNode(string(content), edit.Apply)
+	if err != nil {
+		return "", "", err
 	}
 
-	fmt.Printf("Updated %s in %s\n", key, path)
-	return nil
+	if !dryRun && updated != string(content) {
+		if err := os.WriteFile(path, []byte(updated), 0644); err != nil {
+			return "", "", fmt.Errorf("failed to write updated content: %w", err)
+		}
+	}
+	return string(content), updated, nil
 }
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func newGraphCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "graph",
+		Short: "Analyze the structure of the knowledge graph",
+		Long: `Analyze how notes are related: find paths between notes, their
+neighborhoods, the most central notes, clusters of closely related notes,
+disconnected parts of the graph, and the relations holding it together.
+
+The graph has an edge between two notes when either relates to the other.
+With --links, wikilinks in note bodies count as edges too.`,
+	}
+
+	cmd.PersistentFlags().StringP("format", "o", "table", "Output format (table or json)")
+	cmd.PersistentFlags().Bool("links", false, "Count wikilinks in note bodies as edges")
+
+	cmd.AddCommand(
+		newGraphPathCmd(),
+		newGraphNeighborsCmd(),
+		newGraphCentralCmd(),
+		newGraphCommunitiesCmd(),
+		newGraphComponentsCmd(),
+		newGraphBridgesCmd(),
+	)
+
+	return cmd
+}
+
+func newGraphPathCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:               "path [from] [to]",
+		Short:             "Show a shortest path between two notes",
+		Args:              cobra.ExactArgs(2),
+		ValidArgsFunction: completeNotes(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			g, store, format, err := loadNoteGraph(cmd)
+			if err != nil {
+				return err
+			}
+			return showGraphPath(g, store, args[0], args[1], format)
+		},
+	}
+}
+
+func newGraphNeighborsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "neighbors [note]",
+		Short:             "List the notes near a note",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeNotes(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			depth, _ := cmd.Flags().GetInt("depth")
+			if depth < 1 {
+				return fmt.Errorf("--depth must be at least 1")
+			}
+			g, store, format, err := loadNoteGraph(cmd)
+			if err != nil {
+				return err
+			}
+			return showGraphNeighbors(g, store, args[0], depth, format)
+		},
+	}
+
+	cmd.Flags().IntP("depth", "d", 1, "How many relations away to look")
+
+	return cmd
+}
+
+func newGraphCentralCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "central",
+		Short: "Rank notes by PageRank and betweenness centrality",
+		Long: `Rank notes by how central they are. PageRank favors notes related to many
+other well connected notes: the hubs of the vault. Betweenness favors notes
+that lie on the paths between otherwise distant notes: the ones that join
+topics together.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			top, _ := cmd.Flags().GetInt("top")
+			sortBy, _ := cmd.Flags().GetString("sort")
+			if sortBy != "pagerank" && sortBy != "betweenness" && sortBy != "degree" {
+				return fmt.Errorf("unsupported sort: %s. Use 'pagerank', 'betweenness' or 'degree'", sortBy)
+			}
+			g, _, format, err := loadNoteGraph(cmd)
+			if err != nil {
+				return err
+			}
+			return showCentralNotes(g, top, sortBy, format)
+		},
+	}
+
+	cmd.Flags().IntP("top", "n", 10, "Number of notes to show (0 for all)")
+	cmd.Flags().StringP("sort", "s", "pagerank", "Sort by pagerank, betweenness or degree")
+
+	return cmd
+}
+
+func newGraphCommunitiesCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "communities",
+		Short: "Find clusters of closely related notes",
+		Long: `Group notes into communities of closely related notes using the Louvain
+method, which maximizes modularity. Notes without relations are left out.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			g, _, format, err := loadNoteGraph(cmd)
+			if err != nil {
+				return err
+			}
+			var groups [][]int
+			for _, group := range g.Communities() {
+				if len(group) > 1 {
+					groups = append(groups, group)
+				}
+			}
+			return showNoteGroups(g, groups, "Community", format)
+		},
+	}
+}
+
+func newGraphComponentsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "components",
+		Short: "List the disconnected parts of the graph",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			g, _, format, err := loadNoteGraph(cmd)
+			if err != nil {
+				return err
+			}
+			return showNoteGroups(g, g.Components(), "Component", format)
+		},
+	}
+}
+
+func newGraphBridgesCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "bridges",
+		Short: "List relations whose removal would disconnect the graph",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			g, _, format, err := loadNoteGraph(cmd)
+			if err != nil {
+				return err
+			}
+			var edges []Edge
+			for _, b := range g.Bridges() {
+				edges = append(edges, g.Edge(b[0], b[1]))
+			}
+			sort.Slice(edges, func(i, j int) bool {
+				if edges[i].Source != edges[j].Source {
+					return edges[i].Source < edges[j].Source
+				}
+				return edges[i].Target < edges[j].Target
+			})
+			if format == "json" {
+				if edges == nil {
+					edges = []Edge{}
+				}
+				return printJSON(edges)
+			}
+			if len(edges) == 0 {
+				fmt.Println("No bridges found")
+				return nil
+			}
+			return printEdgeTable(edges)
+		},
+	}
+}
+
+// loadNoteGraph reads the graph flags shared by the graph subcommands and
+// builds the graph of the vault.
+func loadNoteGraph(cmd *cobra.Command) (*noteGraph, *edgeStore, string, error) {
+	format, _ := cmd.Flags().GetString("format")
+	links, _ := cmd.Flags().GetBool("links")
+	if format != "table" && format != "json" {
+		return nil, nil, "", fmt.Errorf("unsupported format: %s. Use 'table' or 'json'", format)
+	}
+
+	store, err := openEdgeStore(viper.GetString("notes_directory"))
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return newNoteGraph(store, links), store, format, nil
+}
+
+func showGraphPath(g *noteGraph, store *edgeStore, from, to, format string) error {
+	a, b, err := store.resolvePair(from, to)
+	if err != nil {
+		return err
+	}
+	path := g.ShortestPath(a, b)
+	if path == nil {
+		return fmt.Errorf("no path between '%s' and '%s'", g.notes[a].Title, g.notes[b].Title)
+	}
+
+	edges := make([]Edge, 0, len(path)-1)
+	titles := make([]string, 0, len(path))
+	for k, i := range path {
+		titles = append(titles, g.notes[i].Title)
+		if k > 0 {
+			edges = append(edges, g.Edge(path[k-1], i))
+		}
+	}
+
+	if format == "json" {
+		return printJSON(struct {
+			Path  []string `json:"path"`
+			Edges []Edge   `json:"edges"`
+		}{titles, edges})
+	}
+	fmt.Printf("%d steps from '%s' to '%s':\n\n", len(edges), titles[0], titles[len(titles)-1])
+	return printEdgeTable(edges)
+}
+
+func showGraphNeighbors(g *noteGraph, store *edgeStore, name string, depth int, format string) error {
+	i, err := store.resolve(name)
+	if err != nil {
+		return err
+	}
+	found, dist := g.Neighbors(i, depth)
+
+	type neighbor struct {
+		Title    string `json:"title"`
+		Distance int    `json:"distance"`
+		Degree   int    `json:"degree"`
+	}
+	neighbors := make([]neighbor, 0, len(found))
+	for _, j := range found {
+		neighbors = append(neighbors, neighbor{g.notes[j].Title, dist[j], g.Degree(j)})
+	}
+
+	if format == "json" {
+		return printJSON(neighbors)
+	}
+	if len(neighbors) == 0 {
+		fmt.Printf("'%s' has no related notes\n", g.notes[i].Title)
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Note\tDistance\tDegree")
+	fmt.Fprintln(w, "----\t--------\t------")
+	for _, n := range neighbors {
+		fmt.Fprintf(w, "%s\t%d\t%d\n", n.Title, n.Distance, n.Degree)
+	}
+	return w.Flush()
+}
+
+func showCentralNotes(g *noteGraph, top int, sortBy, format string) error {
+	type centrality struct {
+		Title       string  `json:"title"`
+		Degree      int     `json:"degree"`
+		PageRank    float64 `json:"pagerank"`
+		Betweenness float64 `json:"betweenness"`
+	}
+	pagerank := g.PageRank(0.85, 100)
+	betweenness := g.Betweenness()
+	scores := make([]centrality, len(g.notes))
+	for i, note := range g.notes {
+		scores[i] = centrality{note.Title, g.Degree(i), pagerank[i], betweenness[i]}
+	}
+
+	sort.SliceStable(scores, func(i, j int) bool {
+		switch sortBy {
+		case "betweenness":
+			return scores[i].Betweenness > scores[j].Betweenness
+		case "degree":
+			return scores[i].Degree > scores[j].Degree
+		}
+		return scores[i].PageRank > scores[j].PageRank
+	})
+	if top > 0 && top < len(scores) {
+		scores = scores[:top]
+	}
+
+	if format == "json" {
+		return printJSON(scores)
+	}
+	if len(scores) == 0 {
+		fmt.Println("No notes found")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Note\tDegree\tPageRank\tBetweenness")
+	fmt.Fprintln(w, "----\t------\t--------\t-----------")
+	for _, s := range scores {
+		fmt.Fprintf(w, "%s\t%d\t%.4f\t%.4f\n", s.Title, s.Degree, s.PageRank, s.Betweenness)
+	}
+	return w.Flush()
+}
+
+// showNoteGroups prints communities or components, numbered from 1.
+func showNoteGroups(g *noteGraph, groups [][]int, kind, format string) error {
+	type noteGroup struct {
+		ID    int      `json:"id"`
+		Size  int      `json:"size"`
+		Notes []string `json:"notes"`
+	}
+	result := make([]noteGroup, 0, len(groups))
+	for k, group := range groups {
+		titles := make([]string, 0, len(group))
+		for _, i := range group {
+			titles = append(titles, g.notes[i].Title)
+		}
+		sort.Strings(titles)
+		result = append(result, noteGroup{k + 1, len(group), titles})
+	}
+
+	if format == "json" {
+		return printJSON(result)
+	}
+	if len(result) == 0 {
+		fmt.Printf("No %s found\n", strings.ToLower(kind)+"s")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\tSize\tNotes\n", kind)
+	fmt.Fprintf(w, "%s\t----\t-----\n", strings.Repeat("-", len(kind)))
+	for _, group := range result {
+		fmt.Fprintf(w, "%d\t%d\t%s\n", group.ID, group.Size, strings.Join(group.Notes, ", "))
+	}
+	return w.Flush()
+}
+
+func printEdgeTable(edges []Edge) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "From\tRelation\tTo")
+	fmt.Fprintln(w, "----\t--------\t--")
+	for _, e := range edges {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", e.Source, e.Type, e.Target)
+	}
+	return w.Flush()
+}
+
+func printJSON(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	fmt.Println(string(data))
+	return nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func newHistoryCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history [title]",
+		Short: "Show the revisions of a note",
+		Long: `Show the commits that changed a note, newest first. Requires the notes
+directory to be a git repository; set git.auto_commit to have kg commit
+every change it makes.`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeNotes(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			limit, _ := cmd.Flags().GetInt("limit")
+			return showHistory(args[0], limit)
+		},
+	}
+
+	cmd.Flags().IntP("limit", "n", 0, "Show at most this many revisions")
+
+	return cmd
+}
+
+func newDiffCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "diff [title] [rev]",
+		Short: "Show how a note changed",
+		Long: `Show the changes to a note between a revision and the current file. rev
+defaults to the last commit; use rev1..rev2 to compare two revisions.`,
+		Args:              cobra.RangeArgs(1, 2),
+		ValidArgsFunction: completeNotes(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rev := "HEAD"
+			if len(args) == 2 {
+				rev = args[1]
+			}
+			return diffNote(args[0], rev)
+		},
+	}
+}
+
+func newRevertCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:               "revert [title] [rev]",
+		Short:             "Restore a note to an earlier revision",
+		Args:              cobra.ExactArgs(2),
+		ValidArgsFunction: completeNotes(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return revertNote(args[0], args[1])
+		},
+	}
+}
+
+// noteHistoryPath resolves a note title to its file name within the notes
+// directory, which must be a git repository. The note need not exist in
+// the working tree, so deleted notes keep their history: a title whose file
+// git knows of is used as it is, before looking for a note it matches.
+func noteHistoryPath(title string) (string, string, error) {
+	notesDir := viper.GetString("notes_directory")
+	if err := requireGitRepo(notesDir); err != nil {
+		return "", "", err
+	}
+	filename := generateFilename(title)
+	if _, err := os.Stat(filepath.Join(notesDir, filename)); err == nil {
+		return notesDir, filename, nil
+	}
+	if out, err := runGit(notesDir, "log", "-1", "--format=%h", "--", filename); err == nil && strings.TrimSpace(out) != "" {
+		return notesDir, filename, nil
+	}
+
+	store, err := openEdgeStore(notesDir)
+	if err != nil {
+		return "", "", err
+	}
+	_, path, err := store.Note(title)
+	if err != nil {
+		return "", "", err
+	}
+	rel, err := filepath.Rel(notesDir, path)
+	if err != nil {
+		return "", "", err
+	}
+	return notesDir, rel, nil
+}
+
+func showHistory(title string, limit int) error {
+	notesDir, filename, err := noteHistoryPath(title)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"log", "--follow", "--date=format:%Y-%m-%d %H:%M", "--format=%h%x09%ad%x09%an%x09%s"}
+	if limit > 0 {
+		args = append(args, fmt.Sprintf("-n%d", limit))
+	}
+	out, err := runGit(notesDir, append(args, "--", filename)...)
+	if err != nil {
+		return fmt.Errorf("failed to read history: %w", err)
+	}
+	if out == "" {
+		return fmt.Errorf("note '%s' has no committed revisions", title)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Rev\tDate\tAuthor\tMessage")
+	fmt.Fprintln(w, "---\t----\t------\t-------")
+	for _, line := range strings.Split(out, "\n") {
+		fmt.Fprintln(w, line)
+	}
+	return w.Flush()
+}
+
+func diffNote(title, rev string) error {
+	notesDir, filename, err := noteHistoryPath(title)
+	if err != nil {
+		return err
+	}
+
+	from, to, isRange := strings.Cut(rev, "..")
+	a, err := noteAtRevision(notesDir, filename, from)
+	if err != nil {
+		return err
+	}
+
+	var b, nameB string
+	if isRange {
+		if b, err = noteAtRevision(notesDir, filename, to); err != nil {
+			return err
+		}
+		nameB = fmt.Sprintf("%s (%s)", filename, to)
+	} else {
+		data, err := os.ReadFile(filepath.Join(notesDir, filename))
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to read note: %w", err)
+		}
+		b, nameB = string(data), filename
+	}
+
+	diff := unifiedDiff(a, b, fmt.Sprintf("%s (%s)", filename, from), nameB)
+	if diff == "" {
+		fmt.Printf("No changes to '%s'\n", title)
+		return nil
+	}
+	fmt.Print(diff)
+	return nil
+}
+
+func revertNote(title, rev string) error {
+	notesDir, filename, err := noteHistoryPath(title)
+	if err != nil {
+		return err
+	}
+
+	content, err := noteAtRevision(notesDir, filename, rev)
+	if err != nil {
+		return err
+	}
+	short, err := runGit(notesDir, "rev-parse", "--short", rev)
+	if err != nil {
+		return fmt.Errorf("unknown revision '%s'", rev)
+	}
+
+	path := filepath.Join(notesDir, filename)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to restore note: %w", err)
+	}
+	commitNotes(fmt.Sprintf("Revert note %q to %s", title, short), filename)
+
+	fmt.Printf("Note '%s' restored to revision %s\n", title, short)
+	return nil
+}
+
+// noteAtRevision returns the contents of a note at a git revision.
+func noteAtRevision(notesDir, filename, rev string) (string, error) {
+	if rev == "" {
+		rev = "HEAD"
+	}
+	// "./" makes git resolve the path relative to notesDir rather than the
+	// repository root, which may be a parent directory.
+	out, err := gitOutput(notesDir, "show", rev+":./"+filename)
+	if err != nil {
+		return "", fmt.Errorf("note not found at revision '%s': %w", rev, err)
+	}
+	return string(out), nil
+}
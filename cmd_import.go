@@ -5,7 +5,9 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -13,70 +15,375 @@ import (
 )
 
 func newImportCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "import [file]",
+	cmd := &cobra.Command{
+		Use:   "import [file|dir|glob]...",
 		Short: "Add external markdown files, parsing frontmatter",
-		Args:  cobra.ExactArgs(1),
+		Long: `Import markdown files with frontmatter into the notes directory.
+
+Arguments may be files, directories (imported recursively) or glob patterns.
+When a note with the same title already exists, --on-conflict decides what
+happens: skip it, overwrite it, import under a renamed title, or merge the
+two by combining tags and connections and appending the new body.`,
+		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return importFile(args[0])
+			onConflict, _ := cmd.Flags().GetString("on-conflict")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			transactional, _ := cmd.Flags().GetBool("transactional")
+
+			switch onConflict {
+			case "skip", "overwrite", "rename", "merge":
+			default:
+				return fmt.Errorf("unsupported conflict strategy: %s. Use 'skip', 'overwrite', 'rename' or 'merge'", onConflict)
+			}
+
+			return importFiles(args, importOptions{
+				OnConflict:    onConflict,
+				DryRun:        dryRun,
+				Transactional: transactional,
+			})
 		},
 	}
+
+	cmd.Flags().String("on-conflict", "skip", "What to do when a note already exists (skip, overwrite, rename, merge)")
+	cmd.Flags().Bool("dry-run", false, "Show what would be imported without writing anything")
+	cmd.Flags().Bool("transactional", false, "Roll back every write if any file fails to import")
+
+	cmd.AddCommand(
+		newImportObsidianCmd(),
+		newImportLogseqCmd(),
+		newImportRoamCmd(),
+		newImportBibtexCmd(),
+		newImportCSLCmd(),
+	)
+
+	return cmd
+}
+
+type importOptions struct {
+	OnConflict    string
+	DryRun        bool
+	Transactional bool
 }
 
-func importFile(filePath string) error {
-	// Read the file content
-	content, err := ioutil.ReadFile(filePath)
+// importItem is the plan for importing a single source file.
+type importItem struct {
+	Source      string
+	Title       string
+	DestPath    string
+	Action      string
+	Err         error
+	frontmatter map[string]interface{}
+	body        string
+}
+
+func importFiles(patterns []string, opts importOptions) error {
+	notesDir := viper.GetString("notes_directory")
+	if notesDir == "" {
+		return fmt.Errorf("notes directory not set in config")
+	}
+
+	sources, err := expandImportPaths(patterns)
 	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
+		return err
+	}
+	if len(sources) == 0 {
+		return fmt.Errorf("no markdown files matched %s", strings.Join(patterns, " "))
 	}
 
-	// Parse the markdown file and extract frontmatter
-	frontmatter, body, err := parseFrontmatter(string(content))
+	items := planImport(notesDir, sources, opts.OnConflict)
+
+	if opts.DryRun {
+		displayImportPlan(items)
+		return nil
+	}
+
+	existing, err := loadNotes(notesDir)
 	if err != nil {
-		return fmt.Errorf("failed to parse frontmatter: %w", err)
+		return fmt.Errorf("failed to load notes: %w", err)
+	}
+	titles := make(map[string]string)
+	for _, note := range existing {
+		titles[noteKey(note.Title)] = note.Title
+	}
+	for _, item := range items {
+		if item.Err == nil && item.Action != "skip" {
+			titles[noteKey(item.Title)] = item.Title
+		}
 	}
 
-	// Validate frontmatter
-	if err := validateFrontmatter(frontmatter); err != nil {
-		return fmt.Errorf("invalid frontmatter: %w", err)
+	journal := newWriteJournal()
+	failed := 0
+	for _, item := range items {
+		if item.Err == nil && item.Action != "skip" {
+			item.Err = applyImport(item, titles, journal)
+		}
+		if item.Err == nil {
+			continue
+		}
+
+		failed++
+		if opts.Transactional {
+			if err := journal.rollback(); err != nil {
+				return fmt.Errorf("failed to import %s: %v; rollback failed: %w", item.Source, item.Err, err)
+			}
+			return fmt.Errorf("failed to import %s, rolled back all changes: %w", item.Source, item.Err)
+		}
 	}
 
-	// Generate filename from title
-	title, ok := frontmatter["title"].(string)
-	if !ok {
-		return fmt.Errorf("title not found in frontmatter")
+	displayImportPlan(items)
+	commitNotes(fmt.Sprintf("Import %s", strings.Join(patterns, " ")), journal.paths()...)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed to import", failed, len(items))
 	}
-	filename := generateFilename(title)
+	return nil
+}
 
-	// Check for conflicts with existing notes
-	notesDir := viper.GetString("notes_directory")
-	if notesDir == "" {
-		return fmt.Errorf("notes directory not set in config")
+// expandImportPaths turns files, directories and glob patterns into a
+// sorted, de-duplicated list of markdown files.
+func expandImportPaths(patterns []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var files []string
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no such file or directory: %s", pattern)
+		}
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, fmt.Errorf("failed to stat %s: %w", match, err)
+			}
+			if !info.IsDir() {
+				add(match)
+				continue
+			}
+			err = filepath.Walk(match, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if info.IsDir() && path != match && strings.HasPrefix(info.Name(), ".") {
+					return filepath.SkipDir
+				}
+				if !info.IsDir() && strings.HasSuffix(info.Name(), ".md") {
+					add(path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to walk %s: %w", match, err)
+			}
+		}
 	}
-	destPath := filepath.Join(notesDir, filename)
 
-	if _, err := os.Stat(destPath); !os.IsNotExist(err) {
-		return fmt.Errorf("a note with the title '%s' already exists", title)
+	sort.Strings(files)
+	return files, nil
+}
+
+// planImport parses every source and decides where it goes and what to do
+// about conflicts, without touching the notes directory.
+func planImport(notesDir string, sources []string, onConflict string) []*importItem {
+	claimed := make(map[string]bool)
+	var items []*importItem
+
+	for _, source := range sources {
+		item := &importItem{Source: source, Action: "create"}
+		items = append(items, item)
+
+		content, err := ioutil.ReadFile(source)
+		if err != nil {
+			item.Err = fmt.Errorf("failed to read file: %w", err)
+			continue
+		}
+
+		frontmatter, body, err := parseFrontmatter(string(content))
+		if err != nil {
+			item.Err = fmt.Errorf("failed to parse frontmatter: %w", err)
+			continue
+		}
+		if err := validateFrontmatter(frontmatter); err != nil {
+			item.Err = fmt.Errorf("invalid frontmatter: %w", err)
+			continue
+		}
+		title, ok := frontmatter["title"].(string)
+		if !ok {
+			item.Err = fmt.Errorf("title not found in frontmatter")
+			continue
+		}
+
+		item.Title = title
+		item.frontmatter = frontmatter
+		item.body = body
+		item.DestPath = filepath.Join(notesDir, generateFilename(title))
+
+		if !claimed[item.DestPath] && !fileExists(item.DestPath) {
+			claimed[item.DestPath] = true
+			continue
+		}
+
+		item.Action = onConflict
+		if onConflict == "rename" {
+			for n := 2; claimed[item.DestPath] || fileExists(item.DestPath); n++ {
+				item.Title = fmt.Sprintf("%s (%d)", title, n)
+				item.DestPath = filepath.Join(notesDir, generateFilename(item.Title))
+			}
+			item.frontmatter["title"] = item.Title
+		} else if claimed[item.DestPath] && onConflict != "merge" {
+			// Two sources with the same title: only merge can combine them.
+			item.Action = "skip"
+		}
+		claimed[item.DestPath] = true
 	}
 
-	// Copy the file to the appropriate location
-	if err := copyFile(filePath, destPath); err != nil {
-		return fmt.Errorf("failed to copy file: %w", err)
+	return items
+}
+
+func applyImport(item *importItem, titles map[string]string, journal *writeJournal) error {
+	frontmatter := item.frontmatter
+	body := updateInternalLinks(item.body, titles)
+
+	if item.Action == "merge" {
+		content, err := ioutil.ReadFile(item.DestPath)
+		if err != nil {
+			return fmt.Errorf("failed to read existing note: %w", err)
+		}
+		existing, existingBody, err := parseFrontmatter(string(content))
+		if err != nil {
+			return fmt.Errorf("failed to parse existing note: %w", err)
+		}
+		frontmatter, body = mergeNotes(existing, existingBody, frontmatter, body)
 	}
 
-	// Update internal links
-	updatedBody, err := updateInternalLinks(body, notesDir)
+	yamlData, err := encodeFrontmatter(frontmatter)
 	if err != nil {
-		return fmt.Errorf("failed to update internal links: %w", err)
+		return fmt.Errorf("failed to marshal frontmatter: %w", err)
+	}
+	content := fmt.Sprintf("---\n%s---%s", string(yamlData), body)
+	if err := journal.write(item.DestPath, []byte(content)); err != nil {
+		return fmt.Errorf("failed to write note: %w", err)
+	}
+
+	return nil
+}
+
+// mergeSeparator is placed between the existing body and the imported one
+// when notes are merged.
+const mergeSeparator = "\n\n---\n\n"
+
+// mergeNotes combines an imported note into an existing one. Tags and
+// connections are unioned, fields missing from the existing note are
+// copied over and the imported body is appended.
+func mergeNotes(existing map[string]interface{}, existingBody string, imported map[string]interface{}, importedBody string) (map[string]interface{}, string) {
+	merged := make(map[string]interface{}, len(existing))
+	for key, value := range existing {
+		merged[key] = value
 	}
 
-	// Write the updated content back to the file
-	updatedContent := fmt.Sprintf("---\n%s\n---\n%s", marshalFrontmatter(frontmatter), updatedBody)
-	if err := ioutil.WriteFile(destPath, []byte(updatedContent), 0644); err != nil {
-		return fmt.Errorf("failed to write updated content: %w", err)
+	for key, value := range imported {
+		switch key {
+		case "tags", "connected_to", "aliases":
+			list := stringList(merged[key])
+			for _, item := range stringList(value) {
+				if !containsString(list, item) {
+					list = append(list, item)
+				}
+			}
+			merged[key] = list
+		default:
+			if _, ok := merged[key]; !ok {
+				merged[key] = value
+			}
+		}
+	}
+
+	body := strings.TrimRight(existingBody, "\n") + mergeSeparator + strings.TrimSpace(importedBody) + "\n"
+	return merged, body
+}
+
+func displayImportPlan(items []*importItem) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Source\tTitle\tDestination\tAction")
+	fmt.Fprintln(w, "------\t-----\t-----------\t------")
+
+	counts := make(map[string]int)
+	for _, item := range items {
+		action := item.Action
+		if item.Err != nil {
+			action = "error: " + item.Err.Error()
+			counts["error"]++
+		} else {
+			counts[item.Action]++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", item.Source, item.Title, item.DestPath, action)
 	}
+	w.Flush()
 
-	fmt.Printf("Successfully imported '%s' to %s\n", title, destPath)
+	var summary []string
+	for _, action := range []string{"create", "overwrite", "rename", "merge", "skip", "error"} {
+		if counts[action] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[action], action))
+		}
+	}
+	fmt.Printf("\n%d files: %s\n", len(items), strings.Join(summary, ", "))
+}
+
+// writeJournal records every file it writes so that a failed transactional
+// import can put the notes directory back the way it was.
+type writeJournal struct {
+	created   []string
+	originals map[string][]byte
+}
+
+func newWriteJournal() *writeJournal {
+	return &writeJournal{originals: make(map[string][]byte)}
+}
+
+func (j *writeJournal) write(path string, data []byte) error {
+	if _, recorded := j.originals[path]; !recorded && !containsString(j.created, path) {
+		original, err := ioutil.ReadFile(path)
+		switch {
+		case err == nil:
+			j.originals[path] = original
+		case os.IsNotExist(err):
+			j.created = append(j.created, path)
+		default:
+			return err
+		}
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// paths returns every file the journal has written.
+func (j *writeJournal) paths() []string {
+	paths := append([]string(nil), j.created...)
+	for path := range j.originals {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (j *writeJournal) rollback() error {
+	for _, path := range j.created {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	for path, original := range j.originals {
+		if err := ioutil.WriteFile(path, original, 0644); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -112,16 +419,73 @@ func copyFile(src, dst string) error {
 	return ioutil.WriteFile(dst, input, 0644)
 }
 
-func updateInternalLinks(content, notesDir string) (string, error) {
-	// A more robust implementation would use a proper Markdown parser
-	return strings.ReplaceAll(content, "[[", "["+notesDir+"/"), fmt.Errorf("not implemented")
+// updateInternalLinks rewrites wikilinks to use the canonical title of the
+// note they point to. Links that do not match any note are left alone.
+func updateInternalLinks(content string, titles map[string]string) string {
+	return replaceWikilinks(content, func(link wikilink) string {
+		if title, ok := titles[noteKey(link.Target)]; ok {
+			link.Target = title
+		}
+		return formatWikilink(link)
+	})
 }
 
-func marshalFrontmatter(frontmatter map[string]interface{}) string {
-	yamlData, err := yaml.Marshal(frontmatter)
-	if err != nil {
-		// If marshaling fails, return an empty string
-		return ""
+// importReport collects what an import did so it can be summarized at the
+// end instead of aborting on the first problem.
+type importReport struct {
+	Imported    []string
+	Attachments int
+	Conflicts   []string
+	Unresolved  map[string][]string
+
+	// paths are the files written, for committing them.
+	paths []string
+}
+
+func newImportReport() *importReport {
+	return &importReport{Unresolved: make(map[string][]string)}
+}
+
+func (r *importReport) imported(title, path string) {
+	r.Imported = append(r.Imported, fmt.Sprintf("%s -> %s", title, path))
+	r.paths = append(r.paths, path)
+}
+
+func (r *importReport) attachment(path string) {
+	r.Attachments++
+	r.paths = append(r.paths, path)
+}
+
+func (r *importReport) conflict(source, reason string) {
+	r.Conflicts = append(r.Conflicts, fmt.Sprintf("%s: %s", source, reason))
+}
+
+func (r *importReport) unresolved(title, target string) {
+	if !containsString(r.Unresolved[title], target) {
+		r.Unresolved[title] = append(r.Unresolved[title], target)
+	}
+}
+
+func (r *importReport) print() {
+	fmt.Printf("Imported %d notes, copied %d attachments\n", len(r.Imported), r.Attachments)
+
+	if len(r.Conflicts) > 0 {
+		fmt.Printf("\nConflicts (%d, skipped):\n", len(r.Conflicts))
+		for _, c := range r.Conflicts {
+			fmt.Printf("  %s\n", c)
+		}
+	}
+
+	if len(r.Unresolved) > 0 {
+		titles := make([]string, 0, len(r.Unresolved))
+		for title := range r.Unresolved {
+			titles = append(titles, title)
+		}
+		sort.Strings(titles)
+
+		fmt.Println("\nUnresolved links:")
+		for _, title := range titles {
+			fmt.Printf("  %s: %s\n", title, strings.Join(r.Unresolved[title], ", "))
+		}
 	}
-	return string(yamlData)
 }
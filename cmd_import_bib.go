@@ -0,0 +1,617 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func newImportBibtexCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bibtex [refs.bib]",
+		Short: "Create literature notes from a BibTeX file",
+		Long: `Create one literature note per BibTeX entry, with authors, year, venue,
+DOI and citekey in the frontmatter and tags taken from the keywords.
+Entries whose citekey already has a note update that note instead.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			linkAuthors, _ := cmd.Flags().GetBool("link-authors")
+
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to read BibTeX file: %w", err)
+			}
+			refs, err := parseBibtex(string(data))
+			if err != nil {
+				return fmt.Errorf("failed to parse BibTeX file: %w", err)
+			}
+			return importLiterature(refs, linkAuthors, "bibtex "+args[0])
+		},
+	}
+
+	cmd.Flags().Bool("link-authors", false, "Connect literature notes that share an author")
+
+	return cmd
+}
+
+func newImportCSLCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "csl [refs.json]",
+		Short: "Create literature notes from a CSL-JSON file",
+		Long: `Create one literature note per CSL-JSON item, as exported by Zotero and
+most reference managers. Items whose citekey already has a note update that
+note instead.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			linkAuthors, _ := cmd.Flags().GetBool("link-authors")
+
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to read CSL-JSON file: %w", err)
+			}
+			refs, err := parseCSLJSON(data)
+			if err != nil {
+				return fmt.Errorf("failed to parse CSL-JSON file: %w", err)
+			}
+			return importLiterature(refs, linkAuthors, "csl "+args[0])
+		},
+	}
+
+	cmd.Flags().Bool("link-authors", false, "Connect literature notes that share an author")
+
+	return cmd
+}
+
+// literatureRef is a bibliographic entry in a format-neutral form.
+type literatureRef struct {
+	CiteKey  string
+	Type     string
+	Title    string
+	Authors  []string
+	Year     int
+	Venue    string
+	DOI      string
+	URL      string
+	Keywords []string
+	Abstract string
+}
+
+// importLiterature creates or updates a note per reference. source names
+// the import in the commit message.
+func importLiterature(refs []literatureRef, linkAuthors bool, source string) error {
+	notesDir := viper.GetString("notes_directory")
+	if notesDir == "" {
+		return fmt.Errorf("notes directory not set in config")
+	}
+
+	// Existing literature notes are matched by citekey so re-imports update
+	// them in place.
+	byCiteKey := make(map[string]string)
+	authorsByCiteKey := make(map[string][]string)
+	err := walkNotes(notesDir, func(path string, note Note) error {
+		if citekey, ok := note.Frontmatter["citekey"].(string); ok && citekey != "" {
+			byCiteKey[citekey] = path
+			authorsByCiteKey[citekey] = stringList(note.Frontmatter["authors"])
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load notes: %w", err)
+	}
+
+	for _, ref := range refs {
+		if ref.CiteKey != "" && ref.Title != "" {
+			authorsByCiteKey[ref.CiteKey] = ref.Authors
+		}
+	}
+
+	created, updated, skipped := 0, 0, 0
+	var written []string
+	var imported []literatureRef
+	for _, ref := range refs {
+		if ref.CiteKey == "" || ref.Title == "" {
+			fmt.Printf("Skipping entry without citekey or title: %q\n", ref.Title+ref.CiteKey)
+			skipped++
+			continue
+		}
+		imported = append(imported, ref)
+
+		if path, ok := byCiteKey[ref.CiteKey]; ok {
+			if err := updateLiteratureNote(path, ref); err != nil {
+				return fmt.Errorf("failed to update %s: %w", ref.CiteKey, err)
+			}
+			written = append(written, path)
+			updated++
+			continue
+		}
+
+		path := filepath.Join(notesDir, generateFilename(ref.Title))
+		if fileExists(path) {
+			path = filepath.Join(notesDir, generateFilename(fmt.Sprintf("%s (%s)", ref.Title, ref.CiteKey)))
+		}
+		if err := writeNoteFile(path, literatureFrontmatter(nil, ref), literatureBody(ref)); err != nil {
+			return fmt.Errorf("failed to create note for %s: %w", ref.CiteKey, err)
+		}
+		byCiteKey[ref.CiteKey] = path
+		written = append(written, path)
+		created++
+	}
+
+	if linkAuthors && len(imported) > 0 {
+		// Links go through the edge store so that notes imported earlier
+		// get the relation back as well.
+		store, err := openEdgeStore(notesDir)
+		if err != nil {
+			return err
+		}
+		for _, ref := range imported {
+			for _, other := range sharedAuthorCiteKeys(ref, authorsByCiteKey) {
+				from, to := byCiteKey[ref.CiteKey], byCiteKey[other]
+				if from == "" || to == "" || from == to {
+					continue
+				}
+				changed, err := store.Add(from, defaultRelation, to)
+				if err != nil {
+					return fmt.Errorf("failed to connect %s and %s: %w", ref.CiteKey, other, err)
+				}
+				if changed {
+					for _, path := range []string{from, to} {
+						if !containsString(written, path) {
+							written = append(written, path)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	fmt.Printf("Literature import: %d created, %d updated, %d skipped\n", created, updated, skipped)
+	commitNotes(fmt.Sprintf("Import %s", source), written...)
+	return nil
+}
+
+// sharedAuthorCiteKeys returns the citekeys of other literature notes with
+// at least one author in common with ref.
+func sharedAuthorCiteKeys(ref literatureRef, authorsByCiteKey map[string][]string) []string {
+	var keys []string
+	for key, authors := range authorsByCiteKey {
+		if key == ref.CiteKey {
+			continue
+		}
+		for _, author := range authors {
+			if containsString(ref.Authors, author) {
+				keys = append(keys, key)
+				break
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// literatureFrontmatter fills in the bibliographic fields of frontmatter,
+// keeping anything else the note already has.
+func literatureFrontmatter(frontmatter map[string]interface{}, ref literatureRef) map[string]interface{} {
+	if frontmatter == nil {
+		today := time.Now().Format("2006-01-02")
+		frontmatter = map[string]interface{}{
+			"date":    today,
+			"lastmod": today,
+			"draft":   false,
+		}
+	}
+
+	frontmatter["title"] = ref.Title
+	frontmatter["citekey"] = ref.CiteKey
+	set := func(key string, value interface{}, present bool) {
+		if present {
+			frontmatter[key] = value
+		}
+	}
+	set("entry_type", ref.Type, ref.Type != "")
+	set("authors", ref.Authors, len(ref.Authors) > 0)
+	set("year", ref.Year, ref.Year != 0)
+	set("venue", ref.Venue, ref.Venue != "")
+	set("doi", ref.DOI, ref.DOI != "")
+	set("url", ref.URL, ref.URL != "")
+
+	tags := stringList(frontmatter["tags"])
+	for _, keyword := range ref.Keywords {
+		if !containsString(tags, keyword) {
+			tags = append(tags, keyword)
+		}
+	}
+	if len(tags) > 0 {
+		frontmatter["tags"] = tags
+	}
+
+	return frontmatter
+}
+
+func literatureBody(ref literatureRef) string {
+	body := "# " + ref.Title + "\n"
+	if ref.Abstract != "" {
+		body += "\n> " + strings.ReplaceAll(ref.Abstract, "\n", "\n> ") + "\n"
+	}
+	return body
+}
+
+// updateLiteratureNote refreshes the bibliographic frontmatter of an
+// existing note, leaving its body untouched.
+func updateLiteratureNote(path string, ref literatureRef) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	frontmatter, body, err := parseFrontmatter(string(content))
+	if err != nil {
+		return err
+	}
+	if frontmatter == nil {
+		frontmatter = make(map[string]interface{})
+	}
+	frontmatter = literatureFrontmatter(frontmatter, ref)
+	frontmatter["lastmod"] = time.Now().Format("2006-01-02")
+
+	return rewriteFrontmatter(path, frontmatter, body)
+}
+
+// parseBibtex parses the entries of a BibTeX file. @string macros are
+// expanded; @comment and @preamble blocks are ignored.
+func parseBibtex(input string) ([]literatureRef, error) {
+	p := &bibtexParser{input: input, macros: make(map[string]string)}
+	for month, i := range map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12} {
+		p.macros[month] = strconv.Itoa(i)
+	}
+
+	var refs []literatureRef
+	for {
+		at := strings.IndexByte(p.input[p.pos:], '@')
+		if at < 0 {
+			break
+		}
+		p.pos += at + 1
+
+		entryType := strings.ToLower(p.readIdent())
+		p.skipSpace()
+		if p.pos >= len(p.input) || (p.input[p.pos] != '{' && p.input[p.pos] != '(') {
+			continue
+		}
+
+		switch entryType {
+		case "comment", "preamble":
+			if _, err := p.readDelimited(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		p.pos++
+
+		if entryType == "string" {
+			fields, err := p.readFields()
+			if err != nil {
+				return nil, err
+			}
+			for name, value := range fields {
+				p.macros[name] = value
+			}
+			continue
+		}
+
+		p.skipSpace()
+		keyEnd := strings.IndexAny(p.input[p.pos:], ",})")
+		if keyEnd < 0 {
+			return nil, fmt.Errorf("unterminated entry at offset %d", p.pos)
+		}
+		citekey := strings.TrimSpace(p.input[p.pos : p.pos+keyEnd])
+		p.pos += keyEnd
+		if p.input[p.pos] == ',' {
+			p.pos++
+		}
+
+		fields, err := p.readFields()
+		if err != nil {
+			return nil, fmt.Errorf("entry %s: %w", citekey, err)
+		}
+		refs = append(refs, bibtexRef(entryType, citekey, fields))
+	}
+
+	return refs, nil
+}
+
+func bibtexRef(entryType, citekey string, fields map[string]string) literatureRef {
+	ref := literatureRef{
+		CiteKey:  citekey,
+		Type:     entryType,
+		Title:    cleanLatex(fields["title"]),
+		DOI:      cleanLatex(fields["doi"]),
+		URL:      cleanLatex(fields["url"]),
+		Abstract: cleanLatex(fields["abstract"]),
+	}
+	ref.Year, _ = strconv.Atoi(strings.TrimSpace(fields["year"]))
+	if ref.Year == 0 && len(fields["date"]) >= 4 {
+		ref.Year, _ = strconv.Atoi(fields["date"][:4])
+	}
+
+	for _, key := range []string{"journal", "journaltitle", "booktitle", "publisher", "school", "institution"} {
+		if v := cleanLatex(fields[key]); v != "" {
+			ref.Venue = v
+			break
+		}
+	}
+
+	authors := fields["author"]
+	if authors == "" {
+		authors = fields["editor"]
+	}
+	for _, author := range bibtexAndPattern.Split(authors, -1) {
+		if name := normalizeAuthor(cleanLatex(author)); name != "" {
+			ref.Authors = append(ref.Authors, name)
+		}
+	}
+
+	ref.Keywords = splitKeywords(cleanLatex(fields["keywords"]))
+	return ref
+}
+
+var bibtexAndPattern = regexp.MustCompile(`\s+and\s+`)
+
+type bibtexParser struct {
+	input  string
+	pos    int
+	macros map[string]string
+}
+
+func (p *bibtexParser) skipSpace() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *bibtexParser) readIdent() string {
+	start := p.pos
+	for p.pos < len(p.input) {
+		c := rune(p.input[p.pos])
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && !strings.ContainsRune("_-:.+/", c) {
+			break
+		}
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+// readDelimited reads a {...} or (...) group, honouring nested braces, and
+// returns its contents.
+func (p *bibtexParser) readDelimited() (string, error) {
+	open := p.input[p.pos]
+	close := byte('}')
+	if open == '(' {
+		close = ')'
+	}
+	depth := 0
+	start := p.pos + 1
+	for ; p.pos < len(p.input); p.pos++ {
+		switch c := p.input[p.pos]; {
+		case c == '{' || (c == open && open == '('):
+			depth++
+		case c == '}' || (c == close && close == ')'):
+			depth--
+			if depth == 0 {
+				p.pos++
+				return p.input[start : p.pos-1], nil
+			}
+		}
+	}
+	return "", fmt.Errorf("unbalanced braces at offset %d", start)
+}
+
+// readFields reads name = value pairs up to the closing brace of an entry.
+func (p *bibtexParser) readFields() (map[string]string, error) {
+	fields := make(map[string]string)
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.input) {
+			return nil, fmt.Errorf("unexpected end of input")
+		}
+		if c := p.input[p.pos]; c == '}' || c == ')' {
+			p.pos++
+			return fields, nil
+		}
+		if p.input[p.pos] == ',' {
+			p.pos++
+			continue
+		}
+
+		name := strings.ToLower(p.readIdent())
+		if name == "" {
+			return nil, fmt.Errorf("expected field name at offset %d", p.pos)
+		}
+		p.skipSpace()
+		if p.pos >= len(p.input) || p.input[p.pos] != '=' {
+			return nil, fmt.Errorf("expected '=' after %s", name)
+		}
+		p.pos++
+
+		value, err := p.readValue()
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", name, err)
+		}
+		fields[name] = value
+	}
+}
+
+// readValue reads a field value, concatenating the parts joined by '#'.
+func (p *bibtexParser) readValue() (string, error) {
+	var parts []string
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.input) {
+			return "", fmt.Errorf("unexpected end of input")
+		}
+
+		switch p.input[p.pos] {
+		case '{':
+			part, err := p.readDelimited()
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, part)
+		case '"':
+			end := p.pos + 1
+			depth := 0
+			for ; end < len(p.input); end++ {
+				c := p.input[end]
+				if c == '{' {
+					depth++
+				} else if c == '}' {
+					depth--
+				} else if c == '"' && depth == 0 && p.input[end-1] != '\\' {
+					break
+				}
+			}
+			if end >= len(p.input) {
+				return "", fmt.Errorf("unterminated string")
+			}
+			parts = append(parts, p.input[p.pos+1:end])
+			p.pos = end + 1
+		default:
+			ident := p.readIdent()
+			if ident == "" {
+				return "", fmt.Errorf("unexpected %q at offset %d", p.input[p.pos], p.pos)
+			}
+			if macro, ok := p.macros[strings.ToLower(ident)]; ok {
+				ident = macro
+			}
+			parts = append(parts, ident)
+		}
+
+		p.skipSpace()
+		if p.pos < len(p.input) && p.input[p.pos] == '#' {
+			p.pos++
+			continue
+		}
+		return strings.Join(parts, ""), nil
+	}
+}
+
+var latexReplacer = strings.NewReplacer(
+	`\&`, "&", `\%`, "%", `\$`, "$", `\_`, "_", `\#`, "#",
+	"---", "—", "--", "–", "~", " ", "{", "", "}", "",
+)
+
+// cleanLatex strips the braces and common escapes BibTeX values carry.
+func cleanLatex(s string) string {
+	s = latexReplacer.Replace(s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// normalizeAuthor turns "Last, First" into "First Last".
+func normalizeAuthor(name string) string {
+	if last, first, ok := strings.Cut(name, ","); ok {
+		return strings.TrimSpace(strings.TrimSpace(first) + " " + strings.TrimSpace(last))
+	}
+	return strings.TrimSpace(name)
+}
+
+func splitKeywords(s string) []string {
+	var keywords []string
+	for _, keyword := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' }) {
+		keyword = strings.TrimSpace(keyword)
+		if keyword != "" && !containsString(keywords, keyword) {
+			keywords = append(keywords, keyword)
+		}
+	}
+	return keywords
+}
+
+type cslName struct {
+	Family  string `json:"family"`
+	Given   string `json:"given"`
+	Literal string `json:"literal"`
+}
+
+type cslItem struct {
+	ID             interface{} `json:"id"`
+	CitationKey    string      `json:"citation-key"`
+	Type           string      `json:"type"`
+	Title          string      `json:"title"`
+	Author         []cslName   `json:"author"`
+	Editor         []cslName   `json:"editor"`
+	ContainerTitle string      `json:"container-title"`
+	Publisher      string      `json:"publisher"`
+	DOI            string      `json:"DOI"`
+	URL            string      `json:"URL"`
+	Keyword        string      `json:"keyword"`
+	Abstract       string      `json:"abstract"`
+	Issued         struct {
+		DateParts [][]interface{} `json:"date-parts"`
+		Raw       string          `json:"raw"`
+	} `json:"issued"`
+}
+
+func parseCSLJSON(data []byte) ([]literatureRef, error) {
+	var items []cslItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+
+	refs := make([]literatureRef, 0, len(items))
+	for _, item := range items {
+		ref := literatureRef{
+			CiteKey:  item.CitationKey,
+			Type:     item.Type,
+			Title:    strings.TrimSpace(item.Title),
+			Venue:    item.ContainerTitle,
+			DOI:      item.DOI,
+			URL:      item.URL,
+			Keywords: splitKeywords(item.Keyword),
+			Abstract: item.Abstract,
+		}
+		if ref.CiteKey == "" && item.ID != nil {
+			ref.CiteKey = fmt.Sprint(item.ID)
+		}
+		if ref.Venue == "" {
+			ref.Venue = item.Publisher
+		}
+
+		names := item.Author
+		if len(names) == 0 {
+			names = item.Editor
+		}
+		for _, name := range names {
+			full := name.Literal
+			if full == "" {
+				full = strings.TrimSpace(name.Given + " " + name.Family)
+			}
+			if full != "" {
+				ref.Authors = append(ref.Authors, full)
+			}
+		}
+
+		if len(item.Issued.DateParts) > 0 && len(item.Issued.DateParts[0]) > 0 {
+			switch year := item.Issued.DateParts[0][0].(type) {
+			case float64:
+				ref.Year = int(year)
+			case string:
+				ref.Year, _ = strconv.Atoi(year)
+			}
+		} else if len(item.Issued.Raw) >= 4 {
+			ref.Year, _ = strconv.Atoi(item.Issued.Raw[:4])
+		}
+
+		refs = append(refs, ref)
+	}
+
+	return refs, nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func newImportLogseqCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "logseq [graph-dir]",
+		Short: "Import pages and journals from a Logseq graph",
+		Long: `Import the pages and journals directories of a Logseq graph.
+
+Page properties (key:: value) become frontmatter, block nesting is kept as
+markdown lists, block references are replaced with the referenced text and
+page references become links and connected_to entries.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return importLogseqGraph(args[0])
+		},
+	}
+}
+
+func importLogseqGraph(graphDir string) error {
+	notesDir := viper.GetString("notes_directory")
+	if notesDir == "" {
+		return fmt.Errorf("notes directory not set in config")
+	}
+
+	var pages []*outlinePage
+	for _, sub := range []string{"pages", "journals"} {
+		dir := filepath.Join(graphDir, sub)
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to read %s: %w", dir, err)
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() || filepath.Ext(entry.Name()) != ".md" {
+				continue
+			}
+			page, err := parseLogseqPage(filepath.Join(dir, entry.Name()), sub == "journals")
+			if err != nil {
+				return fmt.Errorf("failed to parse %s: %w", entry.Name(), err)
+			}
+			pages = append(pages, page)
+		}
+	}
+
+	if len(pages) == 0 {
+		return fmt.Errorf("no Logseq pages found in %s", graphDir)
+	}
+
+	report, err := writeOutlinePages(notesDir, pages)
+	if err != nil {
+		return err
+	}
+	report.print()
+	commitNotes(fmt.Sprintf("Import logseq %s", graphDir), report.paths...)
+	return nil
+}
+
+func parseLogseqPage(path string, journal bool) (*outlinePage, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &outlinePage{
+		Properties: make(map[string]interface{}),
+		Created:    info.ModTime(),
+		Modified:   info.ModTime(),
+		Source:     path,
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), ".md")
+	if d, err := time.Parse("2006_01_02", name); journal && err == nil {
+		page.Title = ordinalDateTitle(d, "Jan")
+		page.Created = d
+	} else {
+		// Namespaced pages are stored as "a___b" or, in older graphs, "a%2Fb".
+		name = strings.ReplaceAll(name, "___", "/")
+		if unescaped, err := url.PathUnescape(name); err == nil {
+			name = unescaped
+		}
+		page.Title = name
+	}
+
+	lines := strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n")
+
+	// Page properties come first, either as bare lines or as the first block.
+	i := 0
+	for ; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+		m := propertyPattern.FindStringSubmatch(strings.TrimPrefix(line, "- "))
+		if m == nil {
+			break
+		}
+		key := normalizePropertyKey(m[1])
+		page.Properties[key] = parsePropertyValue(key, m[2])
+	}
+	if title, ok := page.Properties["title"].(string); ok && title != "" {
+		page.Title = title
+	}
+	delete(page.Properties, "title")
+
+	type frame struct {
+		depth int
+		block *outlineBlock
+	}
+	var stack []frame
+	var current *outlineBlock
+	for ; i < len(lines); i++ {
+		raw := lines[i]
+		trimmed := strings.TrimLeft(raw, " \t")
+		indent := raw[:len(raw)-len(trimmed)]
+		depth := strings.Count(indent, "\t") + strings.Count(indent, " ")/2
+		trimmed = strings.TrimSpace(trimmed)
+
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			b := &outlineBlock{Text: strings.TrimSpace(strings.TrimPrefix(trimmed, "-"))}
+			for len(stack) > 0 && stack[len(stack)-1].depth >= depth {
+				stack = stack[:len(stack)-1]
+			}
+			if len(stack) == 0 {
+				page.Blocks = append(page.Blocks, b)
+			} else {
+				parent := stack[len(stack)-1].block
+				parent.Children = append(parent.Children, b)
+			}
+			stack = append(stack, frame{depth, b})
+			current = b
+			continue
+		}
+
+		if trimmed == "" {
+			continue
+		}
+		if current == nil {
+			// Text before the first bullet becomes a top-level block.
+			page.Blocks = append(page.Blocks, &outlineBlock{Text: trimmed})
+			continue
+		}
+		if m := propertyPattern.FindStringSubmatch(trimmed); m != nil {
+			switch strings.ToLower(m[1]) {
+			case "id":
+				current.UID = strings.TrimSpace(m[2])
+				continue
+			case "collapsed":
+				continue
+			}
+		}
+		if current.Text == "" {
+			current.Text = trimmed
+		} else {
+			current.Text += "\n" + trimmed
+		}
+	}
+
+	return page, nil
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func newImportObsidianCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "obsidian [vault-dir]",
+		Short: "Import every note and attachment from an Obsidian vault",
+		Long: `Import an Obsidian vault into the notes directory.
+
+Titles come from frontmatter, the first H1 or the filename, and dates from
+frontmatter or the file modification time. Inline #tags are moved into
+frontmatter, aliases are kept, wikilinks and embeds are resolved and linked
+notes are recorded in connected_to. Linked attachments are copied into the
+attachments directory, keeping their folders in the vault; an attachment
+that would overwrite an existing file is reported as a conflict.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			attachmentsDir, _ := cmd.Flags().GetString("attachments")
+			return importObsidianVault(args[0], attachmentsDir)
+		},
+	}
+
+	cmd.Flags().String("attachments", "attachments", "Directory inside the notes directory for attachments")
+
+	return cmd
+}
+
+type obsidianNote struct {
+	srcPath     string
+	title       string
+	frontmatter map[string]interface{}
+	body        string
+	destPath    string
+}
+
+var (
+	inlineTagPattern  = regexp.MustCompile(`(?:^|[\s(])#([\p{L}\p{N}_/-]*[\p{L}_/-][\p{L}\p{N}_/-]*)`)
+	fencedCodePattern = regexp.MustCompile("(?s)(```|~~~).*?(```|~~~)")
+	inlineCodePattern = regexp.MustCompile("`[^`\n]*`")
+)
+
+func importObsidianVault(vaultDir, attachmentsDir string) error {
+	notesDir := viper.GetString("notes_directory")
+	if notesDir == "" {
+		return fmt.Errorf("notes directory not set in config")
+	}
+
+	var notes []*obsidianNote
+	attachments := make(map[string]string)
+	err := filepath.Walk(vaultDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			// Skip .obsidian, .trash and other hidden folders.
+			if path != vaultDir && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+		if filepath.Ext(path) != ".md" {
+			rel, _ := filepath.Rel(vaultDir, path)
+			attachments[strings.ToLower(info.Name())] = path
+			attachments[strings.ToLower(filepath.ToSlash(rel))] = path
+			return nil
+		}
+
+		note, err := readObsidianNote(path, info)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		notes = append(notes, note)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to scan vault: %w", err)
+	}
+
+	// Obsidian resolves links by file name, relative path or alias.
+	lookup := make(map[string]*obsidianNote)
+	aliasKeys := make(map[string]bool)
+	for _, note := range notes {
+		rel, _ := filepath.Rel(vaultDir, note.srcPath)
+		lookup[noteKey(filepath.ToSlash(rel))] = note
+		for _, alias := range stringList(note.frontmatter["aliases"]) {
+			lookup[noteKey(alias)] = note
+			aliasKeys[noteKey(alias)] = true
+		}
+	}
+	for _, note := range notes {
+		lookup[noteKey(strings.TrimSuffix(filepath.Base(note.srcPath), ".md"))] = note
+	}
+
+	report := newImportReport()
+	claimed := make(map[string]string)
+	for _, note := range notes {
+		note.destPath = filepath.Join(notesDir, generateFilename(note.title))
+		if other, ok := claimed[note.destPath]; ok {
+			report.conflict(note.srcPath, fmt.Sprintf("same title as %s", other))
+			note.destPath = ""
+			continue
+		}
+		if fileExists(note.destPath) {
+			report.conflict(note.srcPath, fmt.Sprintf("%s already exists", note.destPath))
+			note.destPath = ""
+			continue
+		}
+		claimed[note.destPath] = note.srcPath
+	}
+
+	// Attachments keep their path in the vault, so files with the same name
+	// in different folders do not overwrite each other. copiedTo maps a
+	// source file to its link target, or to "" when it was not copied.
+	copiedTo := make(map[string]string)
+	var copyErr error
+	copyAttachment := func(src string) string {
+		if target, ok := copiedTo[src]; ok {
+			return target
+		}
+		copiedTo[src] = ""
+		rel, err := filepath.Rel(vaultDir, src)
+		if err != nil {
+			copyErr = fmt.Errorf("failed to copy attachment %s: %w", src, err)
+			return ""
+		}
+		target := filepath.Join(attachmentsDir, rel)
+		dest := filepath.Join(notesDir, target)
+		if fileExists(dest) {
+			report.conflict(src, fmt.Sprintf("%s already exists", dest))
+			return ""
+		}
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			copyErr = fmt.Errorf("failed to copy attachment %s: %w", src, err)
+			return ""
+		}
+		if err := copyFile(src, dest); err != nil {
+			copyErr = fmt.Errorf("failed to copy attachment %s: %w", src, err)
+			return ""
+		}
+		report.attachment(dest)
+		copiedTo[src] = filepath.ToSlash(target)
+		return copiedTo[src]
+	}
+
+	for _, note := range notes {
+		if note.destPath == "" {
+			continue
+		}
+
+		var connections []string
+		body := replaceWikilinks(note.body, func(link wikilink) string {
+			if target, ok := lookup[noteKey(link.Target)]; ok && link.Target != "" {
+				if !link.Embed && target != note && !containsString(connections, target.title) {
+					connections = append(connections, target.title)
+				}
+				label := link.Label
+				if label == "" && aliasKeys[noteKey(link.Target)] {
+					// Keep showing the alias the author wrote.
+					label = link.Target
+				}
+				return formatWikilink(wikilink{Target: target.title, Heading: link.Heading, Label: label, Embed: link.Embed})
+			}
+			if src, ok := attachments[strings.ToLower(filepath.ToSlash(link.Target))]; ok {
+				if target := copyAttachment(src); target != "" {
+					return formatWikilink(wikilink{Target: target, Label: link.Label, Embed: link.Embed})
+				}
+				return formatWikilink(link)
+			}
+			if link.Target != "" {
+				report.unresolved(note.title, link.Target)
+			}
+			return formatWikilink(link)
+		})
+		if copyErr != nil {
+			return copyErr
+		}
+
+		if len(connections) > 0 {
+			existing := stringList(note.frontmatter["connected_to"])
+			for _, conn := range connections {
+				if !containsString(existing, conn) {
+					existing = append(existing, conn)
+				}
+			}
+			note.frontmatter["connected_to"] = existing
+		}
+
+		if err := writeNoteFile(note.destPath, note.frontmatter, body); err != nil {
+			return fmt.Errorf("failed to import %s: %w", note.srcPath, err)
+		}
+		report.imported(note.title, note.destPath)
+	}
+
+	report.print()
+	commitNotes(fmt.Sprintf("Import obsidian %s", vaultDir), report.paths...)
+	return nil
+}
+
+// readObsidianNote reads a vault file and fills in the frontmatter kg
+// requires. Obsidian notes often have no frontmatter at all.
+func readObsidianNote(path string, info os.FileInfo) (*obsidianNote, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	frontmatter := map[string]interface{}{}
+	body := string(content)
+	if strings.HasPrefix(body, "---\n") || strings.HasPrefix(body, "---\r\n") {
+		fm, rest, err := parseFrontmatter(body)
+		if err != nil {
+			return nil, err
+		}
+		if fm != nil {
+			frontmatter = fm
+		}
+		body = rest
+	}
+
+	title, _ := frontmatter["title"].(string)
+	if title == "" {
+		title = firstHeading(body)
+	}
+	if title == "" {
+		title = strings.TrimSuffix(info.Name(), ".md")
+	}
+	frontmatter["title"] = title
+
+	if _, ok := frontmatter["date"]; !ok {
+		frontmatter["date"] = info.ModTime().Format("2006-01-02")
+	}
+	if _, ok := frontmatter["lastmod"]; !ok {
+		frontmatter["lastmod"] = info.ModTime().Format("2006-01-02")
+	}
+
+	if alias, ok := frontmatter["alias"]; ok {
+		frontmatter["aliases"] = append(stringList(frontmatter["aliases"]), stringList(alias)...)
+		delete(frontmatter, "alias")
+	}
+	if aliases, ok := frontmatter["aliases"]; ok {
+		frontmatter["aliases"] = stringList(aliases)
+	}
+
+	tags := stringList(frontmatter["tags"])
+	for i, tag := range tags {
+		tags[i] = strings.TrimPrefix(tag, "#")
+	}
+	for _, tag := range extractInlineTags(body) {
+		if !containsString(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) > 0 {
+		frontmatter["tags"] = tags
+	}
+
+	return &obsidianNote{
+		srcPath:     path,
+		title:       title,
+		frontmatter: frontmatter,
+		body:        body,
+	}, nil
+}
+
+// firstHeading returns the text of the first level-one heading in body.
+func firstHeading(body string) string {
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, "# ") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "# "))
+		}
+	}
+	return ""
+}
+
+// extractInlineTags finds #tags in the body, ignoring code and headings.
+func extractInlineTags(body string) []string {
+	body = fencedCodePattern.ReplaceAllString(body, "")
+	body = inlineCodePattern.ReplaceAllString(body, "")
+
+	var tags []string
+	for _, m := range inlineTagPattern.FindAllStringSubmatch(body, -1) {
+		tag := strings.Trim(m[1], "/")
+		if tag != "" && !containsString(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func formatWikilink(link wikilink) string {
+	s := link.Target
+	if link.Heading != "" {
+		s += "#" + link.Heading
+	}
+	if link.Label != "" {
+		s += "|" + link.Label
+	}
+	if link.Embed {
+		return "![[" + s + "]]"
+	}
+	return "[[" + s + "]]"
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func newImportRoamCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "roam [export.json]",
+		Short: "Import pages from a Roam Research JSON export",
+		Long: `Import every page of a Roam Research JSON export.
+
+Top-level attributes (key:: value) become frontmatter, block nesting is kept
+as markdown lists, block references are replaced with the referenced text
+and page references become links and connected_to entries.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return importRoamExport(args[0])
+		},
+	}
+}
+
+type roamBlock struct {
+	String     string      `json:"string"`
+	UID        string      `json:"uid"`
+	Children   []roamBlock `json:"children"`
+	CreateTime int64       `json:"create-time"`
+	EditTime   int64       `json:"edit-time"`
+}
+
+type roamPage struct {
+	Title      string      `json:"title"`
+	UID        string      `json:"uid"`
+	Children   []roamBlock `json:"children"`
+	CreateTime int64       `json:"create-time"`
+	EditTime   int64       `json:"edit-time"`
+}
+
+var roamMacroReplacer = strings.NewReplacer(
+	"{{[[TODO]]}}", "TODO",
+	"{{TODO}}", "TODO",
+	"{{[[DONE]]}}", "DONE",
+	"{{DONE}}", "DONE",
+)
+
+func importRoamExport(exportPath string) error {
+	notesDir := viper.GetString("notes_directory")
+	if notesDir == "" {
+		return fmt.Errorf("notes directory not set in config")
+	}
+
+	data, err := os.ReadFile(exportPath)
+	if err != nil {
+		return fmt.Errorf("failed to read export: %w", err)
+	}
+
+	var roamPages []roamPage
+	if err := json.Unmarshal(data, &roamPages); err != nil {
+		return fmt.Errorf("failed to parse Roam export: %w", err)
+	}
+
+	pages := make([]*outlinePage, 0, len(roamPages))
+	for _, rp := range roamPages {
+		if strings.TrimSpace(rp.Title) == "" {
+			continue
+		}
+		pages = append(pages, convertRoamPage(rp, exportPath))
+	}
+
+	report, err := writeOutlinePages(notesDir, pages)
+	if err != nil {
+		return err
+	}
+	report.print()
+	commitNotes(fmt.Sprintf("Import roam %s", exportPath), report.paths...)
+	return nil
+}
+
+func convertRoamPage(rp roamPage, source string) *outlinePage {
+	page := &outlinePage{
+		Title:      rp.Title,
+		Properties: make(map[string]interface{}),
+		Source:     fmt.Sprintf("%s (%s)", source, rp.Title),
+	}
+
+	var created, modified int64 = rp.CreateTime, rp.EditTime
+	var convert func(blocks []roamBlock) []*outlineBlock
+	convert = func(blocks []roamBlock) []*outlineBlock {
+		var out []*outlineBlock
+		for _, rb := range blocks {
+			if rb.CreateTime > 0 && (created == 0 || rb.CreateTime < created) {
+				created = rb.CreateTime
+			}
+			if rb.EditTime > modified {
+				modified = rb.EditTime
+			}
+			out = append(out, &outlineBlock{
+				Text:     roamMacroReplacer.Replace(rb.String),
+				UID:      rb.UID,
+				Children: convert(rb.Children),
+			})
+		}
+		return out
+	}
+
+	// Leaf attributes at the top of the page describe the page itself; once
+	// another block appears, attributes are just content.
+	blocks := convert(rp.Children)
+	for len(blocks) > 0 {
+		b := blocks[0]
+		m := propertyPattern.FindStringSubmatch(b.Text)
+		if m == nil || len(b.Children) > 0 || strings.Contains(b.Text, "\n") {
+			break
+		}
+		key := normalizePropertyKey(m[1])
+		page.Properties[key] = parsePropertyValue(key, m[2])
+		blocks = blocks[1:]
+	}
+	page.Blocks = blocks
+
+	switch d, ok := parseOrdinalDate(rp.Title); {
+	case ok:
+		page.Created = d
+	case created > 0:
+		page.Created = time.UnixMilli(created)
+	default:
+		page.Created = time.Now()
+	}
+	if modified > 0 {
+		page.Modified = time.UnixMilli(modified)
+	} else {
+		page.Modified = page.Created
+	}
+
+	return page
+}
@@ -32,6 +32,7 @@ type NoteInfo struct {
 	Title    string
 	Filename string
 	Tags     []string
+	Summary  string
 	Date     time.Time
 	LastMod  time.Time
 }
@@ -113,6 +114,10 @@ func parseNoteInfo(path string) (NoteInfo, error) {
 		}
 	}
 
+	if summary, ok := frontmatter["summary"].(string); ok {
+		note.Summary = summary
+	}
+
 	if date, ok := frontmatter["date"].(string); ok {
 		note.Date, _ = time.Parse("2006-01-02", date)
 	}
@@ -162,16 +167,17 @@ func filterNotes(notes []NoteInfo, tag string) []NoteInfo {
 
 func displayNotes(notes []NoteInfo) {
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "Title\tFilename\tTags\tDate\tLast Modified")
-	fmt.Fprintln(w, "-----\t--------\t----\t----\t-------------")
+	fmt.Fprintln(w, "Title\tFilename\tTags\tDate\tLast Modified\tSummary")
+	fmt.Fprintln(w, "-----\t--------\t----\t----\t-------------\t-------")
 
 	for _, note := range notes {
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
 			note.Title,
 			note.Filename,
 			strings.Join(note.Tags, ", "),
 			note.Date.Format("2006-01-02"),
 			note.LastMod.Format("2006-01-02"),
+			excerpt(note.Summary, 80),
 		)
 	}
 
@@ -0,0 +1,624 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+)
+
+func newPublishCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "publish [outdir]",
+		Short: "Render the vault as a static HTML site",
+		Long: `Render every note to HTML with wikilinks and connections turned into
+hyperlinks, plus tag index pages, backlinks, a client-side search page and a
+graph page. Note pages mirror the folders of the vault. Notes with
+"draft: true" in their frontmatter are skipped.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			templatePath, _ := cmd.Flags().GetString("template")
+			siteTitle, _ := cmd.Flags().GetString("title")
+			includeDrafts, _ := cmd.Flags().GetBool("include-drafts")
+			return publishSite(args[0], publishOptions{
+				TemplatePath:  templatePath,
+				SiteTitle:     siteTitle,
+				IncludeDrafts: includeDrafts,
+			})
+		},
+	}
+
+	cmd.Flags().String("template", "", "Custom HTML template for note pages")
+	cmd.Flags().String("title", "Knowledge Graph", "Site title")
+	cmd.Flags().Bool("include-drafts", false, "Publish notes marked as drafts")
+
+	return cmd
+}
+
+type publishOptions struct {
+	TemplatePath  string
+	SiteTitle     string
+	IncludeDrafts bool
+}
+
+// publishLink is a hyperlink to another page of the published site,
+// relative to the site root.
+type publishLink struct {
+	Title string
+	URL   string
+	Rel   string
+}
+
+type publishedNote struct {
+	Title string
+	// URL mirrors the note's path in the vault, so notes with the same
+	// file name in different folders get pages of their own.
+	URL         string
+	Date        string
+	Tags        []publishLink
+	HTML        template.HTML
+	Connections []publishLink
+	Backlinks   []publishLink
+
+	note Note
+	root string
+}
+
+// publishPage is the data every template is executed with. Root is the
+// relative path back to the site root from the page being rendered.
+type publishPage struct {
+	SiteTitle string
+	Title     string
+	Root      string
+	Note      *publishedNote
+	Notes     []*publishedNote
+	Tags      []publishTag
+	Tag       *publishTag
+}
+
+type publishTag struct {
+	Name  string
+	URL   string
+	Notes []publishLink
+}
+
+func publishSite(outDir string, opts publishOptions) error {
+	notesDir := viper.GetString("notes_directory")
+	if notesDir == "" {
+		return fmt.Errorf("notes directory not set in config")
+	}
+
+	var published []Note
+	var paths []string
+	skipped := 0
+	err := walkNotes(notesDir, func(path string, note Note) error {
+		if isDraft(note) && !opts.IncludeDrafts {
+			skipped++
+			return nil
+		}
+		published = append(published, note)
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load notes: %w", err)
+	}
+
+	tmpl, err := template.New("site").Funcs(template.FuncMap{
+		"url":  func(root, url string) string { return root + url },
+		"urls": rootLinks,
+	}).Parse(publishTemplates)
+	if err != nil {
+		return fmt.Errorf("failed to parse templates: %w", err)
+	}
+	if opts.TemplatePath != "" {
+		if err := parseCustomTemplate(tmpl, opts.TemplatePath); err != nil {
+			return err
+		}
+	}
+
+	site, err := buildSite(notesDir, published, paths)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Join(outDir, "tags"), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	page := publishPage{SiteTitle: opts.SiteTitle, Notes: site.notes, Tags: site.tags}
+
+	for _, note := range site.notes {
+		p := page
+		p.Title = note.Title
+		p.Root = note.root
+		p.Note = note
+		dest := filepath.Join(outDir, filepath.FromSlash(note.URL))
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+		if err := renderPage(tmpl, "note", p, dest); err != nil {
+			return err
+		}
+	}
+
+	for i := range site.tags {
+		p := page
+		p.Title = "#" + site.tags[i].Name
+		p.Root = "../"
+		p.Tag = &site.tags[i]
+		if err := renderPage(tmpl, "tag", p, filepath.Join(outDir, site.tags[i].URL)); err != nil {
+			return err
+		}
+	}
+
+	pages := []struct{ name, title, file string }{
+		{"index", opts.SiteTitle, "index.html"},
+		{"tags", "Tags", "tags.html"},
+		{"search", "Search", "search.html"},
+		{"graph", "Graph", "graph.html"},
+	}
+	for _, pg := range pages {
+		p := page
+		p.Title = pg.title
+		if err := renderPage(tmpl, pg.name, p, filepath.Join(outDir, pg.file)); err != nil {
+			return err
+		}
+	}
+
+	if err := writeSearchIndex(outDir, site.notes); err != nil {
+		return err
+	}
+	if err := writeGraphData(outDir, site.notes); err != nil {
+		return err
+	}
+	if err := copyAttachments(outDir, site.attachments); err != nil {
+		return err
+	}
+
+	fmt.Printf("Published %d notes to %s (%d drafts skipped)\n", len(site.notes), outDir, skipped)
+	return nil
+}
+
+// parseCustomTemplate overrides the built-in templates with the ones in
+// path. A file without any {{define}} blocks replaces the note page.
+func parseCustomTemplate(tmpl *template.Template, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read template: %w", err)
+	}
+	if strings.Contains(string(data), "{{define") {
+		_, err = tmpl.Parse(string(data))
+	} else {
+		_, err = tmpl.New("note").Parse(string(data))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse template %s: %w", path, err)
+	}
+	return nil
+}
+
+func isDraft(note Note) bool {
+	switch draft := note.Frontmatter["draft"].(type) {
+	case bool:
+		return draft
+	case string:
+		return strings.EqualFold(draft, "true")
+	}
+	return false
+}
+
+// noteURL returns the page for the note at rel, a path relative to the
+// notes directory.
+func noteURL(rel string) string {
+	rel = filepath.ToSlash(rel)
+	return strings.TrimSuffix(rel, filepath.Ext(rel)) + ".html"
+}
+
+// pageRoot returns the relative path back to the site root from the page
+// at url.
+func pageRoot(url string) string {
+	return strings.Repeat("../", strings.Count(url, "/"))
+}
+
+// rootLinks returns links with root prepended to their URLs, for pages
+// below the site root.
+func rootLinks(root string, links []publishLink) []publishLink {
+	if root == "" {
+		return links
+	}
+	out := make([]publishLink, len(links))
+	for i, link := range links {
+		out[i] = link
+		if link.URL != "" {
+			out[i].URL = root + link.URL
+		}
+	}
+	return out
+}
+
+func tagURL(tag string) string {
+	return "tags/" + strings.ReplaceAll(noteKey(tag), "/", "-") + ".html"
+}
+
+type publishedSite struct {
+	notes []*publishedNote
+	tags  []publishTag
+	// attachments maps an output path under files/ to its source file.
+	attachments map[string]string
+}
+
+func buildSite(notesDir string, notes []Note, paths []string) (*publishedSite, error) {
+	site := &publishedSite{attachments: make(map[string]string)}
+	index := buildNoteIndex(notes)
+
+	byIndex := make(map[int]*publishedNote, len(notes))
+	for i, note := range notes {
+		rel, err := filepath.Rel(notesDir, paths[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to publish %s: %w", paths[i], err)
+		}
+		pn := &publishedNote{
+			Title: note.Title,
+			URL:   noteURL(rel),
+			Date:  formatFieldValue(note.Frontmatter["date"]),
+			note:  note,
+			root:  pageRoot(noteURL(rel)),
+		}
+		byIndex[i] = pn
+		site.notes = append(site.notes, pn)
+	}
+	sort.Slice(site.notes, func(i, j int) bool {
+		return strings.ToLower(site.notes[i].Title) < strings.ToLower(site.notes[j].Title)
+	})
+
+	files, err := attachmentFiles(notesDir)
+	if err != nil {
+		return nil, err
+	}
+
+	md := goldmark.New(
+		goldmark.WithExtensions(extension.GFM),
+		goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+	)
+	tagNotes := make(map[string][]publishLink)
+	backlinks := make(map[*publishedNote]map[*publishedNote]bool)
+	addBacklink := func(from, to *publishedNote) {
+		if from == to {
+			return
+		}
+		if backlinks[to] == nil {
+			backlinks[to] = make(map[*publishedNote]bool)
+		}
+		backlinks[to][from] = true
+	}
+
+	for _, pn := range site.notes {
+		for _, tag := range stringList(pn.note.Frontmatter["tags"]) {
+			pn.Tags = append(pn.Tags, publishLink{Title: tag, URL: tagURL(tag)})
+			tagNotes[tag] = append(tagNotes[tag], publishLink{Title: pn.Title, URL: pn.URL})
+		}
+
+		for _, rel := range pn.note.Relations {
+			link := publishLink{Title: rel.Target, Rel: rel.Type}
+			if rel.Type == defaultRelation {
+				link.Rel = ""
+			}
+			if i, ok := index[noteKey(rel.Target)]; ok && byIndex[i] != nil {
+				target := byIndex[i]
+				link.Title, link.URL = target.Title, target.URL
+				addBacklink(pn, target)
+			}
+			pn.Connections = append(pn.Connections, link)
+		}
+
+		body := replaceWikilinks(pn.note.Content, func(link wikilink) string {
+			label := link.Label
+			if label == "" {
+				label = link.Target
+			}
+			if i, ok := index[noteKey(link.Target)]; ok && byIndex[i] != nil {
+				target := byIndex[i]
+				addBacklink(pn, target)
+				url := pn.root + target.URL
+				if link.Heading != "" {
+					url += "#" + noteKey(link.Heading)
+				}
+				return fmt.Sprintf("[%s](%s)", label, url)
+			}
+			if src, ok := files[strings.ToLower(filepath.Base(link.Target))]; ok {
+				out := "files/" + filepath.Base(src)
+				site.attachments[out] = src
+				if link.Embed {
+					return fmt.Sprintf("![%s](%s)", label, pn.root+out)
+				}
+				return fmt.Sprintf("[%s](%s)", label, pn.root+out)
+			}
+			// Unresolved links and links to drafts are rendered as text.
+			return label
+		})
+
+		var buf bytes.Buffer
+		if err := md.Convert([]byte(body), &buf); err != nil {
+			return nil, fmt.Errorf("failed to render %s: %w", pn.note.Filename, err)
+		}
+		pn.HTML = template.HTML(buf.String())
+	}
+
+	for _, pn := range site.notes {
+		for from := range backlinks[pn] {
+			pn.Backlinks = append(pn.Backlinks, publishLink{Title: from.Title, URL: from.URL})
+		}
+		sort.Slice(pn.Backlinks, func(i, j int) bool { return pn.Backlinks[i].Title < pn.Backlinks[j].Title })
+	}
+
+	for tag, links := range tagNotes {
+		site.tags = append(site.tags, publishTag{Name: tag, URL: tagURL(tag), Notes: links})
+	}
+	sort.Slice(site.tags, func(i, j int) bool { return site.tags[i].Name < site.tags[j].Name })
+
+	return site, nil
+}
+
+// attachmentFiles indexes the non-markdown files in the vault by lowercased
+// base name, which is how wikilinks and embeds refer to them.
+func attachmentFiles(notesDir string) (map[string]string, error) {
+	files := make(map[string]string)
+	err := filepath.Walk(notesDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != notesDir && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".md" && !strings.HasPrefix(info.Name(), ".") {
+			files[strings.ToLower(info.Name())] = path
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan attachments: %w", err)
+	}
+	return files, nil
+}
+
+func copyAttachments(outDir string, attachments map[string]string) error {
+	if len(attachments) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Join(outDir, "files"), 0755); err != nil {
+		return fmt.Errorf("failed to create attachments directory: %w", err)
+	}
+	for out, src := range attachments {
+		if err := copyFile(src, filepath.Join(outDir, out)); err != nil {
+			return fmt.Errorf("failed to copy attachment %s: %w", src, err)
+		}
+	}
+	return nil
+}
+
+func renderPage(tmpl *template.Template, name string, page publishPage, path string) error {
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, name, page); err != nil {
+		return fmt.Errorf("failed to render %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeSearchIndex writes the client-side search index as a script so the
+// published site also works when opened straight from disk.
+func writeSearchIndex(outDir string, notes []*publishedNote) error {
+	type entry struct {
+		Title string   `json:"title"`
+		URL   string   `json:"url"`
+		Tags  []string `json:"tags"`
+		Text  string   `json:"text"`
+	}
+
+	entries := make([]entry, 0, len(notes))
+	for _, pn := range notes {
+		entries = append(entries, entry{
+			Title: pn.Title,
+			URL:   pn.URL,
+			Tags:  stringList(pn.note.Frontmatter["tags"]),
+			Text:  pn.note.Content,
+		})
+	}
+
+	return writeScriptData(filepath.Join(outDir, "search-index.js"), "kgSearchIndex", entries)
+}
+
+func writeGraphData(outDir string, notes []*publishedNote) error {
+	type node struct {
+		ID    string `json:"id"`
+		Title string `json:"title"`
+	}
+	type edge struct {
+		Source string `json:"source"`
+		Target string `json:"target"`
+		Type   string `json:"type"`
+	}
+
+	data := struct {
+		Nodes []node `json:"nodes"`
+		Edges []edge `json:"edges"`
+	}{Nodes: []node{}, Edges: []edge{}}
+
+	// A relation and its inverse on the other note are drawn as one edge.
+	vocab := relationVocabularyFromConfig()
+	seen := make(map[edge]bool)
+	for _, pn := range notes {
+		data.Nodes = append(data.Nodes, node{ID: pn.URL, Title: pn.Title})
+		for _, conn := range pn.Connections {
+			if conn.URL == "" {
+				continue
+			}
+			rel := conn.Rel
+			if rel == "" {
+				rel = defaultRelation
+			}
+			var e edge
+			e.Source, e.Type, e.Target = vocab.Canonical(pn.URL, rel, conn.URL)
+			if !seen[e] {
+				seen[e] = true
+				data.Edges = append(data.Edges, e)
+			}
+		}
+	}
+
+	return writeScriptData(filepath.Join(outDir, "graph-data.js"), "kgGraph", data)
+}
+
+func writeScriptData(path, name string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", name, err)
+	}
+	script := fmt.Sprintf("window.%s = %s;\n", name, data)
+	if err := os.WriteFile(path, []byte(script), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+const publishTemplates = `
+{{define "header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} - {{.SiteTitle}}</title>
+<style>
+body { font-family: sans-serif; max-width: 48em; margin: 2em auto; padding: 0 1em; line-height: 1.5; }
+nav a { margin-right: 1em; }
+.tags a { margin-right: .5em; }
+aside { border-top: 1px solid #ccc; margin-top: 2em; }
+.rel { color: #666; font-size: .85em; }
+</style>
+</head>
+<body>
+<nav><a href="{{url .Root "index.html"}}">{{.SiteTitle}}</a><a href="{{url .Root "tags.html"}}">Tags</a><a href="{{url .Root "search.html"}}">Search</a><a href="{{url .Root "graph.html"}}">Graph</a></nav>
+{{end}}
+
+{{define "footer"}}</body>
+</html>
+{{end}}
+
+{{define "links"}}<ul>{{range .}}<li>{{if .Rel}}<span class="rel">{{.Rel}}</span> {{end}}{{if .URL}}<a href="{{.URL}}">{{.Title}}</a>{{else}}{{.Title}}{{end}}</li>{{end}}</ul>{{end}}
+
+{{define "note"}}{{template "header" .}}
+<article>
+{{with .Note}}<p class="tags">{{.Date}} {{range .Tags}}<a href="{{url $.Root .URL}}">#{{.Title}}</a>{{end}}</p>
+{{.HTML}}
+{{if .Connections}}<aside><h2>Connections</h2>{{template "links" urls $.Root .Connections}}</aside>{{end}}
+{{if .Backlinks}}<aside><h2>Backlinks</h2>{{template "links" urls $.Root .Backlinks}}</aside>{{end}}{{end}}
+</article>
+{{template "footer" .}}{{end}}
+
+{{define "index"}}{{template "header" .}}
+<h1>{{.SiteTitle}}</h1>
+<ul>{{range .Notes}}<li><a href="{{.URL}}">{{.Title}}</a></li>{{end}}</ul>
+{{template "footer" .}}{{end}}
+
+{{define "tags"}}{{template "header" .}}
+<h1>Tags</h1>
+<ul>{{range .Tags}}<li><a href="{{.URL}}">#{{.Name}}</a> ({{len .Notes}})</li>{{end}}</ul>
+{{template "footer" .}}{{end}}
+
+{{define "tag"}}{{template "header" .}}
+<h1>#{{.Tag.Name}}</h1>
+<ul>{{range .Tag.Notes}}<li><a href="{{url $.Root .URL}}">{{.Title}}</a></li>{{end}}</ul>
+{{template "footer" .}}{{end}}
+
+{{define "search"}}{{template "header" .}}
+<h1>Search</h1>
+<input id="q" type="search" placeholder="Search notes" autofocus>
+<ul id="results"></ul>
+<script src="search-index.js"></script>
+<script>
+document.getElementById("q").addEventListener("input", function () {
+  var terms = this.value.toLowerCase().split(/\s+/).filter(Boolean);
+  var results = document.getElementById("results");
+  results.innerHTML = "";
+  if (!terms.length) return;
+  window.kgSearchIndex.filter(function (n) {
+    var text = (n.title + " " + n.tags.join(" ") + " " + n.text).toLowerCase();
+    return terms.every(function (t) { return text.indexOf(t) >= 0; });
+  }).forEach(function (n) {
+    var li = document.createElement("li"), a = document.createElement("a");
+    a.href = n.url;
+    a.textContent = n.title;
+    li.appendChild(a);
+    results.appendChild(li);
+  });
+});
+</script>
+{{template "footer" .}}{{end}}
+
+{{define "graph"}}{{template "header" .}}
+<h1>Graph</h1>
+<svg id="graph" width="800" height="600"></svg>
+<script src="graph-data.js"></script>
+<script>
+(function () {
+  var svg = document.getElementById("graph"), ns = "http://www.w3.org/2000/svg";
+  var W = 800, H = 600, g = window.kgGraph, byId = {};
+  g.nodes.forEach(function (n) {
+    n.x = W / 2 + (Math.random() - .5) * W / 2;
+    n.y = H / 2 + (Math.random() - .5) * H / 2;
+    byId[n.id] = n;
+  });
+  for (var step = 0; step < 300; step++) {
+    g.nodes.forEach(function (a) {
+      g.nodes.forEach(function (b) {
+        if (a === b) return;
+        var dx = a.x - b.x, dy = a.y - b.y, d2 = dx * dx + dy * dy + .01;
+        a.x += dx / d2 * 50; a.y += dy / d2 * 50;
+      });
+      a.x += (W / 2 - a.x) * .01; a.y += (H / 2 - a.y) * .01;
+    });
+    g.edges.forEach(function (e) {
+      var s = byId[e.source], t = byId[e.target], dx = t.x - s.x, dy = t.y - s.y;
+      s.x += dx * .02; s.y += dy * .02; t.x -= dx * .02; t.y -= dy * .02;
+    });
+  }
+  g.edges.forEach(function (e) {
+    var s = byId[e.source], t = byId[e.target], l = document.createElementNS(ns, "line");
+    l.setAttribute("x1", s.x); l.setAttribute("y1", s.y);
+    l.setAttribute("x2", t.x); l.setAttribute("y2", t.y);
+    l.setAttribute("stroke", "#999");
+    if (e.type !== "connected_to") {
+      var title = document.createElementNS(ns, "title");
+      title.textContent = e.type;
+      l.appendChild(title);
+      l.setAttribute("stroke-dasharray", "4 2");
+    }
+    svg.appendChild(l);
+  });
+  g.nodes.forEach(function (n) {
+    var a = document.createElementNS(ns, "a"), c = document.createElementNS(ns, "circle"), t = document.createElementNS(ns, "text");
+    a.setAttribute("href", n.id);
+    c.setAttribute("cx", n.x); c.setAttribute("cy", n.y); c.setAttribute("r", 5);
+    t.setAttribute("x", n.x + 7); t.setAttribute("y", n.y + 4); t.setAttribute("font-size", 11);
+    t.textContent = n.title;
+    a.appendChild(c); a.appendChild(t); svg.appendChild(a);
+  });
+})();
+</script>
+{{template "footer" .}}{{end}}
+`
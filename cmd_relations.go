@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func newRelationsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:               "relations [title]",
+		Short:             "List a note's relations in both directions",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeNotes(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listRelations(args[0])
+		},
+	}
+}
+
+func listRelations(title string) error {
+	store, err := openEdgeStore(viper.GetString("notes_directory"))
+	if err != nil {
+		return err
+	}
+
+	note, path, err := store.Note(title)
+	if err != nil {
+		return err
+	}
+	edges, err := store.List(path)
+	if err != nil {
+		return err
+	}
+	if len(edges) == 0 {
+		fmt.Printf("'%s' has no relations\n", note.Title)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Source\tRelation\tTarget")
+	fmt.Fprintln(w, "------\t--------\t------")
+	for _, e := range edges {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", e.Source, e.Type, e.Target)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,542 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/tmc/langchaingo/llms/openai"
+	"gopkg.in/yaml.v3"
+)
+
+func newRetagCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "retag",
+		Short: "Suggest new tags for existing notes with AI",
+		Long: `Run AI tag suggestion over existing notes, optionally narrowed with
+--filter, and produce a changeset of proposed tags. By default each change is
+reviewed interactively and the accepted ones applied; with -o the changeset
+is written as a YAML file instead, to be edited and applied later with
+--apply. Changes are applied all together or not at all, and notes edited
+since the changeset was made are refused.
+
+Suggestions are saved as they arrive, so an interrupted run resumes where it
+stopped when run again with the same filter.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			apply, _ := cmd.Flags().GetString("apply")
+			if apply != "" {
+				return applyRetagFile(apply)
+			}
+
+			filter, _ := cmd.Flags().GetString("filter")
+			concurrency, _ := cmd.Flags().GetInt("concurrency")
+			rate, _ := cmd.Flags().GetInt("rate")
+			output, _ := cmd.Flags().GetString("output")
+			restart, _ := cmd.Flags().GetBool("restart")
+
+			if concurrency < 1 {
+				return fmt.Errorf("concurrency must be at least 1")
+			}
+
+			return retagNotes(retagOptions{
+				Filter:      filter,
+				Concurrency: concurrency,
+				Rate:        rate,
+				Output:      output,
+				Restart:     restart,
+			})
+		},
+	}
+
+	cmd.Flags().StringP("filter", "f", "", "Only retag notes matching this search query")
+	cmd.Flags().IntP("concurrency", "j", 4, "Number of notes to process at once")
+	cmd.Flags().Int("rate", 60, "Maximum requests per minute (0 for no limit)")
+	cmd.Flags().StringP("output", "o", "", "Write the changeset to this YAML file instead of reviewing it")
+	cmd.Flags().String("apply", "", "Apply a changeset file written with -o")
+	cmd.Flags().Bool("restart", false, "Discard the progress of an interrupted run")
+
+	return cmd
+}
+
+type retagOptions struct {
+	Filter      string
+	Concurrency int
+	Rate        int
+	Output      string
+	Restart     bool
+}
+
+// tagChange is a proposed change to the tags of one note. Hash is of the
+// note file when the change was proposed, so that a change is not applied
+// over edits made since.
+type tagChange struct {
+	Note string   `yaml:"note"`
+	File string   `yaml:"file"`
+	Hash string   `yaml:"hash"`
+	From []string `yaml:"from,flow"`
+	To   []string `yaml:"to,flow"`
+}
+
+// tagChangeset is the YAML patch file written by 'kg retag -o', and the
+// progress file of a run in .kg/retag-progress.yaml.
+type tagChangeset struct {
+	Filter  string      `yaml:"filter,omitempty"`
+	Changes []tagChange `yaml:"changes"`
+}
+
+func retagProgressPath(notesDir string) string {
+	return filepath.Join(notesDir, ".kg", "retag-progress.yaml")
+}
+
+func retagNotes(opts retagOptions) error {
+	notesDir := viper.GetString("notes_directory")
+	store, err := openEdgeStore(notesDir)
+	if err != nil {
+		return err
+	}
+
+	progressPath := retagProgressPath(notesDir)
+	progress := &tagChangeset{Filter: opts.Filter}
+	if !opts.Restart {
+		saved, err := readChangeset(progressPath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err == nil && saved.Filter == opts.Filter {
+			progress = saved
+		}
+	}
+	done := make(map[string]tagChange, len(progress.Changes))
+	for _, c := range progress.Changes {
+		done[c.File] = c
+	}
+
+	filter := parseNoteQuery(opts.Filter)
+	var pending []tagChange
+	var pendingNotes []Note
+	var changes []tagChange
+	for i, note := range store.notes {
+		if !filter.Match(note) {
+			continue
+		}
+		rel, err := filepath.Rel(notesDir, store.paths[i])
+		if err != nil {
+			return err
+		}
+		hash, err := fileHash(store.paths[i])
+		if err != nil {
+			return err
+		}
+		if c, ok := done[rel]; ok && c.Hash == hash {
+			changes = append(changes, c)
+			continue
+		}
+		pendingNotes = append(pendingNotes, note)
+		pending = append(pending, tagChange{
+			Note: note.Title,
+			File: rel,
+			Hash: hash,
+			From: stringList(note.Frontmatter["tags"]),
+		})
+	}
+	if len(changes) > 0 {
+		fmt.Printf("Resuming: %d of %d notes already have suggestions\n", len(changes), len(changes)+len(pending))
+	}
+	progress.Changes = changes
+
+	if len(pending) > 0 {
+		if err := suggestRetags(store.notes, pendingNotes, pending, progress, opts); err != nil {
+			return err
+		}
+	}
+
+	var proposed []tagChange
+	for _, c := range progress.Changes {
+		if !sameTags(c.From, c.To) {
+			proposed = append(proposed, c)
+		}
+	}
+	sort.Slice(proposed, func(i, j int) bool { return proposed[i].Note < proposed[j].Note })
+
+	if opts.Output != "" {
+		header := "# Proposed tag changes. Edit the 'to' lists or delete entries, then run:\n#   kg retag --apply " + opts.Output + "\n"
+		if err := writeChangeset(opts.Output, &tagChangeset{Changes: proposed}, header); err != nil {
+			return err
+		}
+		os.Remove(progressPath)
+		fmt.Printf("Wrote %d proposed changes to %s; apply them with 'kg retag --apply %s'\n", len(proposed), opts.Output, opts.Output)
+		return nil
+	}
+
+	if len(proposed) == 0 {
+		os.Remove(progressPath)
+		fmt.Println("No tag changes proposed")
+		return nil
+	}
+	accepted, ok := reviewTagChanges(proposed)
+	if !ok {
+		fmt.Println("Review stopped; run 'kg retag' again to continue")
+		return nil
+	}
+	if err := applyTagChanges(notesDir, accepted); err != nil {
+		return err
+	}
+	os.Remove(progressPath)
+	return nil
+}
+
+// suggestRetags asks the LLM for tags for each of notes, completing the
+// matching entry of pending, at most opts.Concurrency at a time and
+// opts.Rate a minute. Each suggestion is recorded in progress as it arrives.
+func suggestRetags(all, notes []Note, pending []tagChange, progress *tagChangeset, opts retagOptions) error {
+	llm, err := openai.New()
+	if err != nil {
+		return fmt.Errorf("failed to create OpenAI client: %w", err)
+	}
+	vocabulary := tagVocabulary(all, 100)
+	progressPath := retagProgressPath(viper.GetString("notes_directory"))
+	if err := os.MkdirAll(filepath.Dir(progressPath), 0755); err != nil {
+		return fmt.Errorf("failed to save progress: %w", err)
+	}
+
+	var limiter <-chan time.Time
+	if opts.Rate > 0 {
+		ticker := time.NewTicker(time.Minute / time.Duration(opts.Rate))
+		defer ticker.Stop()
+		limiter = ticker.C
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		failures int
+		finished int
+	)
+	sem := make(chan struct{}, opts.Concurrency)
+	for i, change := range pending {
+		if limiter != nil && i > 0 {
+			<-limiter
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(note Note, change tagChange) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			tags, err := proposeTags(llm, note, vocabulary)
+			change.To = tags
+
+			mu.Lock()
+			defer mu.Unlock()
+			finished++
+			if err != nil {
+				failures++
+				fmt.Fprintf(os.Stderr, "[%d/%d] Failed to suggest tags for '%s': %v\n", finished, len(pending), change.Note, err)
+				return
+			}
+			progress.Changes = append(progress.Changes, change)
+			if err := writeChangeset(progressPath, progress, ""); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+			fmt.Printf("[%d/%d] %s\n", finished, len(pending), change.Note)
+		}(notes[i], change)
+	}
+	wg.Wait()
+
+	if failures > 0 {
+		return fmt.Errorf("failed to suggest tags for %d notes; run 'kg retag' again to retry them", failures)
+	}
+	return nil
+}
+
+// proposeTags asks the LLM for tags for a note, preferring tags already used
+// in the vault.
+func proposeTags(llm *openai.LLM, note Note, vocabulary []string) ([]string, error) {
+	prompt := fmt.Sprintf(`Suggest 3-5 relevant tags for this note from a personal knowledge base.
+Prefer tags already used in the knowledge base where they fit: %s
+
+Title: %s
+Current tags: %s
+
+%s
+
+Respond with only the tags, separated by commas.`,
+		strings.Join(vocabulary, ", "), note.Title, strings.Join(stringList(note.Frontmatter["tags"]), ", "), excerpt(note.Content, 4000))
+
+	completion, err := llm.Call(context.TODO(), prompt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get AI response: %w", err)
+	}
+
+	var tags []string
+	seen := make(map[string]bool)
+	for _, tag := range strings.Split(strings.TrimSpace(completion), ",") {
+		tag = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("no tags in response")
+	}
+	return tags, nil
+}
+
+// tagVocabulary returns up to n tags used in notes, most used first.
+func tagVocabulary(notes []Note, n int) []string {
+	counts := make(map[string]int)
+	for _, note := range notes {
+		for _, tag := range stringList(note.Frontmatter["tags"]) {
+			counts[tag]++
+		}
+	}
+	tags := make([]string, 0, len(counts))
+	for tag := range counts {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if counts[tags[i]] != counts[tags[j]] {
+			return counts[tags[i]] > counts[tags[j]]
+		}
+		return tags[i] < tags[j]
+	})
+	if len(tags) > n {
+		tags = tags[:n]
+	}
+	return tags
+}
+
+// reviewTagChanges shows each change and asks whether to apply it. It
+// reports false if the user quit.
+func reviewTagChanges(changes []tagChange) ([]tagChange, bool) {
+	reader := bufio.NewReader(os.Stdin)
+	var accepted []tagChange
+	for i, c := range changes {
+		fmt.Printf("%s (%s)\n", c.Note, c.File)
+		fmt.Printf("  - %s\n", tagListString(c.From))
+		fmt.Printf("  + %s\n", tagListString(c.To))
+		fmt.Print("Apply? [y]es, [n]o, [e]dit, [a]ll remaining, [q]uit: ")
+		input, _ := reader.ReadString('\n')
+
+		switch strings.ToLower(strings.TrimSpace(input)) {
+		case "y", "yes":
+			accepted = append(accepted, c)
+		case "e", "edit":
+			fmt.Print("Tags (comma separated): ")
+			line, _ := reader.ReadString('\n')
+			c.To = nil
+			for _, tag := range strings.Split(line, ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					c.To = append(c.To, tag)
+				}
+			}
+			accepted = append(accepted, c)
+		case "a", "all":
+			return append(accepted, changes[i:]...), true
+		case "q", "quit":
+			return nil, false
+		}
+		fmt.Println()
+	}
+	return accepted, true
+}
+
+func tagListString(tags []string) string {
+	if len(tags) == 0 {
+		return "(none)"
+	}
+	return strings.Join(tags, ", ")
+}
+
+func applyRetagFile(path string) error {
+	changeset, err := readChangeset(path)
+	if err != nil {
+		return err
+	}
+	return applyTagChanges(viper.GetString("notes_directory"), changeset.Changes)
+}
+
+// applyTagChanges sets the tags of every note in changes, or of none of
+// them if any note has changed since its change was proposed or cannot be
+// written.
+func applyTagChanges(notesDir string, changes []tagChange) error {
+	if len(changes) == 0 {
+		fmt.Println("No changes to apply")
+		return nil
+	}
+
+	files := make(map[string][]byte, len(changes))
+	for _, c := range changes {
+		path, err := tagChangePath(notesDir, c)
+		if err != nil {
+			return err
+		}
+		if c.Hash == "" {
+			return fmt.Errorf("change to %s has no hash; run 'kg retag' again", c.File)
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", c.File, err)
+		}
+		if hashBytes(content) != c.Hash {
+			return fmt.Errorf("note '%s' has changed since the tags were proposed; run 'kg retag' again", c.Note)
+		}
+		updated, err := replaceNoteTags(string(content), c.To)
+		if err != nil {
+			return fmt.Errorf("failed to update %s: %w", c.File, err)
+		}
+		files[path] = []byte(updated)
+	}
+
+	if err := writeFilesAtomic(files); err != nil {
+		return fmt.Errorf("failed to apply tag changes: %w", err)
+	}
+
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	commitNotes(fmt.Sprintf("Retag %d notes", len(paths)), paths...)
+	fmt.Printf("Updated tags of %d notes\n", len(paths))
+	return nil
+}
+
+// tagChangePath returns the note a change applies to. Patch files are
+// edited by hand, so files outside the notes directory are refused.
+func tagChangePath(notesDir string, c tagChange) (string, error) {
+	if c.File == "" || filepath.IsAbs(c.File) || strings.HasPrefix(c.File, "/") {
+		return "", fmt.Errorf("refusing to retag '%s': file must be relative to the notes directory", c.File)
+	}
+	path := filepath.Join(notesDir, filepath.FromSlash(c.File))
+	rel, err := filepath.Rel(notesDir, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("refusing to retag '%s': outside the notes directory", c.File)
+	}
+	return path, nil
+}
+
+// writeFilesAtomic replaces several files so that either all are written or
+// none are: every file is staged next to its target first, and if moving
+// one into place fails, those already moved are restored.
+func writeFilesAtomic(files map[string][]byte) error {
+	staged := make(map[string]string, len(files))
+	defer func() {
+		for _, tmp := range staged {
+			os.Remove(tmp)
+		}
+	}()
+	for path, data := range files {
+		tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+		if err != nil {
+			return err
+		}
+		staged[path] = tmp.Name()
+		if _, err := tmp.Write(data); err != nil {
+			tmp.Close()
+			return err
+		}
+		if err := tmp.Close(); err != nil {
+			return err
+		}
+		if err := os.Chmod(tmp.Name(), fileMode(path)); err != nil {
+			return err
+		}
+	}
+
+	originals := make(map[string][]byte, len(files))
+	for path := range files {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		originals[path] = data
+	}
+
+	var moved []string
+	for path, tmp := range staged {
+		if err := os.Rename(tmp, path); err != nil {
+			for _, p := range moved {
+				if data, ok := originals[p]; ok {
+					os.WriteFile(p, data, 0644)
+				} else {
+					os.Remove(p)
+				}
+			}
+			return err
+		}
+		moved = append(moved, path)
+		delete(staged, path)
+	}
+	return nil
+}
+
+func readChangeset(path string) (*tagChangeset, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read changeset: %w", err)
+	}
+	var changeset tagChangeset
+	if err := yaml.Unmarshal(data, &changeset); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &changeset, nil
+}
+
+func writeChangeset(path string, changeset *tagChangeset, header string) error {
+	data, err := yaml.Marshal(changeset)
+	if err != nil {
+		return fmt.Errorf("failed to write changeset: %w", err)
+	}
+	if err := writeFileAtomic(path, append([]byte(header), data...)); err != nil {
+		return fmt.Errorf("failed to write changeset: %w", err)
+	}
+	return nil
+}
+
+func fileHash(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return hashBytes(data), nil
+}
+
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// sameTags reports whether two tag lists hold the same tags, in any order.
+func sameTags(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[string]bool, len(a))
+	for _, tag := range a {
+		seen[tag] = true
+	}
+	for _, tag := range b {
+		if !seen[tag] {
+			return false
+		}
+	}
+	return true
+}
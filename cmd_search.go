@@ -52,7 +52,7 @@ func searchNotes(queryString string) error {
 
 	// Perform the search
 	searchRequest := bleve.NewSearchRequest(q)
-	searchRequest.Fields = []string{"title", "tags", "content"}
+	searchRequest.Fields = []string{"title", "tags", "summary", "content"}
 	searchRequest.Highlight = bleve.NewHighlight()
 
 	searchResults, err := index.Search(searchRequest)
@@ -127,10 +127,12 @@ func indexNote(index bleve.Index, path string) error {
 	doc := struct {
 		Title   string   `json:"title"`
 		Tags    []string `json:"tags"`
+		Summary string   `json:"summary"`
 		Content string   `json:"content"`
 	}{
-		Title:   frontmatter["title"].(string),
-		Tags:    frontmatter["tags"].([]string),
+		Title:   fmt.Sprint(frontmatter["title"]),
+		Tags:    stringList(frontmatter["tags"]),
+		Summary: strings.Join(stringList(frontmatter["summary"]), " "),
 		Content: strings.TrimSpace(parts[2]),
 	}
 
@@ -165,6 +167,9 @@ func displayResults(results *bleve.SearchResult) {
 	for _, hit := range results.Hits {
 		fmt.Printf("Title: %s\n", hit.Fields["title"])
 		fmt.Printf("Tags: %v\n", hit.Fields["tags"])
+		if summary, ok := hit.Fields["summary"].(string); ok && summary != "" {
+			fmt.Printf("Summary: %s\n", summary)
+		}
 
 		if content, ok := hit.Fields["content"].(string); ok {
 			// Display content with context and highlighted matches
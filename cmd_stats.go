@@ -2,90 +2,378 @@ package main
 
 import (
 	"fmt"
+	"math"
+	"os"
 	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 func newStatsCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "stats",
 		Short: "Display knowledge graph metrics",
+		Long: `Report on the vault: how many notes it has and how long they are, how tags
+are used, how the vault has grown over time, and how well its notes are
+linked. Links are relations and wikilinks together.
+
+Notes are counted as created by their date field and as modified by their
+lastmod field, or the file's modification time when it has none.`,
+		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return displayStats()
+			format, _ := cmd.Flags().GetString("format")
+			period, _ := cmd.Flags().GetString("period")
+			top, _ := cmd.Flags().GetInt("top")
+			switch format {
+			case "table", "json", "chart":
+			default:
+				return fmt.Errorf("unsupported format: %s. Use 'table', 'json' or 'chart'", format)
+			}
+			if _, ok := statsPeriods[period]; !ok {
+				return fmt.Errorf("unsupported period: %s. Use 'week', 'month' or 'year'", period)
+			}
+			return displayStats(format, period, top)
 		},
 	}
+
+	cmd.Flags().StringP("format", "o", "table", "Output format (table, json or chart)")
+	cmd.Flags().StringP("period", "p", "month", "Time series period (week, month or year)")
+	cmd.Flags().IntP("top", "n", 20, "Number of tags to show (0 for all)")
+
+	return cmd
+}
+
+// statsReport is everything kg stats reports, in the form it is written as
+// JSON.
+type statsReport struct {
+	Notes    int           `json:"notes"`
+	Words    wordStats     `json:"words"`
+	Tags     []tagCount    `json:"tags"`
+	Untagged int           `json:"untagged"`
+	Period   string        `json:"period"`
+	Created  []periodCount `json:"created"`
+	Modified []periodCount `json:"modified"`
+	Undated  int           `json:"undated"`
+	Links    linkStats     `json:"links"`
+}
+
+type wordStats struct {
+	Total   int     `json:"total"`
+	Mean    float64 `json:"mean"`
+	Median  int     `json:"median"`
+	Max     int     `json:"max"`
+	Longest string  `json:"longest,omitempty"`
+}
+
+// periodCount is the number of notes created or modified in a period, and
+// the running total up to the end of it.
+type periodCount struct {
+	Period string `json:"period"`
+	Notes  int    `json:"notes"`
+	Total  int    `json:"total"`
 }
 
-func displayStats() error {
+type linkStats struct {
+	Relations        int     `json:"relations"`
+	Wikilinks        int     `json:"wikilinks"`
+	LinkedPairs      int     `json:"linked_pairs"`
+	AverageDegree    float64 `json:"average_degree"`
+	Density          float64 `json:"density"`
+	Orphans          int     `json:"orphans"`
+	OrphanRatio      float64 `json:"orphan_ratio"`
+	Components       int     `json:"components"`
+	LargestComponent int     `json:"largest_component"`
+	LargestRatio     float64 `json:"largest_component_ratio"`
+}
+
+// statsPeriods maps each time series period to the functions that find the
+// start of the period containing a time and label it.
+var statsPeriods = map[string]struct {
+	start func(time.Time) time.Time
+	next  func(time.Time) time.Time
+	label func(time.Time) string
+}{
+	"week": {
+		start: func(t time.Time) time.Time {
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+			return t.AddDate(0, 0, -((int(t.Weekday()) + 6) % 7))
+		},
+		next: func(t time.Time) time.Time { return t.AddDate(0, 0, 7) },
+		label: func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		},
+	},
+	"month": {
+		start: func(t time.Time) time.Time { return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC) },
+		next:  func(t time.Time) time.Time { return t.AddDate(0, 1, 0) },
+		label: func(t time.Time) string { return t.Format("2006-01") },
+	},
+	"year": {
+		start: func(t time.Time) time.Time { return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC) },
+		next:  func(t time.Time) time.Time { return t.AddDate(1, 0, 0) },
+		label: func(t time.Time) string { return t.Format("2006") },
+	},
+}
+
+func displayStats(format, period string, top int) error {
 	notesDir := viper.GetString("notes_directory")
 	if notesDir == "" {
 		return fmt.Errorf("notes directory not set in config")
 	}
 
-	notes, err := loadNotes(notesDir)
+	report, err := buildStatsReport(notesDir, period)
 	if err != nil {
-		return fmt.Errorf("failed to load notes: %w", err)
+		return err
+	}
+	if top > 0 && top < len(report.Tags) {
+		report.Tags = report.Tags[:top]
 	}
 
-	fmt.Printf("Total number of notes: %d\n\n", len(notes))
+	switch format {
+	case "json":
+		return printJSON(report)
+	case "chart":
+		return printStatsChart(report)
+	default:
+		return printStatsTable(report)
+	}
+}
 
-	displayTagDistribution(notes)
-	displayMostConnectedNotes(notes)
-	displayDateBasedStats(notes)
-	displayAverageNoteLength(notes)
+func buildStatsReport(notesDir, period string) (statsReport, error) {
+	store := &edgeStore{dir: notesDir, vocab: relationVocabularyFromConfig()}
+	var modified []time.Time
+	err := walkNotes(notesDir, func(path string, note Note) error {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		mtime := info.ModTime()
+		if lastmod, ok := frontmatterDate(note.Frontmatter["lastmod"]); ok {
+			mtime = lastmod
+		}
+		store.notes = append(store.notes, note)
+		store.paths = append(store.paths, path)
+		modified = append(modified, mtime)
+		return nil
+	})
+	if err != nil {
+		return statsReport{}, fmt.Errorf("failed to load notes: %w", err)
+	}
+	store.index = buildNoteIndex(store.notes)
+	notes := store.notes
 
-	return nil
-}
+	aliases, err := loadTagAliases(notesDir)
+	if err != nil {
+		return statsReport{}, err
+	}
 
-func displayTagDistribution(notes []Note) {
-	tagCount := make(map[string]int)
+	report := statsReport{Notes: len(notes), Period: period}
+
+	report.Tags = countTags(notes, aliases)
+	sort.SliceStable(report.Tags, func(i, j int) bool { return report.Tags[i].Total > report.Tags[j].Total })
+	var created []time.Time
 	for _, note := range notes {
-		for _, tag := range note.Tags {
-			tagCount[tag]++
+		if len(note.Tags) == 0 {
+			report.Untagged++
+		}
+		if note.Date.IsZero() {
+			report.Undated++
+		} else {
+			created = append(created, note.Date)
+		}
+	}
+	report.Created = countByPeriod(created, period)
+	report.Modified = countByPeriod(modified, period)
+
+	counts := make([]int, len(notes))
+	for i, note := range notes {
+		counts[i] = len(strings.Fields(note.Content))
+		report.Words.Total += counts[i]
+		if counts[i] > report.Words.Max {
+			report.Words.Max = counts[i]
+			report.Words.Longest = note.Title
 		}
 	}
+	if len(counts) > 0 {
+		report.Words.Mean = float64(report.Words.Total) / float64(len(counts))
+		sort.Ints(counts)
+		report.Words.Median = counts[len(counts)/2]
+	}
 
-	fmt.Println("Tag distribution:")
-	for tag, count := range tagCount {
-		fmt.Printf("  %s: %d\n", tag, count)
+	g := newNoteGraph(store, true)
+	for _, note := range notes {
+		report.Links.Relations += len(note.Relations)
+		report.Links.Wikilinks += len(extractWikilinks(note.Content))
 	}
-	fmt.Println()
+	report.Links.LinkedPairs = len(g.edges)
+	for i := range notes {
+		if g.Degree(i) == 0 {
+			report.Links.Orphans++
+		}
+	}
+	components := g.Components()
+	report.Links.Components = len(components)
+	if n := len(notes); n > 0 {
+		report.Links.AverageDegree = 2 * float64(len(g.edges)) / float64(n)
+		report.Links.OrphanRatio = float64(report.Links.Orphans) / float64(n)
+		report.Links.LargestComponent = len(components[0])
+		report.Links.LargestRatio = float64(len(components[0])) / float64(n)
+	}
+	if n := len(notes); n > 1 {
+		report.Links.Density = 2 * float64(len(g.edges)) / float64(n*(n-1))
+	}
+
+	return report, nil
 }
 
-func displayMostConnectedNotes(notes []Note) {
-	sort.Slice(notes, func(i, j int) bool {
-		return len(notes[i].Connections) > len(notes[j].Connections)
-	})
+// countByPeriod counts times by period, from the earliest to the latest,
+// including the periods in between with no notes.
+func countByPeriod(times []time.Time, period string) []periodCount {
+	p := statsPeriods[period]
+	counts := make(map[string]int)
+	var first, last time.Time
+	for _, t := range times {
+		start := p.start(t)
+		counts[p.label(start)]++
+		if first.IsZero() || start.Before(first) {
+			first = start
+		}
+		if start.After(last) {
+			last = start
+		}
+	}
 
-	fmt.Println("Most connected notes:")
-	for i := 0; i < 5 && i < len(notes); i++ {
-		fmt.Printf("  %s: %d connections\n", notes[i].Title, len(notes[i].Connections))
+	series := []periodCount{}
+	if len(times) == 0 {
+		return series
+	}
+	total := 0
+	for t := first; !t.After(last); t = p.next(t) {
+		label := p.label(t)
+		total += counts[label]
+		series = append(series, periodCount{Period: label, Notes: counts[label], Total: total})
 	}
-	fmt.Println()
+	return series
 }
 
-func displayDateBasedStats(notes []Note) {
-	notesByMonth := make(map[string]int)
-	for _, note := range notes {
-		monthKey := note.Date.Format("2006-01")
-		notesByMonth[monthKey]++
+func printStatsTable(r statsReport) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Notes\t%d\n", r.Notes)
+	fmt.Fprintf(w, "Words\t%d (mean %.1f, median %d, max %d)\n", r.Words.Total, r.Words.Mean, r.Words.Median, r.Words.Max)
+	fmt.Fprintf(w, "Relations\t%d\n", r.Links.Relations)
+	fmt.Fprintf(w, "Wikilinks\t%d\n", r.Links.Wikilinks)
+	fmt.Fprintf(w, "Average degree\t%.2f\n", r.Links.AverageDegree)
+	fmt.Fprintf(w, "Link density\t%.4f\n", r.Links.Density)
+	fmt.Fprintf(w, "Orphans\t%d (%.1f%%)\n", r.Links.Orphans, 100*r.Links.OrphanRatio)
+	fmt.Fprintf(w, "Components\t%d\n", r.Links.Components)
+	fmt.Fprintf(w, "Largest component\t%d notes (%.1f%%)\n", r.Links.LargestComponent, 100*r.Links.LargestRatio)
+	fmt.Fprintf(w, "Untagged notes\t%d\n", r.Untagged)
+	fmt.Fprintf(w, "Undated notes\t%d\n", r.Undated)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(r.Tags) > 0 {
+		fmt.Println()
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "Tag\tNotes\tTotal")
+		fmt.Fprintln(w, "---\t-----\t-----")
+		for _, t := range r.Tags {
+			fmt.Fprintf(w, "%s\t%d\t%d\n", t.Tag, t.Direct, t.Total)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
 	}
 
-	fmt.Println("Notes per month:")
-	for month, count := range notesByMonth {
-		fmt.Printf("  %s: %d\n", month, count)
+	if len(r.Created) > 0 || len(r.Modified) > 0 {
+		fmt.Println()
+		modified := make(map[string]int)
+		for _, p := range r.Modified {
+			modified[p.Period] = p.Notes
+		}
+		created := make(map[string]periodCount)
+		var periods []string
+		for _, p := range r.Created {
+			created[p.Period] = p
+			periods = append(periods, p.Period)
+		}
+		for _, p := range r.Modified {
+			if _, ok := created[p.Period]; !ok {
+				periods = append(periods, p.Period)
+			}
+		}
+		sort.Strings(periods)
+
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "Period\tCreated\tTotal\tModified")
+		fmt.Fprintln(w, "------\t-------\t-----\t--------")
+		total := 0
+		for _, period := range periods {
+			if c, ok := created[period]; ok {
+				total = c.Total
+			}
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", period, created[period].Notes, total, modified[period])
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
 	}
-	fmt.Println()
+	return nil
 }
 
-func displayAverageNoteLength(notes []Note) {
-	var totalLength int
-	for _, note := range notes {
-		totalLength += len(note.Content)
+func printStatsChart(r statsReport) error {
+	fmt.Printf("%d notes, %d words, %d orphans (%.1f%%), largest component %d notes (%.1f%%)\n\n",
+		r.Notes, r.Words.Total, r.Links.Orphans, 100*r.Links.OrphanRatio, r.Links.LargestComponent, 100*r.Links.LargestRatio)
+
+	series := func(name string, counts []periodCount) {
+		if len(counts) == 0 {
+			return
+		}
+		values := make([]int, len(counts))
+		for i, c := range counts {
+			values[i] = c.Notes
+		}
+		fmt.Printf("%s per %s, %s to %s:\n  %s\n\n", name, r.Period, counts[0].Period, counts[len(counts)-1].Period, sparkline(values))
 	}
-	averageLength := float64(totalLength) / float64(len(notes))
+	series("Created", r.Created)
+	series("Modified", r.Modified)
 
-	fmt.Printf("Average note length: %.2f characters\n", averageLength)
+	if len(r.Tags) > 0 {
+		width := 0
+		for _, t := range r.Tags {
+			width = max(width, len(t.Tag))
+		}
+		largest := r.Tags[0].Total
+		fmt.Println("Tags:")
+		for _, t := range r.Tags {
+			bar := strings.Repeat("█", int(math.Ceil(40*float64(t.Total)/float64(largest))))
+			fmt.Printf("  %-*s %s %d\n", width, t.Tag, bar, t.Total)
+		}
+	}
+	return nil
+}
+
+// sparkline draws values as a row of block characters scaled to the
+// largest.
+func sparkline(values []int) string {
+	blocks := []rune(" ▁▂▃▄▅▆▇█")
+	largest := 0
+	for _, v := range values {
+		largest = max(largest, v)
+	}
+	var b strings.Builder
+	for _, v := range values {
+		level := 0
+		if largest > 0 {
+			level = int(math.Ceil(float64(v) / float64(largest) * float64(len(blocks)-1)))
+		}
+		b.WriteRune(blocks[level])
+	}
+	return b.String()
 }
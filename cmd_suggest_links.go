@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/openai"
+)
+
+func newSuggestLinksCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "suggest-links [title]",
+		Short: "Find and confirm likely connections between notes",
+		Long: `Find pairs of notes that are similar but not yet connected, across the vault
+or for a single note. Candidates are ranked by BM25 similarity, or with
+--method embeddings by the cosine similarity of OpenAI embeddings, which
+are cached in .kg/embeddings.json. Each
+candidate is checked by the LLM, which labels the relation and explains it,
+and you accept, reject or skip it. Accepted links are recorded as by
+'kg connect'; pairs you reject, and pairs the LLM judges unrelated, are
+remembered in .kg/rejected-links.json and not suggested again.`,
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeNotes(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			title := ""
+			if len(args) == 1 {
+				title = args[0]
+			}
+			method, _ := cmd.Flags().GetString("method")
+			limit, _ := cmd.Flags().GetInt("limit")
+			minScore, _ := cmd.Flags().GetFloat64("min-score")
+			noteMode, _ := cmd.Flags().GetString("note")
+
+			if method != "bm25" && method != "embeddings" {
+				return fmt.Errorf("unsupported method: %s. Use 'bm25' or 'embeddings'", method)
+			}
+			switch noteMode {
+			case "new", "append", "none":
+			default:
+				return fmt.Errorf("unsupported note mode: %s. Use 'new', 'append' or 'none'", noteMode)
+			}
+
+			return suggestLinks(title, suggestOptions{
+				Method:   method,
+				Limit:    limit,
+				MinScore: minScore,
+				Note:     noteMode,
+			})
+		},
+	}
+
+	cmd.Flags().String("method", "bm25", "How to find candidates (bm25 or embeddings)")
+	cmd.Flags().IntP("limit", "n", 10, "Maximum number of candidates to check")
+	cmd.Flags().Float64("min-score", 0.1, "Minimum similarity for a candidate")
+	cmd.Flags().String("note", "none", "Where accepted links write an explanation (new, append or none)")
+
+	return cmd
+}
+
+type suggestOptions struct {
+	Method   string
+	Limit    int
+	MinScore float64
+	Note     string
+}
+
+// linkCandidate is a pair of notes that might be related. A and B index
+// into the edge store's notes.
+type linkCandidate struct {
+	A, B  int
+	Score float64
+}
+
+// linkSuggestion is the LLM's verdict on a candidate.
+type linkSuggestion struct {
+	Related   bool   `json:"related"`
+	Type      string `json:"type"`
+	Reverse   bool   `json:"reverse"`
+	Rationale string `json:"rationale"`
+}
+
+func suggestLinks(title string, opts suggestOptions) error {
+	notesDir := viper.GetString("notes_directory")
+	store, err := openEdgeStore(notesDir)
+	if err != nil {
+		return err
+	}
+
+	focus := -1
+	if title != "" {
+		if focus, err = store.resolve(title); err != nil {
+			return err
+		}
+	}
+
+	rejected, err := loadRejectedLinks(notesDir)
+	if err != nil {
+		return err
+	}
+
+	scores, err := similarityScorer(notesDir, store.notes, store.paths, opts.Method)
+	if err != nil {
+		return err
+	}
+	candidates := findLinkCandidates(store, focus, scores, rejected, opts)
+	if len(candidates) == 0 {
+		fmt.Println("No new link candidates found")
+		return nil
+	}
+
+	llm, err := openai.New()
+	if err != nil {
+		return fmt.Errorf("failed to create OpenAI client: %w", err)
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	accepted, rejectedCount := 0, 0
+	for _, c := range candidates {
+		a, b := store.notes[c.A], store.notes[c.B]
+		suggestion, err := confirmLink(llm, store.vocab, a, b)
+		if err != nil {
+			return err
+		}
+		if !suggestion.Related {
+			fmt.Printf("Skipping %s and %s: %s\n\n", a.Title, b.Title, suggestion.Rationale)
+			rejected.add(a.Title, b.Title, suggestion.Rationale)
+			if err := rejected.save(); err != nil {
+				return err
+			}
+			continue
+		}
+		if suggestion.Reverse {
+			a, b = b, a
+		}
+
+		fmt.Printf("%s --%s--> %s (similarity %.2f)\n", a.Title, suggestion.Type, b.Title, c.Score)
+		fmt.Printf("  %s\n", suggestion.Rationale)
+		fmt.Print("Accept? [y]es, [n]o, [s]kip, [q]uit: ")
+		input, _ := reader.ReadString('\n')
+
+		switch strings.ToLower(strings.TrimSpace(input)) {
+		case "y", "yes":
+			err := connectConcepts(a.Title, b.Title, connectOptions{Rel: suggestion.Type, Note: opts.Note})
+			if err != nil {
+				return err
+			}
+			accepted++
+		case "n", "no":
+			rejected.add(a.Title, b.Title, "")
+			if err := rejected.save(); err != nil {
+				return err
+			}
+			rejectedCount++
+		case "q", "quit":
+			fmt.Printf("Accepted %d, rejected %d\n", accepted, rejectedCount)
+			return nil
+		}
+		fmt.Println()
+	}
+
+	fmt.Printf("Accepted %d, rejected %d\n", accepted, rejectedCount)
+	return nil
+}
+
+// similarityScorer returns a function scoring how alike two notes are.
+func similarityScorer(notesDir string, notes []Note, paths []string, method string) (func(i, j int) float64, error) {
+	if method == "bm25" {
+		texts := make([]string, len(notes))
+		for i, note := range notes {
+			texts[i] = noteText(note)
+		}
+		return newBM25Index(texts).Similarity, nil
+	}
+
+	vectors, err := noteEmbeddings(notesDir, notes, paths)
+	if err != nil {
+		return nil, err
+	}
+	return func(i, j int) float64 { return cosineSimilarity(vectors[i], vectors[j]) }, nil
+}
+
+// findLinkCandidates ranks unconnected, unrejected pairs of notes by
+// similarity. With focus set, only pairs including that note are
+// considered.
+func findLinkCandidates(store *edgeStore, focus int, score func(i, j int) float64, rejected *rejectedLinks, opts suggestOptions) []linkCandidate {
+	connected := make(map[[2]int]bool)
+	for i, note := range store.notes {
+		for _, rel := range note.Relations {
+			if j, ok := store.index[noteKey(rel.Target)]; ok {
+				connected[[2]int{min(i, j), max(i, j)}] = true
+			}
+		}
+	}
+
+	var candidates []linkCandidate
+	for i := range store.notes {
+		for j := i + 1; j < len(store.notes); j++ {
+			if focus >= 0 && i != focus && j != focus {
+				continue
+			}
+			if connected[[2]int{i, j}] || rejected.has(store.notes[i].Title, store.notes[j].Title) {
+				continue
+			}
+			if s := score(i, j); s >= opts.MinScore {
+				candidates = append(candidates, linkCandidate{A: i, B: j, Score: s})
+			}
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Score > candidates[j].Score })
+	if len(candidates) > opts.Limit {
+		candidates = candidates[:opts.Limit]
+	}
+	return candidates
+}
+
+// confirmLink asks the LLM whether two notes are related, and how.
+func confirmLink(llm *openai.LLM, vocab relationVocabulary, a, b Note) (linkSuggestion, error) {
+	prompt := fmt.Sprintf(`Decide whether these two notes from a knowledge graph have a meaningful relationship worth linking.
+
+Note A: %q
+%s
+
+Note B: %q
+%s
+
+Respond with only a JSON object with these fields:
+"related": true or false
+"type": the relation from A to B, one of: %s
+"reverse": true if the relation reads better from B to A
+"rationale": one sentence explaining the relationship, or why there is none`,
+		a.Title, excerpt(a.Content, 1500), b.Title, excerpt(b.Content, 1500), strings.Join(vocab.Types(), ", "))
+
+	res, err := llm.GenerateContent(context.TODO(), []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeHuman, prompt),
+	})
+	if err != nil {
+		return linkSuggestion{}, fmt.Errorf("failed to generate content: %w", err)
+	}
+
+	var suggestion linkSuggestion
+	if err := json.Unmarshal([]byte(extractJSON(res.Choices[0].Content)), &suggestion); err != nil {
+		return linkSuggestion{}, fmt.Errorf("failed to parse suggestion for %s and %s: %w", a.Title, b.Title, err)
+	}
+	if !vocab.Known(suggestion.Type) {
+		suggestion.Type = defaultRelation
+	}
+	return suggestion, nil
+}
+
+// extractJSON returns the JSON object in a model response, which may be
+// wrapped in a code fence or surrounded by prose.
+func extractJSON(s string) string {
+	start, end := strings.Index(s, "{"), strings.LastIndex(s, "}")
+	if start < 0 || end < start {
+		return s
+	}
+	return s[start : end+1]
+}
+
+// rejectedLinks remembers the pairs of notes a user or the LLM has rejected
+// as links, in either order.
+type rejectedLinks struct {
+	path  string
+	Pairs []rejectedPair `json:"pairs"`
+}
+
+type rejectedPair struct {
+	A        string    `json:"a"`
+	B        string    `json:"b"`
+	Rejected time.Time `json:"rejected"`
+	// Reason is the LLM's rationale when it judged the notes unrelated;
+	// it is empty for pairs the user rejected.
+	Reason string `json:"reason,omitempty"`
+}
+
+func loadRejectedLinks(notesDir string) (*rejectedLinks, error) {
+	r := &rejectedLinks{path: filepath.Join(notesDir, ".kg", "rejected-links.json")}
+	data, err := os.ReadFile(r.path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rejected links: %w", err)
+	}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", r.path, err)
+	}
+	return r, nil
+}
+
+func (r *rejectedLinks) has(a, b string) bool {
+	for _, p := range r.Pairs {
+		if noteKey(p.A) == noteKey(a) && noteKey(p.B) == noteKey(b) ||
+			noteKey(p.A) == noteKey(b) && noteKey(p.B) == noteKey(a) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rejectedLinks) add(a, b, reason string) {
+	if !r.has(a, b) {
+		r.Pairs = append(r.Pairs, rejectedPair{A: a, B: b, Rejected: time.Now(), Reason: reason})
+	}
+}
+
+func (r *rejectedLinks) save() error {
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return fmt.Errorf("failed to save rejected links: %w", err)
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to save rejected links: %w", err)
+	}
+	if err := os.WriteFile(r.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to save rejected links: %w", err)
+	}
+	return nil
+}
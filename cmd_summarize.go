@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/openai"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultPricePer1KTokens is used for cost estimates unless
+// llm_price_per_1k_tokens is configured.
+const defaultPricePer1KTokens = 0.002
+
+func newSummarizeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "summarize [title]",
+		Short: "Write AI summaries into note frontmatter",
+		Long: `Generate a one-sentence summary of a note, or of every note with --all, and
+store it in the summary frontmatter field; --abstract also writes a short
+bulleted abstract. Notes whose content has not changed since they were last
+summarized are skipped, using hashes kept in .kg/summaries.json. The number
+of notes, estimated tokens and cost are shown before anything is sent.`,
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeNotes(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			all, _ := cmd.Flags().GetBool("all")
+			if all == (len(args) == 1) {
+				return fmt.Errorf("specify a note title or --all")
+			}
+			title := ""
+			if len(args) == 1 {
+				title = args[0]
+			}
+			abstract, _ := cmd.Flags().GetBool("abstract")
+			concurrency, _ := cmd.Flags().GetInt("concurrency")
+			force, _ := cmd.Flags().GetBool("force")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			yes, _ := cmd.Flags().GetBool("yes")
+
+			if concurrency < 1 {
+				return fmt.Errorf("concurrency must be at least 1")
+			}
+
+			return summarizeNotes(title, summarizeOptions{
+				Abstract:    abstract,
+				Concurrency: concurrency,
+				Force:       force,
+				DryRun:      dryRun,
+				Yes:         yes,
+			})
+		},
+	}
+
+	cmd.Flags().Bool("all", false, "Summarize every note")
+	cmd.Flags().Bool("abstract", false, "Also write a bulleted abstract")
+	cmd.Flags().IntP("concurrency", "j", 4, "Number of notes to summarize at once")
+	cmd.Flags().Bool("force", false, "Summarize notes even if they are unchanged")
+	cmd.Flags().Bool("dry-run", false, "Show the estimate without summarizing")
+	cmd.Flags().BoolP("yes", "y", false, "Do not ask for confirmation")
+
+	return cmd
+}
+
+type summarizeOptions struct {
+	Abstract    bool
+	Concurrency int
+	Force       bool
+	DryRun      bool
+	Yes         bool
+}
+
+// noteSummary is the LLM's summary of a note.
+type noteSummary struct {
+	Summary  string   `json:"summary"`
+	Abstract []string `json:"abstract"`
+}
+
+// summaryCache records the content hash each note was last summarized at,
+// and whether an abstract was written, keyed by the note's slash-separated
+// path relative to the notes directory.
+type summaryCache struct {
+	path  string
+	Notes map[string]summaryCacheEntry `json:"notes"`
+}
+
+type summaryCacheEntry struct {
+	Hash     string `json:"hash"`
+	Abstract bool   `json:"abstract"`
+}
+
+// summaryJob is a note to summarize and the prompt to send for it.
+type summaryJob struct {
+	Title  string
+	Path   string
+	Key    string
+	Hash   string
+	Prompt string
+}
+
+func summarizeNotes(title string, opts summarizeOptions) error {
+	notesDir := viper.GetString("notes_directory")
+	store, err := openEdgeStore(notesDir)
+	if err != nil {
+		return err
+	}
+
+	targets := make([]int, 0, len(store.notes))
+	if title != "" {
+		i, err := store.resolve(title)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, i)
+	} else {
+		for i := range store.notes {
+			targets = append(targets, i)
+		}
+	}
+
+	cache, err := loadSummaryCache(notesDir)
+	if err != nil {
+		return err
+	}
+
+	count := newTokenCounter()
+	outputTokens := 60
+	if opts.Abstract {
+		outputTokens = 250
+	}
+	var jobs []summaryJob
+	tokens, skipped := 0, 0
+	for _, i := range targets {
+		note := store.notes[i]
+		rel, err := filepath.Rel(notesDir, store.paths[i])
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		sum := sha256.Sum256([]byte(note.Content))
+		hash := hex.EncodeToString(sum[:])
+		entry, ok := cache.Notes[key]
+		if !opts.Force && ok && entry.Hash == hash && (entry.Abstract || !opts.Abstract) {
+			if _, has := note.Frontmatter["summary"]; has {
+				skipped++
+				continue
+			}
+		}
+		job := summaryJob{Title: note.Title, Path: store.paths[i], Key: key, Hash: hash, Prompt: summaryPrompt(note, opts.Abstract)}
+		jobs = append(jobs, job)
+		tokens += count(job.Prompt) + outputTokens
+	}
+
+	price := defaultPricePer1KTokens
+	if viper.IsSet("llm_price_per_1k_tokens") {
+		price = viper.GetFloat64("llm_price_per_1k_tokens")
+	}
+	fmt.Printf("%d notes to summarize, %d unchanged\n", len(jobs), skipped)
+	if len(jobs) == 0 {
+		return nil
+	}
+	fmt.Printf("Estimated usage: about %d tokens, $%.4f\n", tokens, float64(tokens)/1000*price)
+	if opts.DryRun {
+		return nil
+	}
+	if len(jobs) > 1 && !opts.Yes {
+		fmt.Print("Continue? [y/N]: ")
+		input, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if answer := strings.ToLower(strings.TrimSpace(input)); answer != "y" && answer != "yes" {
+			return nil
+		}
+	}
+
+	llm, err := openai.New()
+	if err != nil {
+		return fmt.Errorf("failed to create OpenAI client: %w", err)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		changed []string
+		failed  []error
+	)
+	sem := make(chan struct{}, opts.Concurrency)
+	for _, job := range jobs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(job summaryJob) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			err := summarizeNote(llm, job, opts.Abstract)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed = append(failed, fmt.Errorf("%s: %w", job.Title, err))
+				return
+			}
+			cache.Notes[job.Key] = summaryCacheEntry{Hash: job.Hash, Abstract: opts.Abstract}
+			changed = append(changed, job.Path)
+			fmt.Printf("Summarized '%s'\n", job.Title)
+		}(job)
+	}
+	wg.Wait()
+
+	if err := cache.save(); err != nil {
+		return err
+	}
+	if len(changed) > 0 {
+		commitNotes(fmt.Sprintf("Summarize %d notes", len(changed)), changed...)
+	}
+	for _, err := range failed {
+		fmt.Fprintf(os.Stderr, "Failed to summarize %v\n", err)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to summarize %d of %d notes", len(failed), len(jobs))
+	}
+	return nil
+}
+
+func summaryPrompt(note Note, abstract bool) string {
+	fields := `"summary": one sentence of at most 30 words saying what the note is about`
+	if abstract {
+		fields += "\n" + `"abstract": a list of 3 to 5 short bullet points covering the note's main points`
+	}
+	return fmt.Sprintf(`Summarize this note from a personal knowledge base.
+
+Title: %s
+
+%s
+
+Respond with only a JSON object with these fields:
+%s`, note.Title, excerpt(note.Content, 12000), fields)
+}
+
+// summarizeNote asks the LLM for a summary of a note and writes it into the
+// note's frontmatter.
+func summarizeNote(llm *openai.LLM, job summaryJob, abstract bool) error {
+	res, err := llm.GenerateContent(context.TODO(), []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeHuman, job.Prompt),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to generate content: %w", err)
+	}
+
+	var summary noteSummary
+	if err := json.Unmarshal([]byte(extractJSON(res.Choices[0].Content)), &summary); err != nil {
+		return fmt.Errorf("failed to parse summary: %w", err)
+	}
+	summary.Summary = strings.TrimSpace(summary.Summary)
+	if summary.Summary == "" {
+		return fmt.Errorf("empty summary")
+	}
+
+	content, err := os.ReadFile(job.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read note: %w", err)
+	}
+	updated, err := setNoteSummary(string(content), summary, abstract)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(job.Path, []byte(updated)); err != nil {
+		return fmt.Errorf("failed to write note: %w", err)
+	}
+	return nil
+}
+
+// setNoteSummary sets the summary, and with abstract set the abstract, in
+// a note's frontmatter, leaving the rest of it as written.
+func setNoteSummary(content string, summary noteSummary, abstract bool) (string, error) {
+	return editFrontmatterNode(content, func(fm *yaml.Node) {
+		setMappingValue(fm, "summary", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: summary.Summary})
+		if abstract && len(summary.Abstract) > 0 {
+			setMappingValue(fm, "abstract", stringSequenceNode(summary.Abstract))
+		}
+	})
+}
+
+func loadSummaryCache(notesDir string) (*summaryCache, error) {
+	c := &summaryCache{
+		path:  filepath.Join(notesDir, ".kg", "summaries.json"),
+		Notes: make(map[string]summaryCacheEntry),
+	}
+	data, err := os.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read summary cache: %w", err)
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", c.path, err)
+	}
+	if c.Notes == nil {
+		c.Notes = make(map[string]summaryCacheEntry)
+	}
+	return c, nil
+}
+
+func (c *summaryCache) save() error {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to save summary cache: %w", err)
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to save summary cache: %w", err)
+	}
+	if err := os.WriteFile(c.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to save summary cache: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func newTagsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tags",
+		Short: "List, rename, merge and delete tags across the vault",
+		Long: `Manage the tags used in note frontmatter. Tags may be hierarchical, such as
+lang/go, and counts roll up to their parents. Aliases listed in the tag alias
+file (.kg/tag-aliases.yaml in the notes directory, or tag_aliases_file in the
+config) are treated as the tag they stand for.
+
+Every command that changes notes accepts --dry-run to show what would
+change, and writes all notes or none.`,
+	}
+
+	cmd.PersistentFlags().Bool("dry-run", false, "Show the changes without writing them")
+
+	cmd.AddCommand(
+		newTagsListCmd(),
+		newTagsRenameCmd(),
+		newTagsMergeCmd(),
+		newTagsDeleteCmd(),
+		newTagsAliasCmd(),
+	)
+
+	return cmd
+}
+
+func newTagsListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "Show tags with the number of notes using them",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sortBy, _ := cmd.Flags().GetString("sort")
+			if sortBy != "name" && sortBy != "count" {
+				return fmt.Errorf("unsupported sort: %s. Use 'name' or 'count'", sortBy)
+			}
+			return listTags(sortBy)
+		},
+	}
+
+	cmd.Flags().StringP("sort", "s", "name", "Sort by name (as a tree) or count")
+
+	return cmd
+}
+
+func newTagsRenameCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "rename [old] [new]",
+		Short: "Rename a tag and its children",
+		Long: `Rename a tag in every note. Hierarchical children are renamed with it, so
+renaming lang to language turns lang/go into language/go. Aliases of the old
+tag are kept, pointing at the new one.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			return renameTag(args[0], args[1], dryRun)
+		},
+	}
+}
+
+func newTagsMergeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "merge [tag...]",
+		Short: "Merge several tags into one",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			into, _ := cmd.Flags().GetString("into")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			if into == "" {
+				return fmt.Errorf("--into is required")
+			}
+			return mergeTags(args, into, dryRun)
+		},
+	}
+
+	cmd.Flags().String("into", "", "The tag to merge into")
+
+	return cmd
+}
+
+func newTagsDeleteCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "delete [tag]",
+		Short: "Remove a tag from every note",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			recursive, _ := cmd.Flags().GetBool("recursive")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			return deleteTag(args[0], recursive, dryRun)
+		},
+	}
+
+	cmd.Flags().BoolP("recursive", "r", false, "Also remove the tag's hierarchical children")
+
+	return cmd
+}
+
+func newTagsAliasCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "alias [alias] [tag]",
+		Short: "Show or define tag aliases",
+		Long: `With no arguments, list the tag aliases. With two, record alias as another
+name for tag; with --remove and one, forget an alias. Aliases change how
+tags are counted and matched, not the notes themselves; use
+'kg tags merge' to rewrite notes.`,
+		Args: cobra.RangeArgs(0, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			remove, _ := cmd.Flags().GetBool("remove")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			switch {
+			case len(args) == 0 && !remove:
+				return listTagAliases()
+			case len(args) == 1 && remove:
+				return removeTagAlias(args[0], dryRun)
+			case len(args) == 2 && !remove:
+				return addTagAlias(args[0], args[1], dryRun)
+			}
+			return fmt.Errorf("use 'kg tags alias [alias] [tag]' or 'kg tags alias --remove [alias]'")
+		},
+	}
+
+	cmd.Flags().Bool("remove", false, "Remove an alias")
+
+	return cmd
+}
+
+func listTags(sortBy string) error {
+	notesDir := viper.GetString("notes_directory")
+	notes, err := loadNotes(notesDir)
+	if err != nil {
+		return fmt.Errorf("failed to load notes: %w", err)
+	}
+	aliases, err := loadTagAliases(notesDir)
+	if err != nil {
+		return err
+	}
+
+	counts := countTags(notes, aliases)
+	if len(counts) == 0 {
+		fmt.Println("No tags found")
+		return nil
+	}
+	if sortBy == "count" {
+		sort.SliceStable(counts, func(i, j int) bool { return counts[i].Total > counts[j].Total })
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Tag\tNotes\tTotal\tAliases")
+	fmt.Fprintln(w, "---\t-----\t-----\t-------")
+	for _, c := range counts {
+		name := c.Tag
+		if sortBy == "name" {
+			depth := len(tagAncestors(c.Tag))
+			name = strings.Repeat("  ", depth) + c.Tag
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", name, c.Direct, c.Total, strings.Join(aliases.Aliases(c.Tag), ", "))
+	}
+	return w.Flush()
+}
+
+func renameTag(from, to string, dryRun bool) error {
+	notesDir := viper.GetString("notes_directory")
+	aliases, err := loadTagAliases(notesDir)
+	if err != nil {
+		return err
+	}
+	from, to = aliases.Canonical(from), strings.TrimSpace(to)
+	if to == "" {
+		return fmt.Errorf("new tag name is empty")
+	}
+	if tagWithin(to, from) && to != from {
+		return fmt.Errorf("cannot rename '%s' to its own child '%s'", from, to)
+	}
+
+	rewrites, err := rewriteTags(notesDir, aliases, dryRun, func(tag string) (string, bool) {
+		if tagWithin(tag, from) {
+			return to + strings.TrimPrefix(tag, from), true
+		}
+		return tag, true
+	})
+	if err != nil {
+		return err
+	}
+
+	if !dryRun {
+		aliases.Retarget(from, to)
+		if err := aliases.save(); err != nil {
+			return err
+		}
+	}
+	return reportTagRewrites(notesDir, rewrites, dryRun, fmt.Sprintf("Rename tag %q to %q", from, to))
+}
+
+func mergeTags(tags []string, into string, dryRun bool) error {
+	notesDir := viper.GetString("notes_directory")
+	aliases, err := loadTagAliases(notesDir)
+	if err != nil {
+		return err
+	}
+	into = aliases.Canonical(strings.TrimSpace(into))
+	if into == "" {
+		return fmt.Errorf("tag to merge into is empty")
+	}
+	merged := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		merged[aliases.Canonical(tag)] = true
+	}
+
+	rewrites, err := rewriteTags(notesDir, aliases, dryRun, func(tag string) (string, bool) {
+		if merged[tag] {
+			return into, true
+		}
+		return tag, true
+	})
+	if err != nil {
+		return err
+	}
+
+	if !dryRun {
+		for tag := range merged {
+			if tag != into {
+				aliases.Retarget(tag, into)
+			}
+		}
+		if err := aliases.save(); err != nil {
+			return err
+		}
+	}
+	return reportTagRewrites(notesDir, rewrites, dryRun, fmt.Sprintf("Merge tags %s into %q", strings.Join(tags, ", "), into))
+}
+
+func deleteTag(tag string, recursive, dryRun bool) error {
+	notesDir := viper.GetString("notes_directory")
+	aliases, err := loadTagAliases(notesDir)
+	if err != nil {
+		return err
+	}
+	tag = aliases.Canonical(tag)
+
+	rewrites, err := rewriteTags(notesDir, aliases, dryRun, func(t string) (string, bool) {
+		if t == tag || recursive && tagWithin(t, tag) {
+			return "", false
+		}
+		return t, true
+	})
+	if err != nil {
+		return err
+	}
+	return reportTagRewrites(notesDir, rewrites, dryRun, fmt.Sprintf("Delete tag %q", tag))
+}
+
+// reportTagRewrites prints the changes a tags command made, or would make,
+// and commits them.
+func reportTagRewrites(notesDir string, rewrites []tagRewrite, dryRun bool, message string) error {
+	if len(rewrites) == 0 {
+		fmt.Println("No notes changed")
+		return nil
+	}
+
+	paths := make([]string, 0, len(rewrites))
+	for _, r := range rewrites {
+		rel, err := filepath.Rel(notesDir, r.Path)
+		if err != nil {
+			rel = r.Path
+		}
+		fmt.Printf("%s: %s -> %s\n", rel, tagListString(r.From), tagListString(r.To))
+		paths = append(paths, r.Path)
+	}
+
+	if dryRun {
+		fmt.Printf("Would update %d notes\n", len(rewrites))
+		return nil
+	}
+	commitNotes(message, paths...)
+	fmt.Printf("Updated %d notes\n", len(rewrites))
+	return nil
+}
+
+func listTagAliases() error {
+	aliases, err := loadTagAliases(viper.GetString("notes_directory"))
+	if err != nil {
+		return err
+	}
+	tags := aliases.Tags()
+	if len(tags) == 0 {
+		fmt.Println("No tag aliases defined")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Tag\tAliases")
+	fmt.Fprintln(w, "---\t-------")
+	for _, tag := range tags {
+		fmt.Fprintf(w, "%s\t%s\n", tag, strings.Join(aliases.Aliases(tag), ", "))
+	}
+	return w.Flush()
+}
+
+func addTagAlias(alias, tag string, dryRun bool) error {
+	aliases, err := loadTagAliases(viper.GetString("notes_directory"))
+	if err != nil {
+		return err
+	}
+	tag = aliases.Canonical(tag)
+	if strings.EqualFold(alias, tag) {
+		return fmt.Errorf("'%s' cannot be an alias of itself", alias)
+	}
+	if len(aliases.canonical[alias]) > 0 {
+		return fmt.Errorf("'%s' has aliases of its own; merge it into '%s' with 'kg tags merge' instead", alias, tag)
+	}
+
+	if dryRun {
+		fmt.Printf("Would make '%s' an alias of '%s'\n", alias, tag)
+		return nil
+	}
+	aliases.Add(alias, tag)
+	if err := aliases.save(); err != nil {
+		return err
+	}
+	fmt.Printf("'%s' is now an alias of '%s'\n", alias, tag)
+	return nil
+}
+
+func removeTagAlias(alias string, dryRun bool) error {
+	aliases, err := loadTagAliases(viper.GetString("notes_directory"))
+	if err != nil {
+		return err
+	}
+	tag := aliases.Canonical(alias)
+	if tag == alias {
+		return fmt.Errorf("'%s' is not an alias", alias)
+	}
+
+	if dryRun {
+		fmt.Printf("Would remove alias '%s' of '%s'\n", alias, tag)
+		return nil
+	}
+	aliases.Remove(alias)
+	if err := aliases.save(); err != nil {
+		return err
+	}
+	fmt.Printf("Removed alias '%s' of '%s'\n", alias, tag)
+	return nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search/query"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func newTUICmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "tui",
+		Short: "Browse and navigate notes in a terminal interface",
+		Long: `Open a full-screen interface for browsing the vault. Type to pick a note by
+fuzzy matching its title, or press Ctrl+F to search note contents instead.
+The selected note is previewed with its frontmatter, and its relations,
+wikilinks and backlinks are listed below it: press Tab to move to them and
+Enter to follow one, and b to go back.
+
+Ctrl+E edits the selected note, Ctrl+L relates it to another note and
+Ctrl+T changes its tags. Esc clears the query, or quits when it is empty.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runTUI()
+		},
+	}
+}
+
+func runTUI() error {
+	notesDir := viper.GetString("notes_directory")
+	store, err := openEdgeStore(notesDir)
+	if err != nil {
+		return err
+	}
+
+	searcher := &tuiIndexSearcher{}
+	defer searcher.Close()
+
+	model := newTUIModel(store, searcher.Search, tuiEffects{
+		edit:    tuiEdit(notesDir),
+		connect: tuiConnectNotes(notesDir),
+		tag:     tuiTagNote(notesDir),
+	})
+	if _, err := tea.NewProgram(model, tea.WithAltScreen()).Run(); err != nil {
+		return fmt.Errorf("failed to run terminal interface: %w", err)
+	}
+	return nil
+}
+
+// tuiIndexSearcher searches the bleve index, opening it on first use so
+// that the interface starts without waiting for the vault to be indexed.
+type tuiIndexSearcher struct {
+	once  sync.Once
+	index bleve.Index
+	err   error
+}
+
+func (s *tuiIndexSearcher) Search(q string) ([]string, error) {
+	s.once.Do(func() {
+		s.index, s.err = createIndex()
+	})
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	request := bleve.NewSearchRequest(liveSearchQuery(q))
+	request.Size = 50
+	results, err := s.index.Search(request)
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+
+	paths := make([]string, 0, len(results.Hits))
+	for _, hit := range results.Hits {
+		paths = append(paths, hit.ID)
+	}
+	return paths, nil
+}
+
+func (s *tuiIndexSearcher) Close() {
+	if s.index != nil {
+		s.index.Close()
+	}
+}
+
+// liveSearchQuery is parseQuery for a query that is still being typed: the
+// last word also matches as a prefix, so results appear before it is
+// finished.
+func liveSearchQuery(q string) query.Query {
+	terms := strings.Fields(q)
+	last := terms[len(terms)-1]
+	if strings.HasPrefix(last, "-") || strings.HasPrefix(last, "+") {
+		return parseQuery(q)
+	}
+
+	partial := query.NewDisjunctionQuery([]query.Query{
+		query.NewMatchQuery(last),
+		query.NewPrefixQuery(strings.ToLower(last)),
+	})
+	if len(terms) == 1 {
+		return partial
+	}
+	return query.NewConjunctionQuery([]query.Query{parseQuery(strings.Join(terms[:len(terms)-1], " ")), partial})
+}
+
+// reloadVault reads the vault again after a change, keeping the note at
+// path selected.
+func reloadVault(notesDir, path, status string) tea.Msg {
+	store, err := openEdgeStore(notesDir)
+	if err != nil {
+		return tuiReloadMsg{err: err}
+	}
+	return tuiReloadMsg{store: store, path: path, status: status}
+}
+
+// tuiEditor runs editNoteFile while the interface has given up the
+// terminal.
+type tuiEditor struct {
+	path, title string
+}
+
+func (e tuiEditor) Run() error {
+	return editNoteFile(e.path, e.title)
+}
+
+func (e tuiEditor) SetStdin(io.Reader)  {}
+func (e tuiEditor) SetStdout(io.Writer) {}
+func (e tuiEditor) SetStderr(io.Writer) {}
+
+func tuiEdit(notesDir string) func(path, title string) tea.Cmd {
+	return func(path, title string) tea.Cmd {
+		return tea.Exec(tuiEditor{path, title}, func(err error) tea.Msg {
+			if err != nil {
+				return tuiReloadMsg{err: err}
+			}
+			return reloadVault(notesDir, path, fmt.Sprintf("Saved '%s'", title))
+		})
+	}
+}
+
+func tuiConnectNotes(notesDir string) func(fromPath, rel, toPath string) tea.Cmd {
+	return func(fromPath, rel, toPath string) tea.Cmd {
+		return func() tea.Msg {
+			store, err := openEdgeStore(notesDir)
+			if err != nil {
+				return tuiReloadMsg{err: err}
+			}
+			from, _, err := store.Note(fromPath)
+			if err != nil {
+				return tuiReloadMsg{err: err}
+			}
+			to, _, err := store.Note(toPath)
+			if err != nil {
+				return tuiReloadMsg{err: err}
+			}
+			changed, err := store.Add(fromPath, rel, toPath)
+			if err != nil {
+				return tuiReloadMsg{err: err}
+			}
+			if !changed {
+				return tuiReloadMsg{status: fmt.Sprintf("'%s' already %s '%s'", from.Title, rel, to.Title)}
+			}
+			commitNotes(fmt.Sprintf("Connect %q and %q", from.Title, to.Title), fromPath, toPath)
+			return reloadVault(notesDir, fromPath, fmt.Sprintf("'%s' %s '%s'", from.Title, rel, to.Title))
+		}
+	}
+}
+
+func tuiTagNote(notesDir string) func(path, title string, tags []string) tea.Cmd {
+	return func(path, title string, tags []string) tea.Cmd {
+		return func() tea.Msg {
+			if err := setNoteTags(path, tags); err != nil {
+				return tuiReloadMsg{err: err}
+			}
+			commitNotes(fmt.Sprintf("Tag note %q", title), path)
+			return reloadVault(notesDir, path, fmt.Sprintf("Tagged '%s': %s", title, tagListString(tags)))
+		}
+	}
+}
+
+// setNoteTags replaces a note's tags, keeping the rest of its frontmatter
+// as written.
+func setNoteTags(path string, tags []string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	updated, err := replaceNoteTags(string(content), tags)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, []byte(updated)); err != nil {
+		return fmt.Errorf("failed to write note: %w", err)
+	}
+	return nil
+}
@@ -3,8 +3,6 @@ package main
 import (
 	"fmt"
 	"os"
-	"path/filepath"
-	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -45,29 +43,23 @@ func visualizeGraph(cmd *cobra.Command, args []string) error {
 		graph.Set("args", arg)
 	}
 
-	err := filepath.Walk(notesDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if !info.IsDir() && strings.HasSuffix(info.Name(), ".md") {
-			note, err := parseNote(path)
-			if err != nil {
-				return fmt.Errorf("failed to parse note %s: %w", path, err)
-			}
+	notes, err := loadNotes(notesDir)
+	if err != nil {
+		return fmt.Errorf("failed to build graph: %w", err)
+	}
 
-			if shouldIncludeNote(note, filterTags) {
-				addNodeToGraph(graph, note)
-				addEdgesToGraph(graph, note)
-			}
+	var included []Note
+	for _, note := range notes {
+		if shouldIncludeNote(note, filterTags) {
+			included = append(included, note)
 		}
+	}
 
-		return nil
-	})
-
-	if err != nil {
-		return fmt.Errorf("failed to build graph: %w", err)
+	nodes := make(map[string]*dot.Node, len(included))
+	for _, note := range included {
+		nodes[noteKey(note.Filename)] = addNodeToGraph(graph, note)
 	}
+	addEdgesToGraph(graph, included, nodes)
 
 	if format == "html" {
 		return generateInteractiveHTML(graph, outputFile)
@@ -92,19 +84,43 @@ func shouldIncludeNote(note Note, filterTags []string) bool {
 	return false
 }
 
-func addNodeToGraph(graph *dot.Graph, note Note) {
-	n := dot.NewNode("KnowledgeGraph")
+func addNodeToGraph(graph *dot.Graph, note Note) *dot.Node {
+	n := dot.NewNode(noteKey(note.Filename))
 	n.Set("shape", "box")
 	n.Set("label", note.Title)
 	graph.AddNode(n)
+	return n
 }
 
-func addEdgesToGraph(graph *dot.Graph, note Note) {
-	for _, connection := range note.Connections {
-		_ = connection
-		// TODO:
-		// e := dot.NewEdge(conn..
-		// graph.AddEdge(note.Filename, connection, true, nil)
+// addEdgesToGraph draws an edge for every relation between included notes,
+// labelled with its type. A relation and the inverse recorded on the other
+// note are drawn once, in the direction of the configured type.
+func addEdgesToGraph(graph *dot.Graph, notes []Note, nodes map[string]*dot.Node) {
+	vocab := relationVocabularyFromConfig()
+	index := buildNoteIndex(notes)
+	seen := make(map[[3]string]bool)
+
+	for _, note := range notes {
+		for _, rel := range note.Relations {
+			i, ok := index[noteKey(rel.Target)]
+			if !ok {
+				continue
+			}
+			source, t, target := vocab.Canonical(noteKey(note.Filename), rel.Type, noteKey(notes[i].Filename))
+			key := [3]string{source, t, target}
+			if seen[key] || source == target {
+				continue
+			}
+			seen[key] = true
+
+			e := dot.NewEdge(nodes[source], nodes[target])
+			if t != defaultRelation {
+				e.Set("label", t)
+			} else {
+				e.Set("dir", "none")
+			}
+			graph.AddEdge(e)
+		}
 	}
 }
 
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestExcerpt(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		n    int
+		want string
+	}{
+		{"short", "a  b\nc", 10, "a b c"},
+		{"word break", "hello brave new world", 13, "hello brave…"},
+		{"no space", "abcdefgh", 5, "abcde…"},
+		{"inside a rune", "日本語テキスト", 7, "日本…"},
+		{"rune at the limit", "日本語テキスト", 6, "日本…"},
+		{"first rune too long", "日本語", 2, "…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := excerpt(tt.s, tt.n)
+			if got != tt.want {
+				t.Errorf("excerpt(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("excerpt(%q, %d) = %q is not valid UTF-8", tt.s, tt.n, got)
+			}
+		})
+	}
+}
+
+func TestNotePassages(t *testing.T) {
+	long := strings.Repeat("word ", maxPassageChars/5+100)
+	note := Note{Title: "Note", Content: "# Note\n\n" + long + "\n\nShort one.\n\n" + long + "\n\n" + long + "\n\nShort two."}
+
+	passages := notePassages(note, "A")
+	var texts []string
+	total := 0
+	for i, p := range passages {
+		if want := fmt.Sprintf("A%d", i+1); p.Label != want {
+			t.Errorf("passage %d labelled %s, want %s", i, p.Label, want)
+		}
+		if len(p.Text) > maxParagraphChars+len("…") {
+			t.Errorf("passage %s has %d bytes", p.Label, len(p.Text))
+		}
+		total += len(p.Text)
+		texts = append(texts, p.Text)
+	}
+	if len(passages) == 0 || !strings.HasPrefix(passages[0].Text, "word word") {
+		t.Fatalf("the long first paragraph was not sent: %q", texts)
+	}
+	for _, short := range []string{"Short one.", "Short two."} {
+		if !containsString(texts, short) {
+			t.Errorf("passages %q do not include %q", texts, short)
+		}
+	}
+	if total > maxPassageChars {
+		t.Errorf("passages hold %d bytes, over %d", total, maxPassageChars)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/spf13/viper"
+)
+
+func TestTitleFromFilename(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"notes/web-server.md", "Web Server"},
+		{"snake_case_name.md", "Snake Case Name"},
+		{"über-notes.md", "Über Notes"},
+		{"ärger_ñandú.md", "Ärger Ñandú"},
+		{"日本語-メモ.md", "日本語 メモ"},
+	}
+	for _, tt := range tests {
+		if got := titleFromFilename(tt.path); got != tt.want {
+			t.Errorf("titleFromFilename(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestDoctorFixesNonASCIITitles(t *testing.T) {
+	dir := writeVault(t, map[string]string{
+		"über-notes.md":  "No frontmatter; see [[ärger-liste]].\n",
+		"ärger-liste.md": "---\ndate: 2024-01-02\n---\nSee [[über-notes]].\n",
+	})
+	for key, value := range map[string]interface{}{"notes_directory": dir, "git.auto_commit": false} {
+		old := viper.Get(key)
+		viper.Set(key, value)
+		t.Cleanup(func() { viper.Set(key, old) })
+	}
+
+	if _, err := runDoctor("json", true); err != nil {
+		t.Fatal(err)
+	}
+
+	for file, title := range map[string]string{"über-notes.md": "Über Notes", "ärger-liste.md": "Ärger Liste"} {
+		path := filepath.Join(dir, file)
+		if content := readFile(t, path); !utf8.ValidString(content) {
+			t.Fatalf("%s is not valid UTF-8 after fixing:\n%q", file, content)
+		}
+		note, err := parseNote(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if note.Title != title {
+			t.Errorf("%s title = %q, want %q", file, note.Title, title)
+		}
+	}
+
+	findings, err := diagnoseVault(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range findings {
+		t.Errorf("after fixing: %s %s: %s", f.Check, f.Path, f.Message)
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Edge is a relation between two notes, identified by their titles.
+type Edge struct {
+	Source string `json:"source"`
+	Type   string `json:"type"`
+	Target string `json:"target"`
+}
+
+// edgeStore manages the relations recorded in note frontmatter. Notes are
+// named by title or filename and resolved to the notes they refer to, and
+// targets are always written as the target note's title. Adding an edge
+// that exists, or removing one that does not, changes nothing, and entries
+// the store does not touch are preserved.
+type edgeStore struct {
+	dir   string
+	vocab relationVocabulary
+	notes []Note
+	paths []string
+	index map[string]int
+}
+
+func openEdgeStore(notesDir string) (*edgeStore, error) {
+	if notesDir == "" {
+		return nil, fmt.Errorf("notes directory not set in config")
+	}
+
+	s := &edgeStore{dir: notesDir, vocab: relationVocabularyFromConfig()}
+	err := walkNotes(notesDir, func(path string, note Note) error {
+		s.notes = append(s.notes, note)
+		s.paths = append(s.paths, path)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load notes: %w", err)
+	}
+	s.index = buildNoteIndex(s.notes)
+	return s, nil
+}
+
+// resolve returns the index of the note name refers to, as resolveNote
+// finds it.
+func (s *edgeStore) resolve(name string) (int, error) {
+	return resolveNote(s.dir, s.notes, s.paths, name)
+}
+
+// Note returns the note a name refers to, and its path.
+func (s *edgeStore) Note(name string) (Note, string, error) {
+	i, err := s.resolve(name)
+	if err != nil {
+		return Note{}, "", err
+	}
+	return s.notes[i], s.paths[i], nil
+}
+
+// Add records that from relates to to with type rel, and the inverse
+// relation on to. It reports whether any note changed.
+func (s *edgeStore) Add(from, rel, to string) (bool, error) {
+	if !s.vocab.Known(rel) {
+		return false, s.unknownRelation(rel)
+	}
+	src, dst, err := s.resolvePair(from, to)
+	if err != nil {
+		return false, err
+	}
+
+	changed, err := s.addEntry(src, rel, s.notes[dst].Title)
+	if err != nil {
+		return false, err
+	}
+	if inverse := s.vocab.Inverse(rel); inverse != "" {
+		inverseChanged, err := s.addEntry(dst, inverse, s.notes[src].Title)
+		if err != nil {
+			return changed, err
+		}
+		changed = changed || inverseChanged
+	}
+	return changed, nil
+}
+
+// Remove deletes the relation of type rel from from to to, and its inverse.
+// With rel empty, every relation between the two notes is removed, in
+// either direction. It reports whether any note changed.
+func (s *edgeStore) Remove(from, rel, to string) (bool, error) {
+	if rel != "" && !s.vocab.Known(rel) {
+		return false, s.unknownRelation(rel)
+	}
+	src, dst, err := s.resolvePair(from, to)
+	if err != nil {
+		return false, err
+	}
+
+	changed, err := s.removeEntries(src, rel, dst)
+	if err != nil {
+		return false, err
+	}
+	inverse := ""
+	if rel != "" {
+		if inverse = s.vocab.Inverse(rel); inverse == "" {
+			return changed, nil
+		}
+	}
+	inverseChanged, err := s.removeEntries(dst, inverse, src)
+	if err != nil {
+		return changed, err
+	}
+	return changed || inverseChanged, nil
+}
+
+// List returns the relations of a note in both directions. A relation and
+// the inverse recorded on the other note are listed once, in the direction
+// of the configured type.
+func (s *edgeStore) List(name string) ([]Edge, error) {
+	i, err := s.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var edges []Edge
+	seen := make(map[Edge]bool)
+	add := func(source, t, target string) {
+		var e Edge
+		e.Source, e.Type, e.Target = s.vocab.Canonical(source, t, target)
+		if !seen[e] {
+			seen[e] = true
+			edges = append(edges, e)
+		}
+	}
+
+	for j, note := range s.notes {
+		for _, rel := range note.Relations {
+			target := rel.Target
+			if k, ok := s.index[noteKey(target)]; ok {
+				target = s.notes[k].Title
+				if j != i && k != i {
+					continue
+				}
+			} else if j != i {
+				continue
+			}
+			add(note.Title, rel.Type, target)
+		}
+	}
+	return edges, nil
+}
+
+func (s *edgeStore) resolvePair(from, to string) (int, int, error) {
+	src, err := s.resolve(from)
+	if err != nil {
+		return 0, 0, err
+	}
+	dst, err := s.resolve(to)
+	if err != nil {
+		return 0, 0, err
+	}
+	if src == dst {
+		return 0, 0, fmt.Errorf("cannot relate '%s' to itself", s.notes[src].Title)
+	}
+	return src, dst, nil
+}
+
+func (s *edgeStore) unknownRelation(rel string) error {
+	return fmt.Errorf("unknown relation type: %s. Use one of %s, or add it to relation_types in the config", rel, strings.Join(s.vocab.Types(), ", "))
+}
+
+func (s *edgeStore) addEntry(i int, rel, target string) (bool, error) {
+	return s.update(i, func(frontmatter map[string]interface{}) bool {
+		targets := stringList(frontmatter[rel])
+		for _, existing := range targets {
+			if noteKey(existing) == noteKey(target) {
+				return false
+			}
+		}
+		for _, r := range s.vocab.parseRelations(frontmatter) {
+			if r.Type == rel && noteKey(r.Target) == noteKey(target) {
+				return false
+			}
+		}
+		frontmatter[rel] = append(targets, target)
+		return true
+	})
+}
+
+// removeEntries removes relations of type rel (or of any type, when rel is
+// empty) pointing from note i to note j, however the target was written.
+func (s *edgeStore) removeEntries(i int, rel string, j int) (bool, error) {
+	matches := func(t, target string) bool {
+		k, ok := s.index[noteKey(target)]
+		return (rel == "" || t == rel) && ok && k == j
+	}
+
+	return s.update(i, func(frontmatter map[string]interface{}) bool {
+		changed := false
+		for _, t := range s.vocab.Types() {
+			if _, ok := frontmatter[t]; !ok {
+				continue
+			}
+			list := stringList(frontmatter[t])
+			var kept []string
+			for _, target := range list {
+				if !matches(t, target) {
+					kept = append(kept, target)
+				}
+			}
+			if len(kept) == len(list) {
+				continue
+			}
+			changed = true
+			if len(kept) == 0 {
+				delete(frontmatter, t)
+			} else {
+				frontmatter[t] = kept
+			}
+		}
+
+		if list, ok := frontmatter["relations"].([]interface{}); ok {
+			var kept []interface{}
+			for _, item := range list {
+				if m, ok := item.(map[string]interface{}); ok && matches(fmt.Sprint(m["type"]), fmt.Sprint(m["target"])) {
+					continue
+				}
+				kept = append(kept, item)
+			}
+			if len(kept) != len(list) {
+				changed = true
+				if len(kept) == 0 {
+					delete(frontmatter, "relations")
+				} else {
+					frontmatter["relations"] = kept
+				}
+			}
+		}
+		return changed
+	})
+}
+
+// update applies fn to the frontmatter of note i and writes the note back
+// if fn reports a change.
+func (s *edgeStore) update(i int, fn func(frontmatter map[string]interface{}) bool) (bool, error) {
+	path := s.paths[i]
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	frontmatter, rest, err := parseFrontmatter(string(content))
+	if err != nil {
+		return false, fmt.Errorf("failed to update %s: %w", path, err)
+	}
+	if frontmatter == nil {
+		frontmatter = map[string]interface{}{}
+	}
+
+	if !fn(frontmatter) {
+		return false, nil
+	}
+	if err := rewriteFrontmatter(path, frontmatter, rest); err != nil {
+		return false, fmt.Errorf("failed to update %s: %w", path, err)
+	}
+
+	note, err := parseNote(path)
+	if err != nil {
+		return true, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	s.notes[i] = note
+	return true, nil
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// edgeVault records one relation both ways, spelling the target by file
+// name on one side and in lower case on the other, and another only in a
+// relations list.
+var edgeVault = map[string]string{
+	"web_server.md": "---\ntitle: Web Server\ndepends_on: [http]\n---\nbody\n",
+	"http.md":       "---\ntitle: HTTP\nrequired_by: [web server]\n---\nbody\n",
+	"tcp.md":        "---\ntitle: TCP\nrelations:\n  - type: part_of\n    target: networking.md\n---\nbody\n",
+	"networking.md": "---\ntitle: Networking\n---\nbody\n",
+	"dns.md":        "---\ntitle: DNS\n---\nbody\n",
+}
+
+// noteRelations returns the relations recorded in a note's file, as
+// sorted "type target" strings.
+func noteRelations(t *testing.T, dir, file string) []string {
+	t.Helper()
+	note, err := parseNote(filepath.Join(dir, file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var relations []string
+	for _, r := range note.Relations {
+		relations = append(relations, r.Type+" "+r.Target)
+	}
+	sort.Strings(relations)
+	return relations
+}
+
+func TestEdgeStoreAdd(t *testing.T) {
+	tests := []struct {
+		name        string
+		from, rel   string
+		to          string
+		wantChanged bool
+		wantErr     string
+		want        map[string][]string
+	}{
+		{
+			name: "writes the inverse", from: "Web Server", rel: "depends_on", to: "TCP", wantChanged: true,
+			want: map[string][]string{
+				"web_server.md": {"depends_on TCP", "depends_on http"},
+				"tcp.md":        {"part_of networking.md", "required_by Web Server"},
+			},
+		},
+		{
+			name: "symmetric relation", from: "dns", rel: "connected_to", to: "networking.md", wantChanged: true,
+			want: map[string][]string{
+				"dns.md":        {"connected_to Networking"},
+				"networking.md": {"connected_to DNS"},
+			},
+		},
+		{
+			name: "existing relation under another spelling", from: "HTTP", rel: "required_by", to: "web_server.md",
+			want: map[string][]string{
+				"web_server.md": {"depends_on http"},
+				"http.md":       {"required_by web server"},
+			},
+		},
+		{
+			name: "relations list entry counts", from: "TCP", rel: "part_of", to: "Networking", wantChanged: true,
+			want: map[string][]string{
+				"tcp.md":        {"part_of networking.md"},
+				"networking.md": {"has_part TCP"},
+			},
+		},
+		{
+			name: "inverse type given", from: "Networking", rel: "has_part", to: "DNS", wantChanged: true,
+			want: map[string][]string{
+				"networking.md": {"has_part DNS"},
+				"dns.md":        {"part_of Networking"},
+			},
+		},
+		{name: "unknown type", from: "DNS", rel: "likes", to: "TCP", wantErr: "unknown relation type: likes"},
+		{name: "itself", from: "DNS", rel: "cites", to: "dns.md", wantErr: "cannot relate 'DNS' to itself"},
+		{name: "missing note", from: "DNS", rel: "cites", to: "Kerberos", wantErr: "note 'Kerberos' not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeVault(t, edgeVault)
+			store, err := openEdgeStore(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			changed, err := store.Add(tt.from, tt.rel, tt.to)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Add() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("Add() changed = %v, want %v", changed, tt.wantChanged)
+			}
+			for file, want := range tt.want {
+				if got := noteRelations(t, dir, file); !reflect.DeepEqual(got, want) {
+					t.Errorf("%s relations = %q, want %q", file, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEdgeStoreRemove(t *testing.T) {
+	tests := []struct {
+		name        string
+		from, rel   string
+		to          string
+		wantChanged bool
+		wantErr     string
+		want        map[string][]string
+	}{
+		{
+			name: "removes the inverse", from: "Web Server", rel: "depends_on", to: "HTTP", wantChanged: true,
+			want: map[string][]string{"web_server.md": nil, "http.md": nil},
+		},
+		{
+			name: "from the inverse side", from: "http.md", rel: "required_by", to: "web server", wantChanged: true,
+			want: map[string][]string{"web_server.md": nil, "http.md": nil},
+		},
+		{
+			name: "every type", from: "HTTP", to: "Web Server", wantChanged: true,
+			want: map[string][]string{"web_server.md": nil, "http.md": nil},
+		},
+		{
+			name: "relations list entry", from: "tcp", rel: "part_of", to: "Networking", wantChanged: true,
+			want: map[string][]string{"tcp.md": nil},
+		},
+		{
+			name: "other type kept", from: "Web Server", rel: "cites", to: "HTTP",
+			want: map[string][]string{"web_server.md": {"depends_on http"}, "http.md": {"required_by web server"}},
+		},
+		{name: "unknown type", from: "DNS", rel: "likes", to: "TCP", wantErr: "unknown relation type: likes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeVault(t, edgeVault)
+			store, err := openEdgeStore(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			changed, err := store.Remove(tt.from, tt.rel, tt.to)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Remove() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("Remove() changed = %v, want %v", changed, tt.wantChanged)
+			}
+			for file, want := range tt.want {
+				if got := noteRelations(t, dir, file); !reflect.DeepEqual(got, want) {
+					t.Errorf("%s relations = %q, want %q", file, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEdgeStoreList(t *testing.T) {
+	dir := writeVault(t, edgeVault)
+	store, err := openEdgeStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	webDependsOnHTTP := []Edge{{Source: "Web Server", Type: "depends_on", Target: "HTTP"}}
+	tcpPartOfNetworking := []Edge{{Source: "TCP", Type: "part_of", Target: "Networking"}}
+
+	tests := []struct {
+		name string
+		want []Edge
+	}{
+		{"Web Server", webDependsOnHTTP},
+		{"HTTP", webDependsOnHTTP},
+		{"web_server.md", webDependsOnHTTP},
+		{"http", webDependsOnHTTP},
+		{"TCP", tcpPartOfNetworking},
+		{"Networking", tcpPartOfNetworking},
+		{filepath.Join(dir, "networking.md"), tcpPartOfNetworking},
+		{"DNS", nil},
+	}
+	for _, tt := range tests {
+		t.Run(filepath.Base(tt.name), func(t *testing.T) {
+			got, err := store.List(tt.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("List(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/viper"
+	"github.com/tmc/langchaingo/llms/openai"
+)
+
+// defaultEmbeddingModel is used unless embedding_model is configured.
+const defaultEmbeddingModel = "text-embedding-3-small"
+
+// embeddingBatchSize bounds how many notes are sent in one embeddings
+// request. Notes are cut to 8000 characters, so a batch stays well within
+// the API's per-request input limits.
+const embeddingBatchSize = 100
+
+// embeddingCache keeps note embeddings in .kg/embeddings.json, keyed by
+// the note's slash-separated path relative to the notes directory and
+// checked against a hash of the embedded text, so only new or changed notes
+// are sent to the API again.
+type embeddingCache struct {
+	path    string
+	Model   string                     `json:"model"`
+	Vectors map[string]cachedEmbedding `json:"vectors"`
+}
+
+type cachedEmbedding struct {
+	Hash   string    `json:"hash"`
+	Vector []float32 `json:"vector"`
+}
+
+func embeddingCachePath(notesDir string) string {
+	return filepath.Join(notesDir, ".kg", "embeddings.json")
+}
+
+func embeddingModel() string {
+	if model := viper.GetString("embedding_model"); model != "" {
+		return model
+	}
+	return defaultEmbeddingModel
+}
+
+func newEmbedder() (*openai.LLM, error) {
+	llm, err := openai.New(openai.WithEmbeddingModel(embeddingModel()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OpenAI client: %w", err)
+	}
+	return llm, nil
+}
+
+// noteEmbeddings returns an embedding for each note, in order, using and
+// updating the cache in notesDir. paths are the notes' files.
+func noteEmbeddings(notesDir string, notes []Note, paths []string) ([][]float32, error) {
+	cache := &embeddingCache{path: embeddingCachePath(notesDir)}
+	if data, err := os.ReadFile(cache.path); err == nil {
+		if err := json.Unmarshal(data, cache); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", cache.path, err)
+		}
+	}
+	if cache.Model != embeddingModel() || cache.Vectors == nil {
+		cache.Model = embeddingModel()
+		cache.Vectors = make(map[string]cachedEmbedding)
+	}
+
+	vectors := make([][]float32, len(notes))
+	var missing []int
+	var texts []string
+	keys := make([]string, len(notes))
+	hashes := make([]string, len(notes))
+	for i, note := range notes {
+		rel, err := filepath.Rel(notesDir, paths[i])
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = filepath.ToSlash(rel)
+		text := excerpt(noteText(note), 8000)
+		sum := sha256.Sum256([]byte(text))
+		hashes[i] = hex.EncodeToString(sum[:])
+		if cached, ok := cache.Vectors[keys[i]]; ok && cached.Hash == hashes[i] {
+			vectors[i] = cached.Vector
+			continue
+		}
+		missing = append(missing, i)
+		texts = append(texts, text)
+	}
+	if len(missing) == 0 {
+		return vectors, nil
+	}
+
+	llm, err := newEmbedder()
+	if err != nil {
+		return nil, err
+	}
+	// The cache is saved after every batch, so an error part way through a
+	// large vault does not lose the embeddings already paid for.
+	for start := 0; start < len(missing); start += embeddingBatchSize {
+		end := min(start+embeddingBatchSize, len(missing))
+		created, err := llm.CreateEmbedding(context.TODO(), texts[start:end])
+		if err != nil {
+			return nil, fmt.Errorf("failed to create embeddings: %w", err)
+		}
+		if len(created) != end-start {
+			return nil, fmt.Errorf("failed to create embeddings: got %d for %d notes", len(created), end-start)
+		}
+		for k, i := range missing[start:end] {
+			vectors[i] = created[k]
+			cache.Vectors[keys[i]] = cachedEmbedding{Hash: hashes[i], Vector: created[k]}
+		}
+		if err := cache.save(); err != nil {
+			return nil, err
+		}
+	}
+	return vectors, nil
+}
+
+func (c *embeddingCache) save() error {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to save embeddings: %w", err)
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to save embeddings: %w", err)
+	}
+	if err := os.WriteFile(c.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to save embeddings: %w", err)
+	}
+	return nil
+}
+
+// embedText returns the embedding of a single piece of text, such as a
+// question, with the same model as the notes.
+func embedText(text string) ([]float32, error) {
+	llm, err := newEmbedder()
+	if err != nil {
+		return nil, err
+	}
+	vectors, err := llm.CreateEmbedding(context.TODO(), []string{text})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embedding: %w", err)
+	}
+	if len(vectors) != 1 {
+		return nil, fmt.Errorf("failed to create embedding: got %d results", len(vectors))
+	}
+	return vectors[0], nil
+}
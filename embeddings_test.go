@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNoteEmbeddingsCacheKeyedByPath(t *testing.T) {
+	dir := writeVault(t, map[string]string{
+		"a/note.md": "---\ntitle: First\n---\nfirst\n",
+		"b/note.md": "---\ntitle: Second\n---\nsecond\n",
+	})
+	store, err := openEdgeStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// With both notes cached under their own paths, nothing is sent to the
+	// API and each note gets its own vector back.
+	want := map[string][]float32{"a/note.md": {1, 0}, "b/note.md": {0, 1}}
+	cache := embeddingCache{Model: embeddingModel(), Vectors: make(map[string]cachedEmbedding)}
+	for i, note := range store.notes {
+		rel, err := filepath.Rel(dir, store.paths[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256([]byte(excerpt(noteText(note), 8000)))
+		cache.Vectors[filepath.ToSlash(rel)] = cachedEmbedding{Hash: hex.EncodeToString(sum[:]), Vector: want[filepath.ToSlash(rel)]}
+	}
+	data, err := json.Marshal(cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, ".kg"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(embeddingCachePath(dir), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	vectors, err := noteEmbeddings(dir, store.notes, store.paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, path := range store.paths {
+		rel, _ := filepath.Rel(dir, path)
+		if !reflect.DeepEqual(vectors[i], want[filepath.ToSlash(rel)]) {
+			t.Errorf("%s embedding = %v, want %v", rel, vectors[i], want[filepath.ToSlash(rel)])
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// fuzzyScore reports whether the letters of pattern appear in s in order,
+// ignoring case, and how well they match: higher is better. Matches at the
+// start of words and runs of consecutive letters score more, and gaps and
+// unmatched letters score less, so that "ws" ranks "Web Server" above
+// "Weather Station Logs".
+func fuzzyScore(pattern, s string) (int, bool) {
+	p := []rune(strings.ToLower(strings.TrimSpace(pattern)))
+	text := []rune(s)
+	lower := []rune(strings.ToLower(s))
+	if len(p) == 0 {
+		return 0, true
+	}
+
+	score, pi, last := 0, 0, -1
+	for i := 0; i < len(lower) && pi < len(p); i++ {
+		if lower[i] != p[pi] {
+			continue
+		}
+		switch {
+		case i == 0:
+			score += 15
+		case !unicode.IsLetter(text[i-1]) && !unicode.IsDigit(text[i-1]),
+			unicode.IsUpper(text[i]) && unicode.IsLower(text[i-1]):
+			score += 10
+		}
+		if last >= 0 && i == last+1 {
+			score += 8
+		} else if last >= 0 {
+			score -= min(i-last-1, 5)
+		}
+		score += 4
+		last = i
+		pi++
+	}
+	if pi < len(p) {
+		return 0, false
+	}
+
+	switch l := strings.ToLower(strings.TrimSpace(pattern)); {
+	case l == strings.ToLower(s):
+		score += 100
+	case strings.HasPrefix(strings.ToLower(s), l):
+		score += 30
+	case strings.Contains(strings.ToLower(s), l):
+		score += 15
+	}
+	return score - (len(lower)-len(p))/4, true
+}
+
+// fuzzyRank returns the indexes of the candidates pattern matches, best
+// first. Ties keep the candidates' order.
+func fuzzyRank(pattern string, candidates []string) []int {
+	var matches []int
+	scores := make(map[int]int)
+	for i, c := range candidates {
+		if score, ok := fuzzyScore(pattern, c); ok {
+			matches = append(matches, i)
+			scores[i] = score
+		}
+	}
+	sort.SliceStable(matches, func(a, b int) bool { return scores[matches[a]] > scores[matches[b]] })
+	return matches
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// runGit runs git in dir and returns its standard output without the
+// trailing newline.
+func runGit(dir string, args ...string) (string, error) {
+	out, err := gitOutput(dir, args...)
+	return strings.TrimRight(string(out), "\n"), err
+}
+
+// gitOutput runs git in dir and returns its standard output as is. Errors
+// include what git printed to standard error.
+func gitOutput(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return stdout.Bytes(), nil
+}
+
+// isGitRepo reports whether dir is inside a git working tree.
+func isGitRepo(dir string) bool {
+	out, err := runGit(dir, "rev-parse", "--is-inside-work-tree")
+	return err == nil && out == "true"
+}
+
+// requireGitRepo returns an error explaining how to enable history when the
+// notes directory is not under git.
+func requireGitRepo(notesDir string) error {
+	if notesDir == "" {
+		return fmt.Errorf("notes directory not set in config")
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return fmt.Errorf("git is not installed")
+	}
+	if !isGitRepo(notesDir) {
+		return fmt.Errorf("notes directory %s is not a git repository; run 'git init' there to keep note history", notesDir)
+	}
+	return nil
+}
+
+// commitNotes commits paths in the notes directory with message when
+// git.auto_commit is enabled. Paths may be relative to the notes directory
+// or include it. Only the given paths are committed, so that changes made
+// outside kg stay for the user to commit. Failing to commit never fails the
+// command that already wrote the notes; it is reported as a warning
+// instead.
+func commitNotes(message string, paths ...string) {
+	if !viper.GetBool("git.auto_commit") {
+		return
+	}
+	notesDir := viper.GetString("notes_directory")
+	if err := requireGitRepo(notesDir); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: git.auto_commit is set but %v\n", err)
+		return
+	}
+	rels := make([]string, len(paths))
+	for i, path := range paths {
+		rels[i] = path
+		if rel, err := filepath.Rel(notesDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+			rels[i] = rel
+		}
+	}
+	if err := gitCommit(notesDir, message, rels); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to commit changes: %v\n", err)
+	}
+}
+
+// gitCommit stages and commits paths in dir, deleted ones included. It
+// does nothing when there are no paths or none of them changed.
+func gitCommit(dir, message string, paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	pathspec := append([]string{"--"}, paths...)
+
+	if _, err := runGit(dir, append([]string{"add", "-A"}, pathspec...)...); err != nil {
+		return err
+	}
+	status, err := runGit(dir, append([]string{"status", "--porcelain"}, pathspec...)...)
+	if err != nil {
+		return err
+	}
+	if status == "" {
+		return nil
+	}
+
+	_, err = runGit(dir, append([]string{"commit", "-q", "-m", message}, pathspec...)...)
+	return err
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// initRepo creates a git repository holding files in a single commit.
+func initRepo(t *testing.T, files map[string]string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := writeVault(t, files)
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"config", "user.name", "kg test"},
+		{"config", "user.email", "kg@example.com"},
+		{"config", "commit.gpgsign", "false"},
+		{"add", "-A"},
+		{"commit", "-q", "-m", "initial"},
+	} {
+		if _, err := runGit(dir, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// gitState returns the subject of the last commit, the files it changed
+// and what is left uncommitted.
+func gitState(t *testing.T, dir string) (string, []string, string) {
+	t.Helper()
+	subject, err := runGit(dir, "log", "-1", "--format=%s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := runGit(dir, "show", "--name-only", "--format=", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := runGit(dir, "status", "--porcelain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return subject, strings.Fields(files), status
+}
+
+func TestGitCommit(t *testing.T) {
+	tests := []struct {
+		name        string
+		change      func(dir string) error
+		paths       []string
+		wantSubject string
+		wantFiles   []string
+		wantStatus  string
+	}{
+		{
+			name: "only the given paths",
+			change: func(dir string) error {
+				if err := os.WriteFile(filepath.Join(dir, "a.md"), []byte("changed"), 0644); err != nil {
+					return err
+				}
+				return os.WriteFile(filepath.Join(dir, "b.md"), []byte("unrelated"), 0644)
+			},
+			paths:       []string{"a.md"},
+			wantSubject: "change",
+			wantFiles:   []string{"a.md"},
+			wantStatus:  " M b.md",
+		},
+		{
+			name: "new and deleted files",
+			change: func(dir string) error {
+				if err := os.WriteFile(filepath.Join(dir, "sub", "new.md"), []byte("new"), 0644); err != nil {
+					return err
+				}
+				return os.Remove(filepath.Join(dir, "a.md"))
+			},
+			paths:       []string{"a.md", "sub/new.md"},
+			wantSubject: "change",
+			wantFiles:   []string{"a.md", "sub/new.md"},
+		},
+		{
+			name: "no paths commits nothing",
+			change: func(dir string) error {
+				return os.WriteFile(filepath.Join(dir, "b.md"), []byte("unrelated"), 0644)
+			},
+			wantSubject: "initial",
+			wantFiles:   []string{"a.md", "b.md", "sub/c.md"},
+			wantStatus:  " M b.md",
+		},
+		{
+			name:        "unchanged paths commit nothing",
+			change:      func(dir string) error { return nil },
+			paths:       []string{"a.md"},
+			wantSubject: "initial",
+			wantFiles:   []string{"a.md", "b.md", "sub/c.md"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := initRepo(t, map[string]string{"a.md": "a", "b.md": "b", "sub/c.md": "c"})
+			if err := tt.change(dir); err != nil {
+				t.Fatal(err)
+			}
+			if err := gitCommit(dir, "change", tt.paths); err != nil {
+				t.Fatal(err)
+			}
+
+			subject, files, status := gitState(t, dir)
+			if subject != tt.wantSubject {
+				t.Errorf("last commit %q, want %q", subject, tt.wantSubject)
+			}
+			if !reflect.DeepEqual(files, tt.wantFiles) {
+				t.Errorf("last commit changed %q, want %q", files, tt.wantFiles)
+			}
+			if status != tt.wantStatus {
+				t.Errorf("uncommitted %q, want %q", status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestCommitNotes(t *testing.T) {
+	dir := initRepo(t, map[string]string{"a.md": "a", "b.md": "b"})
+	for key, value := range map[string]interface{}{"notes_directory": dir, "git.auto_commit": true} {
+		old := viper.Get(key)
+		viper.Set(key, value)
+		t.Cleanup(func() { viper.Set(key, old) })
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "a.md"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "b.md"), []byte("unrelated"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	paths := []string{filepath.Join(dir, "a.md")}
+	commitNotes("Edit note \"a\"", paths...)
+	if paths[0] != filepath.Join(dir, "a.md") {
+		t.Errorf("commitNotes changed the caller's paths to %q", paths)
+	}
+
+	subject, files, status := gitState(t, dir)
+	if subject != `Edit note "a"` || !reflect.DeepEqual(files, []string{"a.md"}) {
+		t.Errorf("last commit %q changed %q, want a.md", subject, files)
+	}
+	if status != " M b.md" {
+		t.Errorf("uncommitted %q, want b.md", status)
+	}
+}
+
+func TestIsGitRepo(t *testing.T) {
+	repo := initRepo(t, map[string]string{"a.md": "a"})
+	if !isGitRepo(repo) || !isGitRepo(filepath.Join(repo, ".")) {
+		t.Errorf("isGitRepo(%s) = false", repo)
+	}
+	if err := requireGitRepo(repo); err != nil {
+		t.Errorf("requireGitRepo: %v", err)
+	}
+
+	plain := t.TempDir()
+	if isGitRepo(plain) {
+		t.Skipf("%s is inside a git repository", plain)
+	}
+	if err := requireGitRepo(plain); err == nil || !strings.Contains(err.Error(), "git init") {
+		t.Errorf("requireGitRepo outside a repository: %v", err)
+	}
+}
+
+// noteRevisions sets up a repository in which note.md has been committed
+// with the contents v1 and then v2, with the notes directory at sub below
+// the repository root, and points the config at it.
+func noteRevisions(t *testing.T, sub string) string {
+	t.Helper()
+	root := initRepo(t, map[string]string{filepath.Join(sub, "note.md"): "---\ntitle: Note\n---\nv1\n"})
+	dir := filepath.Join(root, sub)
+	if err := os.WriteFile(filepath.Join(dir, "note.md"), []byte("---\ntitle: Note\n---\nv2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := gitCommit(dir, "second", []string{"note.md"}); err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range map[string]interface{}{"notes_directory": dir, "git.auto_commit": true} {
+		old := viper.Get(key)
+		viper.Set(key, value)
+		t.Cleanup(func() { viper.Set(key, old) })
+	}
+	return dir
+}
+
+// notesLayouts are notes directories at and below the repository root.
+var notesLayouts = []string{".", "vault"}
+
+func TestNoteAtRevision(t *testing.T) {
+	for _, sub := range notesLayouts {
+		t.Run(sub, func(t *testing.T) {
+			dir := noteRevisions(t, sub)
+			for rev, want := range map[string]string{"": "v2", "HEAD": "v2", "HEAD~1": "v1"} {
+				got, err := noteAtRevision(dir, "note.md", rev)
+				if err != nil {
+					t.Fatalf("noteAtRevision(%q): %v", rev, err)
+				}
+				if !strings.HasSuffix(got, want+"\n") {
+					t.Errorf("noteAtRevision(%q) = %q, want %s", rev, got, want)
+				}
+			}
+			if _, err := noteAtRevision(dir, "note.md", "nope"); err == nil || !strings.Contains(err.Error(), "note not found at revision 'nope'") {
+				t.Errorf("unknown revision: %v", err)
+			}
+			if _, err := noteAtRevision(dir, "other.md", "HEAD"); err == nil {
+				t.Errorf("a note that was never committed was found")
+			}
+		})
+	}
+}
+
+func TestShowHistory(t *testing.T) {
+	for _, sub := range notesLayouts {
+		t.Run(sub, func(t *testing.T) {
+			dir := noteRevisions(t, sub)
+
+			out, err := captureStdout(t, func() error { return showHistory("Note", 0) })
+			if err != nil {
+				t.Fatal(err)
+			}
+			second, initial := strings.Index(out, "second"), strings.Index(out, "initial")
+			if second < 0 || initial < 0 || second > initial {
+				t.Errorf("history is not newest first:\n%s", out)
+			}
+
+			out, err = captureStdout(t, func() error { return showHistory("note.md", 1) })
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(out, "second") || strings.Contains(out, "initial") {
+				t.Errorf("history limited to 1:\n%s", out)
+			}
+
+			if err := os.WriteFile(filepath.Join(dir, "new.md"), []byte("---\ntitle: New\n---\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := captureStdout(t, func() error { return showHistory("New", 0) }); err == nil || !strings.Contains(err.Error(), "no committed revisions") {
+				t.Errorf("history of an uncommitted note: %v", err)
+			}
+		})
+	}
+}
+
+func TestDiffNote(t *testing.T) {
+	for _, sub := range notesLayouts {
+		t.Run(sub, func(t *testing.T) {
+			dir := noteRevisions(t, sub)
+			if err := os.WriteFile(filepath.Join(dir, "note.md"), []byte("---\ntitle: Note\n---\nv3\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			tests := []struct {
+				rev  string
+				want []string
+			}{
+				{"HEAD", []string{"--- note.md (HEAD)", "+++ note.md\n", "-v2", "+v3"}},
+				{"HEAD~1", []string{"--- note.md (HEAD~1)", "-v1", "+v3"}},
+				{"HEAD~1..HEAD", []string{"--- note.md (HEAD~1)", "+++ note.md (HEAD)", "-v1", "+v2"}},
+				{"HEAD..HEAD", []string{"No changes to 'Note'"}},
+			}
+			for _, tt := range tests {
+				out, err := captureStdout(t, func() error { return diffNote("Note", tt.rev) })
+				if err != nil {
+					t.Fatalf("diff %s: %v", tt.rev, err)
+				}
+				for _, want := range tt.want {
+					if !strings.Contains(out, want) {
+						t.Errorf("diff %s does not contain %q:\n%s", tt.rev, want, out)
+					}
+				}
+			}
+
+			if _, err := captureStdout(t, func() error { return diffNote("Note", "HEAD~1..nope") }); err == nil {
+				t.Errorf("diff to an unknown revision succeeded")
+			}
+		})
+	}
+}
+
+func TestRevertNote(t *testing.T) {
+	for _, sub := range notesLayouts {
+		t.Run(sub, func(t *testing.T) {
+			dir := noteRevisions(t, sub)
+			if err := os.WriteFile(filepath.Join(dir, "other.md"), []byte("unrelated"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := captureStdout(t, func() error { return revertNote("Note", "HEAD~1") }); err != nil {
+				t.Fatal(err)
+			}
+			if got := readFile(t, filepath.Join(dir, "note.md")); got != "---\ntitle: Note\n---\nv1\n" {
+				t.Errorf("note after revert = %q", got)
+			}
+
+			subject, files, status := gitState(t, dir)
+			if !strings.HasPrefix(subject, `Revert note "Note" to `) {
+				t.Errorf("last commit %q", subject)
+			}
+			if want := []string{filepath.ToSlash(filepath.Join(sub, "note.md"))}; !reflect.DeepEqual(files, want) {
+				t.Errorf("revert committed %q, want %q", files, want)
+			}
+			if !strings.Contains(status, "other.md") {
+				t.Errorf("unrelated file was committed: status %q", status)
+			}
+
+			if _, err := captureStdout(t, func() error { return revertNote("Note", "nope") }); err == nil {
+				t.Errorf("reverting to an unknown revision succeeded")
+			}
+		})
+	}
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"sort"
+)
+
+// noteGraph is the knowledge graph held in memory for analysis: an
+// undirected graph with a node per note and an edge between every pair of
+// notes that are related, however many relations they share. Relations
+// keep their direction in the edge labels, for display.
+type noteGraph struct {
+	notes []Note
+	adj   [][]int
+	edges map[[2]int]Edge
+}
+
+// newNoteGraph builds the graph of the notes in store. With links set,
+// wikilinks in note bodies count as edges too, with type "links_to".
+func newNoteGraph(store *edgeStore, links bool) *noteGraph {
+	g := &noteGraph{
+		notes: store.notes,
+		adj:   make([][]int, len(store.notes)),
+		edges: make(map[[2]int]Edge),
+	}
+	add := func(i, j int, e Edge) {
+		if i == j {
+			return
+		}
+		key := [2]int{min(i, j), max(i, j)}
+		if _, ok := g.edges[key]; ok {
+			return
+		}
+		g.edges[key] = e
+		g.adj[i] = append(g.adj[i], j)
+		g.adj[j] = append(g.adj[j], i)
+	}
+
+	for i, note := range store.notes {
+		for _, r := range note.Relations {
+			j, ok := store.index[noteKey(r.Target)]
+			if !ok {
+				continue
+			}
+			var e Edge
+			e.Source, e.Type, e.Target = store.vocab.Canonical(note.Title, r.Type, store.notes[j].Title)
+			add(i, j, e)
+		}
+	}
+	if links {
+		for i, note := range store.notes {
+			for _, link := range extractWikilinks(note.Content) {
+				if j, ok := store.index[noteKey(link.Target)]; ok {
+					add(i, j, Edge{Source: note.Title, Type: "links_to", Target: store.notes[j].Title})
+				}
+			}
+		}
+	}
+
+	for i := range g.adj {
+		sort.Ints(g.adj[i])
+	}
+	return g
+}
+
+// Edge returns the relation between two adjacent notes.
+func (g *noteGraph) Edge(i, j int) Edge {
+	return g.edges[[2]int{min(i, j), max(i, j)}]
+}
+
+// Degree returns the number of notes related to note i.
+func (g *noteGraph) Degree(i int) int {
+	return len(g.adj[i])
+}
+
+// distances runs a breadth-first search from src, stopping at depth
+// maxDepth when it is positive, and returns each reached note's distance
+// and the note it was reached from. Unreached notes have distance -1.
+func (g *noteGraph) distances(src, maxDepth int) (dist, prev []int) {
+	dist = make([]int, len(g.notes))
+	prev = make([]int, len(g.notes))
+	for i := range dist {
+		dist[i], prev[i] = -1, -1
+	}
+	dist[src] = 0
+	queue := []int{src}
+	for len(queue) > 0 {
+		u := queue[0]
+		queue = queue[1:]
+		if maxDepth > 0 && dist[u] == maxDepth {
+			continue
+		}
+		for _, v := range g.adj[u] {
+			if dist[v] < 0 {
+				dist[v] = dist[u] + 1
+				prev[v] = u
+				queue = append(queue, v)
+			}
+		}
+	}
+	return dist, prev
+}
+
+// ShortestPath returns the notes on a shortest path from a to b, both
+// included, or nil if they are not connected.
+func (g *noteGraph) ShortestPath(a, b int) []int {
+	dist, prev := g.distances(a, 0)
+	if dist[b] < 0 {
+		return nil
+	}
+	path := []int{b}
+	for v := b; v != a; v = prev[v] {
+		path = append(path, prev[v])
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// Neighbors returns the notes within depth steps of note i, nearest first,
+// with their distances.
+func (g *noteGraph) Neighbors(i, depth int) ([]int, []int) {
+	dist, _ := g.distances(i, depth)
+	var found []int
+	for j, d := range dist {
+		if d > 0 {
+			found = append(found, j)
+		}
+	}
+	sort.SliceStable(found, func(a, b int) bool { return dist[found[a]] < dist[found[b]] })
+	return found, dist
+}
+
+// PageRank scores notes by how well connected they are to other well
+// connected notes. Scores sum to 1.
+func (g *noteGraph) PageRank(damping float64, iterations int) []float64 {
+	n := len(g.notes)
+	if n == 0 {
+		return nil
+	}
+	rank := make([]float64, n)
+	for i := range rank {
+		rank[i] = 1 / float64(n)
+	}
+	next := make([]float64, n)
+	for iter := 0; iter < iterations; iter++ {
+		// Notes without relations spread their rank over every note.
+		dangling := 0.0
+		for i := range rank {
+			if len(g.adj[i]) == 0 {
+				dangling += rank[i]
+			}
+		}
+		base := (1-damping)/float64(n) + damping*dangling/float64(n)
+		for i := range next {
+			next[i] = base
+		}
+		for i, neighbors := range g.adj {
+			share := damping * rank[i] / float64(len(neighbors))
+			for _, j := range neighbors {
+				next[j] += share
+			}
+		}
+		rank, next = next, rank
+	}
+	return rank
+}
+
+// Betweenness scores notes by the fraction of shortest paths between other
+// notes that pass through them, using Brandes' algorithm. Scores are
+// normalized to between 0 and 1.
+func (g *noteGraph) Betweenness() []float64 {
+	n := len(g.notes)
+	score := make([]float64, n)
+	for s := 0; s < n; s++ {
+		var stack []int
+		preds := make([][]int, n)
+		sigma := make([]float64, n)
+		dist := make([]int, n)
+		for i := range dist {
+			dist[i] = -1
+		}
+		sigma[s], dist[s] = 1, 0
+		queue := []int{s}
+		for len(queue) > 0 {
+			v := queue[0]
+			queue = queue[1:]
+			stack = append(stack, v)
+			for _, w := range g.adj[v] {
+				if dist[w] < 0 {
+					dist[w] = dist[v] + 1
+					queue = append(queue, w)
+				}
+				if dist[w] == dist[v]+1 {
+					sigma[w] += sigma[v]
+					preds[w] = append(preds[w], v)
+				}
+			}
+		}
+
+		delta := make([]float64, n)
+		for k := len(stack) - 1; k >= 0; k-- {
+			w := stack[k]
+			for _, v := range preds[w] {
+				delta[v] += sigma[v] / sigma[w] * (1 + delta[w])
+			}
+			if w != s {
+				score[w] += delta[w]
+			}
+		}
+	}
+
+	// Each path was counted from both ends.
+	if n > 2 {
+		norm := float64((n - 1) * (n - 2))
+		for i := range score {
+			score[i] /= norm
+		}
+	}
+	return score
+}
+
+// Communities groups notes into densely related clusters with the Louvain
+// method: notes move to the neighboring community that most improves
+// modularity until none would, then each community is merged into a
+// single node and the process repeats on the smaller graph. Notes are
+// visited in a fixed order, so the result is deterministic. It returns the
+// communities, largest first.
+func (g *noteGraph) Communities() [][]int {
+	// Each level works on a weighted graph whose nodes are the communities
+	// of the level below. self holds twice the weight of the edges inside a
+	// node, so that a node's degree is self plus its edges to others.
+	n := len(g.notes)
+	adj := make([]map[int]float64, n)
+	self := make([]float64, n)
+	for i, neighbors := range g.adj {
+		adj[i] = make(map[int]float64, len(neighbors))
+		for _, j := range neighbors {
+			adj[i][j] = 1
+		}
+	}
+	membership := make([]int, n)
+	for i := range membership {
+		membership[i] = i
+	}
+
+	for {
+		community, moved := louvainLevel(adj, self)
+		if !moved {
+			break
+		}
+		// Renumber the communities densely and merge each into one node.
+		ids := make(map[int]int)
+		for _, c := range community {
+			if _, ok := ids[c]; !ok {
+				ids[c] = len(ids)
+			}
+		}
+		merged := make([]map[int]float64, len(ids))
+		mergedSelf := make([]float64, len(ids))
+		for i := range merged {
+			merged[i] = make(map[int]float64)
+		}
+		for i := range adj {
+			ci := ids[community[i]]
+			mergedSelf[ci] += self[i]
+			for j, w := range adj[i] {
+				if cj := ids[community[j]]; cj == ci {
+					mergedSelf[ci] += w
+				} else {
+					merged[ci][cj] += w
+				}
+			}
+		}
+		for i := range membership {
+			membership[i] = ids[community[membership[i]]]
+		}
+		adj, self = merged, mergedSelf
+	}
+	return groupBy(membership)
+}
+
+// louvainLevel moves nodes between communities while doing so increases
+// modularity. It returns each node's community and whether any node moved.
+func louvainLevel(adj []map[int]float64, self []float64) ([]int, bool) {
+	n := len(adj)
+	community := make([]int, n)
+	degree := make([]float64, n)
+	total := make([]float64, n)
+	var m2 float64
+	for i := range adj {
+		community[i] = i
+		degree[i] = self[i]
+		for _, w := range adj[i] {
+			degree[i] += w
+		}
+		total[i] = degree[i]
+		m2 += degree[i]
+	}
+	if m2 == 0 {
+		return community, false
+	}
+
+	moved := false
+	for improved := true; improved; {
+		improved = false
+		for i := 0; i < n; i++ {
+			links := make(map[int]float64)
+			for j, w := range adj[i] {
+				links[community[j]] += w
+			}
+			current := community[i]
+			total[current] -= degree[i]
+
+			best := current
+			bestGain := links[current] - total[current]*degree[i]/m2
+			for c, w := range links {
+				gain := w - total[c]*degree[i]/m2
+				if gain > bestGain+1e-12 || gain > bestGain-1e-12 && c < best && best != current {
+					best, bestGain = c, gain
+				}
+			}
+
+			total[best] += degree[i]
+			if best != current {
+				community[i] = best
+				improved, moved = true, true
+			}
+		}
+	}
+	return community, moved
+}
+
+// Components returns the connected components of the graph, largest
+// first.
+func (g *noteGraph) Components() [][]int {
+	component := make([]int, len(g.notes))
+	for i := range component {
+		component[i] = -1
+	}
+	for i := range g.notes {
+		if component[i] >= 0 {
+			continue
+		}
+		dist, _ := g.distances(i, 0)
+		for j, d := range dist {
+			if d >= 0 {
+				component[j] = i
+			}
+		}
+	}
+	return groupBy(component)
+}
+
+// Bridges returns the edges whose removal would split a component in two,
+// found with Tarjan's low-link algorithm.
+func (g *noteGraph) Bridges() [][2]int {
+	n := len(g.notes)
+	disc := make([]int, n)
+	low := make([]int, n)
+	for i := range disc {
+		disc[i] = -1
+	}
+	var bridges [][2]int
+	timer := 0
+
+	var visit func(u, parent int)
+	visit = func(u, parent int) {
+		disc[u], low[u] = timer, timer
+		timer++
+		for _, v := range g.adj[u] {
+			switch {
+			case disc[v] < 0:
+				visit(v, u)
+				low[u] = min(low[u], low[v])
+				if low[v] > disc[u] {
+					bridges = append(bridges, [2]int{u, v})
+				}
+			case v != parent:
+				low[u] = min(low[u], disc[v])
+			}
+		}
+	}
+	for i := 0; i < n; i++ {
+		if disc[i] < 0 {
+			visit(i, -1)
+		}
+	}
+	return bridges
+}
+
+// groupBy collects the indexes with the same label, largest group first
+// and groups of equal size in order of their first member.
+func groupBy(label []int) [][]int {
+	groups := make(map[int][]int)
+	var order []int
+	for i, l := range label {
+		if _, ok := groups[l]; !ok {
+			order = append(order, l)
+		}
+		groups[l] = append(groups[l], i)
+	}
+	result := make([][]int, 0, len(order))
+	for _, l := range order {
+		result = append(result, groups[l])
+	}
+	sort.SliceStable(result, func(i, j int) bool { return len(result[i]) > len(result[j]) })
+	return result
+}
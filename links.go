@@ -0,0 +1,66 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// wikilinkPattern matches [[Target]], [[Target|Label]], [[Target#Heading]]
+// and their ![[embed]] forms.
+var wikilinkPattern = regexp.MustCompile(`(!?)\[\[([^\]|#]*)(#[^\]|]*)?(?:\|([^\]]*))?\]\]`)
+
+// wikilink is a single [[...]] reference found in a note body.
+type wikilink struct {
+	Target  string
+	Heading string
+	Label   string
+	Embed   bool
+}
+
+// extractWikilinks returns every wikilink in content, in order of
+// appearance.
+func extractWikilinks(content string) []wikilink {
+	var links []wikilink
+	for _, m := range wikilinkPattern.FindAllStringSubmatch(content, -1) {
+		links = append(links, wikilinkFromMatch(m))
+	}
+	return links
+}
+
+// replaceWikilinks rewrites every wikilink in content with the result of fn.
+func replaceWikilinks(content string, fn func(link wikilink) string) string {
+	return wikilinkPattern.ReplaceAllStringFunc(content, func(s string) string {
+		return fn(wikilinkFromMatch(wikilinkPattern.FindStringSubmatch(s)))
+	})
+}
+
+func wikilinkFromMatch(m []string) wikilink {
+	return wikilink{
+		Embed:   m[1] == "!",
+		Target:  strings.TrimSpace(m[2]),
+		Heading: strings.TrimPrefix(m[3], "#"),
+		Label:   strings.TrimSpace(m[4]),
+	}
+}
+
+// noteKey normalizes a title, filename or link target so that the different
+// ways of referring to a note compare equal.
+func noteKey(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimSuffix(s, ".md")
+	return strings.TrimSuffix(generateFilename(s), ".md")
+}
+
+// buildNoteIndex maps the title and filename of each note to its position
+// in notes, for resolving links and connected_to entries.
+func buildNoteIndex(notes []Note) map[string]int {
+	index := make(map[string]int, len(notes)*2)
+	for i, note := range notes {
+		index[noteKey(note.Filename)] = i
+	}
+	// Titles take precedence over filenames when the two collide.
+	for i, note := range notes {
+		index[noteKey(note.Title)] = i
+	}
+	return index
+}
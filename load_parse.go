@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -12,6 +13,21 @@ import (
 func loadNotes(notesDir string) ([]Note, error) {
 	var notes []Note
 
+	err := walkNotes(notesDir, func(path string, note Note) error {
+		notes = append(notes, note)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return notes, nil
+}
+
+// walkNotes parses every markdown note under notesDir and calls fn for each
+// one as it is read, so callers that stream output never hold the whole
+// vault in memory.
+func walkNotes(notesDir string, fn func(path string, note Note) error) error {
 	err := filepath.Walk(notesDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -22,17 +38,17 @@ func loadNotes(notesDir string) ([]Note, error) {
 			if err != nil {
 				return fmt.Errorf("failed to parse note %s: %w", path, err)
 			}
-			notes = append(notes, note)
+			return fn(path, note)
 		}
 
 		return nil
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to walk notes directory: %w", err)
+		return fmt.Errorf("failed to walk notes directory: %w", err)
 	}
 
-	return notes, nil
+	return nil
 }
 
 func parseNote(path string) (Note, error) {
@@ -51,8 +67,13 @@ func parseNote(path string) (Note, error) {
 		return Note{}, fmt.Errorf("failed to parse frontmatter: %w", err)
 	}
 
+	title, ok := frontmatter["title"].(string)
+	if !ok {
+		return Note{}, fmt.Errorf("missing title")
+	}
+
 	note := Note{
-		Title:       frontmatter["title"].(string),
+		Title:       title,
 		Filename:    filepath.Base(path),
 		Frontmatter: frontmatter,
 		Content:     strings.TrimSpace(parts[2]),
@@ -60,10 +81,107 @@ func parseNote(path string) (Note, error) {
 	}
 
 	if connections, ok := frontmatter["connected_to"].([]interface{}); ok {
-		for _, conn := range connections {
-			note.Connections = append(note.Connections, conn.(string))
-		}
+		note.Connections = append(note.Connections, stringList(connections)...)
 	}
+	note.Relations = relationVocabularyFromConfig().parseRelations(frontmatter)
+	note.Tags = stringList(frontmatter["tags"])
+	note.Date, _ = frontmatterDate(frontmatter["date"])
 
 	return note, nil
 }
+
+// frontmatterDate converts a date frontmatter value to a time. yaml.v3
+// decodes bare dates into time.Time, and quoted ones are parsed in any of
+// the formats normalization recognizes.
+func frontmatterDate(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, strings.TrimSpace(v)); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// stringList converts a frontmatter value into a list of strings. YAML
+// decodes sequences as []interface{}, and hand-written notes often use a
+// single scalar where a list was intended, so both are accepted.
+func stringList(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if item == nil {
+				continue
+			}
+			list = append(list, fmt.Sprint(item))
+		}
+		return list
+	case nil:
+		return nil
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
+
+// writeNoteFile writes a note with the given frontmatter and markdown body
+// to path.
+func writeNoteFile(path string, frontmatter map[string]interface{}, body string) error {
+	yamlData, err := encodeFrontmatter(frontmatter)
+	if err != nil {
+		return fmt.Errorf("failed to marshal frontmatter: %w", err)
+	}
+
+	content := fmt.Sprintf("---\n%s---\n\n%s\n", string(yamlData), strings.TrimSpace(body))
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write note: %w", err)
+	}
+
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// rewriteFrontmatter replaces the frontmatter of the note at path. rest is
+// everything after the closing "---" as returned by parseFrontmatter, so the
+// body is written back byte for byte.
+func rewriteFrontmatter(path string, frontmatter map[string]interface{}, rest string) error {
+	yamlData, err := encodeFrontmatter(frontmatter)
+	if err != nil {
+		return fmt.Errorf("failed to marshal frontmatter: %w", err)
+	}
+
+	content := fmt.Sprintf("---\n%s---%s", string(yamlData), rest)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write note: %w", err)
+	}
+
+	return nil
+}
+
+// encodeFrontmatter marshals frontmatter to YAML. yaml.v3 decodes bare dates
+// such as 2024-01-02 into time.Time, which would otherwise be written back
+// as full RFC 3339 timestamps, so date-only values keep their short form.
+func encodeFrontmatter(frontmatter map[string]interface{}) ([]byte, error) {
+	out := make(map[string]interface{}, len(frontmatter))
+	for key, value := range frontmatter {
+		if t, ok := value.(time.Time); ok && t.Equal(t.Truncate(24*time.Hour)) && t.Location() == time.UTC {
+			value = t.Format("2006-01-02")
+		}
+		out[key] = value
+	}
+	return yaml.Marshal(out)
+}
@@ -29,17 +29,31 @@ func execute() error {
 
 	rootCmd.AddCommand(
 		newConnectCmd(),
+		newDisconnectCmd(),
+		newRelationsCmd(),
+		newSuggestLinksCmd(),
+		newAskCmd(),
+		newSummarizeCmd(),
+		newRetagCmd(),
+		newTagsCmd(),
 		newListCmd(),
 		newSearchCmd(),
 		newAddCmd(),
 		newEditCmd(),
 		newVisualizeCmd(),
+		newGraphCmd(),
+		newTUICmd(),
 		newStatsCmd(),
 		newExportCmd(),
 		newImportCmd(),
 		newBackupCmd(),
 		newConfigCmd(),
 		newFrontmatterCmd(),
+		newPublishCmd(),
+		newHistoryCmd(),
+		newDiffCmd(),
+		newRevertCmd(),
+		newDoctorCmd(),
 	)
 
 	return rootCmd.Execute()
@@ -62,6 +76,6 @@ func initConfig() {
 	viper.AutomaticEnv()
 
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 	}
 }
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// normalizeRule is one step of frontmatter normalization. Rules edit the
+// YAML mapping node of a note's frontmatter in place, so that key order,
+// comments and quoting survive normalization.
+type normalizeRule struct {
+	Name        string
+	Description string
+	Apply       func(fm *yaml.Node, cfg normalizeConfig)
+}
+
+// normalizeRules are the available rules, in the order they run by default.
+var normalizeRules = []normalizeRule{
+	{"trim", "Trim whitespace around values", trimValues},
+	{"scalar-tags", "Turn a comma separated tags string into a list", scalarTagsToList},
+	{"dates", "Rewrite date fields in date_format", coerceDates},
+	{"tag-case", "Change the case of tags (normalize.tag_case: lower, upper or none)", changeTagCase},
+	{"dedupe", "Remove duplicate entries from lists", dedupeLists},
+	{"sort-tags", "Sort tags alphabetically", sortTags},
+	{"default-tags", "Give untagged notes the default_tags", fillDefaultTags},
+	{"key-order", "Put keys in normalize.key_order first, in that order", orderKeys},
+}
+
+// normalizeConfig holds the settings rules read from the config file:
+//
+//	date_format: "2006-01-02"
+//	default_tags: [inbox]
+//	normalize:
+//	  rules: [trim, dates, tag-case]
+//	  tag_case: lower
+//	  date_fields: [date, lastmod]
+//	  key_order: [title, date, lastmod, tags]
+type normalizeConfig struct {
+	Rules       []normalizeRule
+	DateFormat  string
+	DateFields  []string
+	TagCase     string
+	KeyOrder    []string
+	DefaultTags []string
+}
+
+func normalizeConfigFromViper() (normalizeConfig, error) {
+	cfg := normalizeConfig{
+		DateFormat:  viper.GetString("date_format"),
+		DateFields:  viper.GetStringSlice("normalize.date_fields"),
+		TagCase:     viper.GetString("normalize.tag_case"),
+		KeyOrder:    viper.GetStringSlice("normalize.key_order"),
+		DefaultTags: viper.GetStringSlice("default_tags"),
+	}
+	if cfg.DateFormat == "" {
+		cfg.DateFormat = "2006-01-02"
+	}
+	if len(cfg.DateFields) == 0 {
+		cfg.DateFields = []string{"date", "lastmod"}
+	}
+	if cfg.TagCase == "" {
+		cfg.TagCase = "lower"
+	}
+	if len(cfg.KeyOrder) == 0 {
+		cfg.KeyOrder = []string{"title", "date", "lastmod", "tags"}
+	}
+
+	names := viper.GetStringSlice("normalize.rules")
+	if len(names) == 0 {
+		cfg.Rules = normalizeRules
+		return cfg, nil
+	}
+	rules, err := lookupNormalizeRules(names)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Rules = rules
+	return cfg, nil
+}
+
+func lookupNormalizeRules(names []string) ([]normalizeRule, error) {
+	var rules []normalizeRule
+	for _, name := range names {
+		found := false
+		for _, rule := range normalizeRules {
+			if rule.Name == strings.TrimSpace(name) {
+				rules = append(rules, rule)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown normalization rule: %s", name)
+		}
+	}
+	return rules, nil
+}
+
+// normalizeContent applies the configured rules to a note and returns its
+// new contents.
+func normalizeContent(content string, cfg normalizeConfig) (string, error) {
+	return editFrontmatterNode(content, func(fm *yaml.Node) {
+		for _, rule := range cfg.Rules {
+			rule.Apply(fm, cfg)
+		}
+	})
+}
+
+// editFrontmatterNode applies edit to the frontmatter of a note and returns
+// its new contents. A note whose frontmatter edit leaves the same is
+// returned as written, so that formatting YAML would normalize on encoding,
+// such as indentation or quoting, only changes along with the values.
+func editFrontmatterNode(content string, edit func(fm *yaml.Node)) (string, error) {
+	fm, rest, err := parseFrontmatterNode(content)
+	if err != nil {
+		return "", err
+	}
+	indent := frontmatterIndent(content)
+	before, err := encodeFrontmatterNode(fm, indent)
+	if err != nil {
+		return "", err
+	}
+	edit(fm)
+	after, err := encodeFrontmatterNode(fm, indent)
+	if err != nil {
+		return "", err
+	}
+	if after == before {
+		return content, nil
+	}
+	return fmt.Sprintf("---\n%s---%s", after, rest), nil
+}
+
+// parseFrontmatterNode is parseFrontmatter for callers that need the YAML
+// node, to keep key order and formatting when rewriting.
+func parseFrontmatterNode(content string) (*yaml.Node, string, error) {
+	parts := strings.SplitN(content, "---", 3)
+	if len(parts) != 3 {
+		return nil, "", fmt.Errorf("invalid frontmatter format")
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(parts[1]), &doc); err != nil {
+		return nil, "", fmt.Errorf("failed to parse frontmatter: %w", err)
+	}
+	if doc.Kind == 0 {
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, parts[2], nil
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, "", fmt.Errorf("frontmatter is not a mapping")
+	}
+	return doc.Content[0], parts[2], nil
+}
+
+func encodeFrontmatterNode(fm *yaml.Node, indent int) (string, error) {
+	var buf bytes.Buffer
+	if len(fm.Content) > 0 {
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(indent)
+		if err := enc.Encode(fm); err != nil {
+			return "", fmt.Errorf("failed to marshal frontmatter: %w", err)
+		}
+		if err := enc.Close(); err != nil {
+			return "", fmt.Errorf("failed to marshal frontmatter: %w", err)
+		}
+	}
+	return buf.String(), nil
+}
+
+// frontmatterIndent returns the indentation of the first indented line of
+// a note's frontmatter, or 4 if it has none.
+func frontmatterIndent(content string) int {
+	parts := strings.SplitN(content, "---", 3)
+	if len(parts) != 3 {
+		return 4
+	}
+	for _, line := range strings.Split(parts[1], "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if n := len(line) - len(trimmed); n > 0 && trimmed != "" {
+			return min(max(n, 2), 8)
+		}
+	}
+	return 4
+}
+
+// mappingValue returns the value of key in a mapping node, or nil.
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMappingValue replaces the value of key in a mapping node, appending
+// the key if it is missing.
+func setMappingValue(m *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content[i+1] = value
+			return
+		}
+	}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
+
+// deleteMappingValue removes key from a mapping node.
+func deleteMappingValue(m *yaml.Node, key string) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content = append(m.Content[:i], m.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+func stringSequenceNode(values []string) *yaml.Node {
+	seq := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	for _, v := range values {
+		seq.Content = append(seq.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v})
+	}
+	return seq
+}
+
+// walkScalars calls fn for every scalar value below n.
+func walkScalars(n *yaml.Node, fn func(*yaml.Node)) {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		fn(n)
+	case yaml.MappingNode:
+		for i := 1; i < len(n.Content); i += 2 {
+			walkScalars(n.Content[i], fn)
+		}
+	case yaml.SequenceNode:
+		for _, c := range n.Content {
+			walkScalars(c, fn)
+		}
+	}
+}
+
+func trimValues(fm *yaml.Node, cfg normalizeConfig) {
+	walkScalars(fm, func(n *yaml.Node) {
+		if n.Tag == "!!str" && n.Style&(yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+			n.Value = strings.TrimSpace(n.Value)
+		}
+	})
+}
+
+func scalarTagsToList(fm *yaml.Node, cfg normalizeConfig) {
+	tags := mappingValue(fm, "tags")
+	if tags == nil || tags.Kind != yaml.ScalarNode || tags.Tag == "!!null" {
+		return
+	}
+	var list []string
+	for _, tag := range strings.Split(tags.Value, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			list = append(list, tag)
+		}
+	}
+	setMappingValue(fm, "tags", stringSequenceNode(list))
+}
+
+// dateLayouts are the formats coerceDates recognizes.
+var dateLayouts = []string{
+	"2006-01-02",
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006/01/02",
+	"02.01.2006",
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+	"2 Jan 2006",
+}
+
+func coerceDates(fm *yaml.Node, cfg normalizeConfig) {
+	for _, field := range cfg.DateFields {
+		n := mappingValue(fm, field)
+		if n == nil || n.Kind != yaml.ScalarNode {
+			continue
+		}
+		layouts := append([]string{cfg.DateFormat}, dateLayouts...)
+		for _, layout := range layouts {
+			if t, err := time.Parse(layout, strings.TrimSpace(n.Value)); err == nil {
+				n.Value = t.Format(cfg.DateFormat)
+				n.Tag = "!!str"
+				n.Style = 0
+				break
+			}
+		}
+	}
+}
+
+func changeTagCase(fm *yaml.Node, cfg normalizeConfig) {
+	tags := mappingValue(fm, "tags")
+	if tags == nil || tags.Kind != yaml.SequenceNode {
+		return
+	}
+	for _, tag := range tags.Content {
+		switch cfg.TagCase {
+		case "lower":
+			tag.Value = strings.ToLower(tag.Value)
+		case "upper":
+			tag.Value = strings.ToUpper(tag.Value)
+		}
+	}
+}
+
+func dedupeLists(fm *yaml.Node, cfg normalizeConfig) {
+	for i := 1; i < len(fm.Content); i += 2 {
+		list := fm.Content[i]
+		if list.Kind != yaml.SequenceNode {
+			continue
+		}
+		seen := make(map[string]bool)
+		kept := list.Content[:0]
+		for _, item := range list.Content {
+			if item.Kind == yaml.ScalarNode {
+				if seen[item.Value] {
+					continue
+				}
+				seen[item.Value] = true
+			}
+			kept = append(kept, item)
+		}
+		list.Content = kept
+	}
+}
+
+func sortTags(fm *yaml.Node, cfg normalizeConfig) {
+	tags := mappingValue(fm, "tags")
+	if tags == nil || tags.Kind != yaml.SequenceNode {
+		return
+	}
+	sort.SliceStable(tags.Content, func(i, j int) bool { return tags.Content[i].Value < tags.Content[j].Value })
+}
+
+func fillDefaultTags(fm *yaml.Node, cfg normalizeConfig) {
+	if len(cfg.DefaultTags) == 0 {
+		return
+	}
+	tags := mappingValue(fm, "tags")
+	if tags != nil && (tags.Kind == yaml.SequenceNode && len(tags.Content) > 0 || tags.Kind == yaml.ScalarNode && tags.Tag != "!!null" && tags.Value != "") {
+		return
+	}
+	setMappingValue(fm, "tags", stringSequenceNode(cfg.DefaultTags))
+}
+
+func orderKeys(fm *yaml.Node, cfg normalizeConfig) {
+	type pair struct{ key, value *yaml.Node }
+	var pairs []pair
+	for i := 0; i+1 < len(fm.Content); i += 2 {
+		pairs = append(pairs, pair{fm.Content[i], fm.Content[i+1]})
+	}
+	rank := func(key string) int {
+		for i, k := range cfg.KeyOrder {
+			if k == key {
+				return i
+			}
+		}
+		return len(cfg.KeyOrder)
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return rank(pairs[i].key.Value) < rank(pairs[j].key.Value) })
+
+	fm.Content = fm.Content[:0]
+	for _, p := range pairs {
+		fm.Content = append(fm.Content, p.key, p.value)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImportObsidianAttachments(t *testing.T) {
+	vault := writeVault(t, map[string]string{
+		"One.md":      "![[a/image.png]] and [[c/doc.pdf]]\n",
+		"Two.md":      "![[b/image.png]] and ![[a/image.png]]\n",
+		"a/image.png": "first",
+		"b/image.png": "second",
+		"c/doc.pdf":   "new",
+	})
+	dir := importInto(t)
+	existing := filepath.Join(dir, "attachments", "c", "doc.pdf")
+	if err := os.MkdirAll(filepath.Dir(existing), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(existing, []byte("kept"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := importObsidianVault(vault, "attachments"); err != nil {
+		t.Fatal(err)
+	}
+
+	for file, want := range map[string]string{"a/image.png": "first", "b/image.png": "second", "c/doc.pdf": "kept"} {
+		if got := readFile(t, filepath.Join(dir, "attachments", filepath.FromSlash(file))); got != want {
+			t.Errorf("attachments/%s = %q, want %q", file, got, want)
+		}
+	}
+	for file, want := range map[string]string{
+		"one.md": "![[attachments/a/image.png]] and [[c/doc.pdf]]",
+		"two.md": "![[attachments/b/image.png]] and ![[attachments/a/image.png]]",
+	} {
+		if got := readFile(t, filepath.Join(dir, file)); !strings.Contains(got, want) {
+			t.Errorf("%s does not contain %q:\n%s", file, want, got)
+		}
+	}
+}
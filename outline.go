@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// outlinePage is a page from an outline-based tool such as Logseq or Roam,
+// before it is written out as a kg note.
+type outlinePage struct {
+	Title      string
+	Properties map[string]interface{}
+	Created    time.Time
+	Modified   time.Time
+	Blocks     []*outlineBlock
+	Source     string
+}
+
+// outlineBlock is a single bullet. UID is the identifier other blocks use
+// to reference it with ((uid)).
+type outlineBlock struct {
+	Text     string
+	UID      string
+	Children []*outlineBlock
+}
+
+var (
+	propertyPattern   = regexp.MustCompile(`^([A-Za-z][\w-]*)::\s*(.*)$`)
+	blockRefPattern   = regexp.MustCompile(`\(\(([\w-]+)\)\)`)
+	blockEmbedPattern = regexp.MustCompile(`\{\{embed:?\s*(\(\([\w-]+\)\)|\[\[[^\]]+\]\])\s*\}\}`)
+	tagRefPattern     = regexp.MustCompile(`#\[\[([^\]]+)\]\]`)
+	hashRefPattern    = regexp.MustCompile(`(?:^|\s)#([\p{L}\p{N}_/-]*[\p{L}_/-][\p{L}\p{N}_/-]*)`)
+)
+
+// parsePropertyValue converts an outline property into a frontmatter value.
+// Page references are unwrapped, and the list-valued properties used by
+// both tools (tags and aliases) become lists.
+func parsePropertyValue(key, value string) interface{} {
+	value = strings.TrimSpace(value)
+	isList := key == "tags" || key == "aliases" || strings.Contains(value, "[[")
+	if !isList {
+		return value
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		item = strings.TrimPrefix(item, "#")
+		item = strings.TrimSuffix(strings.TrimPrefix(item, "[["), "]]")
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// normalizePropertyKey maps tool-specific property names onto the
+// frontmatter keys kg uses.
+func normalizePropertyKey(key string) string {
+	key = strings.ToLower(key)
+	switch key {
+	case "alias":
+		return "aliases"
+	case "tag":
+		return "tags"
+	}
+	return key
+}
+
+// writeOutlinePages converts outline pages into kg notes in notesDir. Block
+// references are replaced with the referenced text, and page references to
+// imported or existing notes are recorded as connections.
+func writeOutlinePages(notesDir string, pages []*outlinePage) (*importReport, error) {
+	report := newImportReport()
+
+	blocks := make(map[string]*outlineBlock)
+	var indexBlocks func([]*outlineBlock)
+	indexBlocks = func(list []*outlineBlock) {
+		for _, b := range list {
+			if b.UID != "" {
+				blocks[b.UID] = b
+			}
+			indexBlocks(b.Children)
+		}
+	}
+
+	titles := make(map[string]string)
+	for _, page := range pages {
+		indexBlocks(page.Blocks)
+		titles[noteKey(page.Title)] = page.Title
+		for _, alias := range stringList(page.Properties["aliases"]) {
+			titles[noteKey(alias)] = page.Title
+		}
+	}
+	existing, err := loadNotes(notesDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, note := range existing {
+		if _, ok := titles[noteKey(note.Title)]; !ok {
+			titles[noteKey(note.Title)] = note.Title
+		}
+	}
+
+	for _, page := range pages {
+		destPath := filepath.Join(notesDir, generateFilename(page.Title))
+		if fileExists(destPath) {
+			report.conflict(page.Source, fmt.Sprintf("%s already exists", destPath))
+			continue
+		}
+
+		var connections []string
+		addRef := func(target string) {
+			title, ok := titles[noteKey(target)]
+			if !ok {
+				report.unresolved(page.Title, target)
+				return
+			}
+			if title != page.Title && !containsString(connections, title) {
+				connections = append(connections, title)
+			}
+		}
+
+		var body strings.Builder
+		var render func(list []*outlineBlock, depth int)
+		render = func(list []*outlineBlock, depth int) {
+			for _, b := range list {
+				text := resolveBlockRefs(b.Text, blocks, func(uid string) {
+					report.unresolved(page.Title, "(("+uid+"))")
+				})
+				text = tagRefPattern.ReplaceAllString(text, "[[$1]]")
+				for _, link := range extractWikilinks(text) {
+					addRef(link.Target)
+				}
+				for _, m := range hashRefPattern.FindAllStringSubmatch(text, -1) {
+					if _, ok := titles[noteKey(m[1])]; ok {
+						addRef(m[1])
+					}
+				}
+
+				indent := strings.Repeat("  ", depth)
+				lines := strings.Split(text, "\n")
+				fmt.Fprintf(&body, "%s- %s\n", indent, lines[0])
+				for _, line := range lines[1:] {
+					fmt.Fprintf(&body, "%s  %s\n", indent, line)
+				}
+				render(b.Children, depth+1)
+			}
+		}
+		render(page.Blocks, 0)
+
+		frontmatter := map[string]interface{}{}
+		for key, value := range page.Properties {
+			frontmatter[key] = value
+		}
+		frontmatter["title"] = page.Title
+		if _, ok := frontmatter["date"]; !ok {
+			frontmatter["date"] = page.Created.Format("2006-01-02")
+		}
+		if _, ok := frontmatter["lastmod"]; !ok {
+			frontmatter["lastmod"] = page.Modified.Format("2006-01-02")
+		}
+		if len(connections) > 0 {
+			frontmatter["connected_to"] = connections
+		}
+
+		if err := writeNoteFile(destPath, frontmatter, body.String()); err != nil {
+			return nil, fmt.Errorf("failed to import %s: %w", page.Title, err)
+		}
+		report.imported(page.Title, destPath)
+	}
+
+	return report, nil
+}
+
+// resolveBlockRefs replaces ((uid)) references and {{embed}} macros with the
+// text they point to. Unknown references are left in place and reported.
+func resolveBlockRefs(text string, blocks map[string]*outlineBlock, unresolved func(uid string)) string {
+	text = blockEmbedPattern.ReplaceAllString(text, "$1")
+	return blockRefPattern.ReplaceAllStringFunc(text, func(ref string) string {
+		uid := blockRefPattern.FindStringSubmatch(ref)[1]
+		b, ok := blocks[uid]
+		if !ok {
+			unresolved(uid)
+			return ref
+		}
+		// Only the first line; nested references are not expanded further.
+		return strings.SplitN(b.Text, "\n", 2)[0]
+	})
+}
+
+// ordinalDateTitle formats a date the way Logseq and Roam title their
+// daily pages, such as "Jan 15th, 2024" for monthLayout "Jan".
+func ordinalDateTitle(d time.Time, monthLayout string) string {
+	suffix := "th"
+	switch day := d.Day(); {
+	case day >= 11 && day <= 13:
+	case day%10 == 1:
+		suffix = "st"
+	case day%10 == 2:
+		suffix = "nd"
+	case day%10 == 3:
+		suffix = "rd"
+	}
+	return fmt.Sprintf("%s %d%s, %d", d.Format(monthLayout), d.Day(), suffix, d.Year())
+}
+
+var ordinalSuffixPattern = regexp.MustCompile(`(\d+)(st|nd|rd|th),`)
+
+// parseOrdinalDate parses a daily page title such as "January 15th, 2024".
+func parseOrdinalDate(title string) (time.Time, bool) {
+	s := ordinalSuffixPattern.ReplaceAllString(title, "$1,")
+	for _, layout := range []string{"January 2, 2006", "Jan 2, 2006"} {
+		if d, err := time.Parse(layout, s); err == nil {
+			return d, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// importInto points notes_directory at a fresh directory for the duration
+// of a test and returns it.
+func importInto(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	old := viper.GetString("notes_directory")
+	viper.Set("notes_directory", dir)
+	t.Cleanup(func() { viper.Set("notes_directory", old) })
+	return dir
+}
+
+// checkGolden compares every note in dir with the file of the same name in
+// goldenDir.
+func checkGolden(t *testing.T, dir, goldenDir string) {
+	t.Helper()
+	if *updateGolden {
+		os.RemoveAll(goldenDir)
+		if err := os.MkdirAll(goldenDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := filepath.Glob(filepath.Join(dir, "*.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := filepath.Glob(filepath.Join(goldenDir, "*.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := func(paths []string) []string {
+		var names []string
+		for _, p := range paths {
+			names = append(names, filepath.Base(p))
+		}
+		sort.Strings(names)
+		return names
+	}
+	if !*updateGolden && !reflect.DeepEqual(names(got), names(want)) {
+		t.Errorf("imported %q, want %q", names(got), names(want))
+	}
+
+	for _, path := range got {
+		golden := filepath.Join(goldenDir, filepath.Base(path))
+		content := readFile(t, path)
+		if *updateGolden {
+			if err := os.WriteFile(golden, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if _, err := os.Stat(golden); err != nil {
+			continue
+		}
+		if want := readFile(t, golden); content != want {
+			t.Errorf("%s differs from %s:\n%s", filepath.Base(path), golden, unifiedDiff(want, content, "golden", "imported"))
+		}
+	}
+}
+
+// inUTC makes dates from timestamps independent of the local time zone.
+func inUTC(t *testing.T) {
+	old := time.Local
+	time.Local = time.UTC
+	t.Cleanup(func() { time.Local = old })
+}
+
+func TestImportLogseqGraph(t *testing.T) {
+	inUTC(t)
+
+	// Page dates come from file times, so copy the graph and fix them.
+	graph := t.TempDir()
+	modTime := time.Date(2024, 2, 1, 12, 0, 0, 0, time.UTC)
+	for _, sub := range []string{"pages", "journals"} {
+		entries, err := os.ReadDir(filepath.Join("testdata", "logseq", sub))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Join(graph, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			dest := filepath.Join(graph, sub, entry.Name())
+			if err := os.WriteFile(dest, []byte(readFile(t, filepath.Join("testdata", "logseq", sub, entry.Name()))), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(dest, modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	dir := importInto(t)
+	if err := importLogseqGraph(graph); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, dir, filepath.Join("testdata", "logseq", "golden"))
+}
+
+func TestImportRoamExport(t *testing.T) {
+	inUTC(t)
+	dir := importInto(t)
+	if err := importRoamExport(filepath.Join("testdata", "roam", "export.json")); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, dir, filepath.Join("testdata", "roam", "golden"))
+}
+
+func TestImportLogseqGraphEmpty(t *testing.T) {
+	importInto(t)
+	if err := importLogseqGraph(t.TempDir()); err == nil {
+		t.Error("importing a directory with no pages succeeded")
+	}
+}
+
+func TestConvertRoamPageProperties(t *testing.T) {
+	tests := []struct {
+		name       string
+		blocks     []roamBlock
+		wantProps  map[string]interface{}
+		wantBlocks []string
+	}{
+		{
+			name:       "leading attributes",
+			blocks:     []roamBlock{{String: "tags:: a, b"}, {String: "Type:: book"}, {String: "text"}},
+			wantProps:  map[string]interface{}{"tags": []string{"a", "b"}, "type": "book"},
+			wantBlocks: []string{"text"},
+		},
+		{
+			name:       "attribute after content",
+			blocks:     []roamBlock{{String: "text"}, {String: "status:: done"}},
+			wantProps:  map[string]interface{}{},
+			wantBlocks: []string{"text", "status:: done"},
+		},
+		{
+			name:       "attribute with children",
+			blocks:     []roamBlock{{String: "status:: done", Children: []roamBlock{{String: "why"}}}, {String: "tags:: a"}},
+			wantProps:  map[string]interface{}{},
+			wantBlocks: []string{"status:: done", "tags:: a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := convertRoamPage(roamPage{Title: "Page", CreateTime: 1, Children: tt.blocks}, "export.json")
+			if !reflect.DeepEqual(page.Properties, tt.wantProps) {
+				t.Errorf("properties = %v, want %v", page.Properties, tt.wantProps)
+			}
+			var blocks []string
+			for _, b := range page.Blocks {
+				blocks = append(blocks, b.Text)
+			}
+			if !reflect.DeepEqual(blocks, tt.wantBlocks) {
+				t.Errorf("blocks = %q, want %q", blocks, tt.wantBlocks)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// noteQuery matches notes in memory using the query syntax accepted by
+// `kg search`: whitespace separated terms that must all be present, where a
+// leading "+" marks a term as required and a leading "-" excludes notes
+// containing it. A term written as key:value is matched against that
+// frontmatter field instead of the note text; "tag" is an alias for "tags".
+type noteQuery struct {
+	terms []queryTerm
+}
+
+type queryTerm struct {
+	field  string
+	value  string
+	negate bool
+}
+
+func parseNoteQuery(queryString string) noteQuery {
+	var q noteQuery
+	for _, term := range strings.Fields(queryString) {
+		var t queryTerm
+		switch {
+		case strings.HasPrefix(term, "+"):
+			term = strings.TrimPrefix(term, "+")
+		case strings.HasPrefix(term, "-"):
+			term = strings.TrimPrefix(term, "-")
+			t.negate = true
+		}
+		if field, value, ok := strings.Cut(term, ":"); ok && field != "" {
+			t.field = strings.ToLower(field)
+			if t.field == "tag" {
+				t.field = "tags"
+			}
+			term = value
+		}
+		t.value = strings.ToLower(term)
+		if t.value == "" {
+			continue
+		}
+		q.terms = append(q.terms, t)
+	}
+	return q
+}
+
+// Empty reports whether the query has no terms and so matches every note.
+func (q noteQuery) Empty() bool {
+	return len(q.terms) == 0
+}
+
+func (q noteQuery) Match(note Note) bool {
+	for _, t := range q.terms {
+		if t.match(note) == t.negate {
+			return false
+		}
+	}
+	return true
+}
+
+func (t queryTerm) match(note Note) bool {
+	if t.field == "" {
+		if strings.Contains(strings.ToLower(note.Title), t.value) ||
+			strings.Contains(strings.ToLower(note.Content), t.value) {
+			return true
+		}
+		for _, tag := range stringList(note.Frontmatter["tags"]) {
+			if strings.ToLower(tag) == t.value {
+				return true
+			}
+		}
+		return false
+	}
+
+	value, ok := note.Frontmatter[t.field]
+	if !ok {
+		return false
+	}
+	switch value.(type) {
+	case []interface{}, []string:
+		for _, item := range stringList(value) {
+			if strings.ToLower(item) == t.value {
+				return true
+			}
+		}
+		return false
+	default:
+		return strings.ToLower(fmt.Sprint(value)) == t.value
+	}
+}
+
+// noteSelector picks the notes a bulk command applies to: those matching a
+// search query, any of a set of path globs, and every field predicate.
+type noteSelector struct {
+	query  noteQuery
+	globs  []string
+	fields []fieldPredicate
+}
+
+func parseNoteSelector(where string, globs, fields []string) (noteSelector, error) {
+	s := noteSelector{query: parseNoteQuery(where), globs: globs}
+	for _, glob := range globs {
+		if _, err := filepath.Match(glob, ""); err != nil {
+			return s, fmt.Errorf("invalid path glob %q: %w", glob, err)
+		}
+	}
+	for _, field := range fields {
+		p, err := parseFieldPredicate(field)
+		if err != nil {
+			return s, err
+		}
+		s.fields = append(s.fields, p)
+	}
+	return s, nil
+}
+
+// Match reports whether the note at rel, a path relative to the notes
+// directory, is selected. Globs without a slash also match the file name
+// alone.
+func (s noteSelector) Match(rel string, note Note) bool {
+	if !s.query.Match(note) {
+		return false
+	}
+	if len(s.globs) > 0 {
+		matched := false
+		for _, glob := range s.globs {
+			if ok, _ := filepath.Match(glob, rel); ok {
+				matched = true
+			} else if ok, _ := filepath.Match(glob, filepath.Base(rel)); ok && !strings.Contains(glob, "/") {
+				matched = true
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for _, p := range s.fields {
+		if !p.Match(note.Frontmatter) {
+			return false
+		}
+	}
+	return true
+}
+
+// fieldPredicate is a condition on a frontmatter field, such as
+// priority>=2, status!=done, reviewed (present) or !reviewed (missing).
+type fieldPredicate struct {
+	key   string
+	op    string
+	value string
+}
+
+// fieldOperators are tried longest first so that >= is not read as >.
+var fieldOperators = []string{"!=", ">=", "<=", "=", ">", "<", "~"}
+
+func parseFieldPredicate(s string) (fieldPredicate, error) {
+	for _, op := range fieldOperators {
+		if key, value, ok := strings.Cut(s, op); ok {
+			key = strings.TrimSpace(key)
+			if key == "" {
+				return fieldPredicate{}, fmt.Errorf("invalid field predicate: %s", s)
+			}
+			return fieldPredicate{key: key, op: op, value: strings.TrimSpace(value)}, nil
+		}
+	}
+	if key, ok := strings.CutPrefix(s, "!"); ok {
+		return fieldPredicate{key: strings.TrimSpace(key), op: "missing"}, nil
+	}
+	if strings.TrimSpace(s) == "" {
+		return fieldPredicate{}, fmt.Errorf("invalid field predicate: %s", s)
+	}
+	return fieldPredicate{key: strings.TrimSpace(s), op: "present"}, nil
+}
+
+// Match reports whether frontmatter satisfies the predicate. Values that
+// both parse as numbers, or as dates, are compared as such; others are
+// compared as case-insensitive strings. A list field equals a value if it
+// contains it.
+func (p fieldPredicate) Match(frontmatter map[string]interface{}) bool {
+	value, ok := frontmatter[p.key]
+	switch p.op {
+	case "present":
+		return ok
+	case "missing":
+		return !ok
+	}
+	if !ok {
+		return p.op == "!="
+	}
+
+	items := stringList(value)
+	if t, ok := value.(time.Time); ok {
+		items = []string{t.Format("2006-01-02")}
+	}
+	if p.op == "!=" {
+		for _, item := range items {
+			if compareFieldValues(item, p.value) == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	for _, item := range items {
+		c := compareFieldValues(item, p.value)
+		switch {
+		case p.op == "=" && c == 0,
+			p.op == ">" && c > 0,
+			p.op == ">=" && c >= 0,
+			p.op == "<" && c < 0,
+			p.op == "<=" && c <= 0,
+			p.op == "~" && strings.Contains(strings.ToLower(item), strings.ToLower(p.value)):
+			return true
+		}
+	}
+	return false
+}
+
+func compareFieldValues(a, b string) int {
+	if x, err := strconv.ParseFloat(a, 64); err == nil {
+		if y, err := strconv.ParseFloat(b, 64); err == nil {
+			return cmp.Compare(x, y)
+		}
+	}
+	for _, layout := range dateLayouts {
+		x, errA := time.Parse(layout, a)
+		y, errB := time.Parse(layout, b)
+		if errA == nil && errB == nil {
+			return x.Compare(y)
+		}
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Relation is a typed link from a note to another note, named by title.
+type Relation struct {
+	Type   string `json:"type"`
+	Target string `json:"target"`
+}
+
+// defaultRelation is the untyped, symmetric relation kg has always written
+// to connected_to.
+const defaultRelation = "connected_to"
+
+// defaultRelationTypes maps each built-in relation type to its inverse.
+// Symmetric relations are their own inverse. More can be added, or these
+// overridden, with relation_types in the config file; an empty inverse
+// makes a relation one-way.
+var defaultRelationTypes = map[string]string{
+	"connected_to": "connected_to",
+	"depends_on":   "required_by",
+	"part_of":      "has_part",
+	"extends":      "extended_by",
+	"supports":     "supported_by",
+	"cites":        "cited_by",
+	"contradicts":  "contradicts",
+}
+
+// relationVocabulary is the set of relation types notes may use. Relations
+// are stored in frontmatter as lists under their type, such as
+// depends_on: [Other Note], or as a relations list of {type, target} maps.
+type relationVocabulary struct {
+	inverse map[string]string
+	forward map[string]bool
+}
+
+func relationVocabularyFromConfig() relationVocabulary {
+	types := make(map[string]string, len(defaultRelationTypes))
+	for t, inv := range defaultRelationTypes {
+		types[t] = inv
+	}
+	for t, inv := range viper.GetStringMapString("relation_types") {
+		types[t] = inv
+	}
+
+	v := relationVocabulary{inverse: make(map[string]string), forward: make(map[string]bool)}
+	for t, inv := range types {
+		v.forward[t] = true
+		v.inverse[t] = inv
+		if inv != "" {
+			v.inverse[inv] = t
+		}
+	}
+	return v
+}
+
+// Known reports whether t is a relation type or the inverse of one.
+func (v relationVocabulary) Known(t string) bool {
+	_, ok := v.inverse[t]
+	return ok
+}
+
+// Inverse returns the type of the relation that points back along t, or ""
+// for one-way relations.
+func (v relationVocabulary) Inverse(t string) string {
+	return v.inverse[t]
+}
+
+// Types returns every relation type and inverse, sorted.
+func (v relationVocabulary) Types() []string {
+	types := make([]string, 0, len(v.inverse))
+	for t := range v.inverse {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Canonical returns the direction an edge is drawn in, so that a relation
+// and the inverse recorded on the other note describe the same edge: the
+// configured type rather than its inverse, and for symmetric relations the
+// endpoints in sorted order.
+func (v relationVocabulary) Canonical(source, t, target string) (string, string, string) {
+	inv := v.inverse[t]
+	switch {
+	case inv == t:
+		if target < source {
+			source, target = target, source
+		}
+	case !v.forward[t] && inv != "":
+		source, target, t = target, source, inv
+	}
+	return source, t, target
+}
+
+// parseRelations collects the relations declared in a note's frontmatter.
+func (v relationVocabulary) parseRelations(frontmatter map[string]interface{}) []Relation {
+	relations := []Relation{}
+	add := func(t, target string) {
+		target = strings.TrimSpace(target)
+		if t == "" || target == "" {
+			return
+		}
+		r := Relation{Type: t, Target: target}
+		for _, existing := range relations {
+			if existing == r {
+				return
+			}
+		}
+		relations = append(relations, r)
+	}
+
+	for _, t := range v.Types() {
+		for _, target := range stringList(frontmatter[t]) {
+			add(t, target)
+		}
+	}
+	if list, ok := frontmatter["relations"].([]interface{}); ok {
+		for _, item := range list {
+			if m, ok := item.(map[string]interface{}); ok {
+				add(fmt.Sprint(m["type"]), fmt.Sprint(m["target"]))
+			}
+		}
+	}
+	return relations
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+)
+
+// resolveNote finds the note that name refers to among notes, whose files
+// are at paths. name may be a path to the note's file, or its title, file
+// name, one of its aliases or its id, in any case. Failing an exact match,
+// notes whose titles or aliases contain name are tried, then notes whose
+// titles contain its letters in order.
+//
+// Only an exact match to a single note is accepted as is. Otherwise the
+// user is asked to confirm or choose a note if stdin is a terminal, and
+// the error lists the candidates if not, since commands act on the note
+// they are given.
+func resolveNote(notesDir string, notes []Note, paths []string, name string) (int, error) {
+	if i, ok := resolveNotePath(notesDir, paths, name); ok {
+		return i, nil
+	}
+
+	// Titles and file names take precedence over aliases and ids, so that
+	// a note is never hidden by another's alias.
+	key := noteKey(name)
+	var byTitle, byAlias []int
+	for i, note := range notes {
+		switch {
+		case noteKey(note.Title) == key || noteKey(note.Filename) == key:
+			byTitle = append(byTitle, i)
+		case containsNoteKey(noteNames(note)[1:], key):
+			byAlias = append(byAlias, i)
+		}
+	}
+	if len(byTitle) > 0 {
+		return chooseNote(notes, name, byTitle, true)
+	}
+	if len(byAlias) > 0 {
+		return chooseNote(notes, name, byAlias, true)
+	}
+
+	lower := strings.ToLower(strings.TrimSpace(name))
+	var containing []int
+	for i, note := range notes {
+		for _, n := range noteNames(note) {
+			if strings.Contains(strings.ToLower(n), lower) {
+				containing = append(containing, i)
+				break
+			}
+		}
+	}
+	if len(containing) > 0 {
+		return chooseNote(notes, name, rankNotes(notes, name, containing), false)
+	}
+
+	titles := make([]string, len(notes))
+	for i, note := range notes {
+		titles[i] = note.Title
+	}
+	if matches := fuzzyRank(name, titles); len(matches) > 0 {
+		return chooseNote(notes, name, matches, false)
+	}
+
+	if suggestions := similarNotes(notes, name); len(suggestions) > 0 {
+		return 0, fmt.Errorf("note '%s' not found; did you mean %s?", name, quotedTitles(notes, suggestions))
+	}
+	return 0, fmt.Errorf("note '%s' not found", name)
+}
+
+// resolveNotePath matches name as a path to a note's file, relative to the
+// notes directory or the working directory.
+func resolveNotePath(notesDir string, paths []string, name string) (int, bool) {
+	if !strings.HasSuffix(name, ".md") && !strings.ContainsRune(name, filepath.Separator) && !strings.Contains(name, "/") {
+		return 0, false
+	}
+	candidates := []string{filepath.Join(notesDir, name)}
+	if abs, err := filepath.Abs(name); err == nil {
+		candidates = append(candidates, abs)
+	}
+	if filepath.IsAbs(name) {
+		candidates = append(candidates, filepath.Clean(name))
+	}
+	for i, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			abs = path
+		}
+		for _, c := range candidates {
+			if c == abs || c == filepath.Clean(path) {
+				return i, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// noteNames returns the names a note can be referred to by: its title,
+// then its aliases and id.
+func noteNames(note Note) []string {
+	names := []string{note.Title}
+	names = append(names, stringList(note.Frontmatter["aliases"])...)
+	if id, ok := note.Frontmatter["id"]; ok && id != nil {
+		names = append(names, fmt.Sprint(id))
+	}
+	return names
+}
+
+func containsNoteKey(names []string, key string) bool {
+	for _, n := range names {
+		if noteKey(n) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// rankNotes orders candidates by how well name matches their titles.
+func rankNotes(notes []Note, name string, candidates []int) []int {
+	score := make(map[int]int, len(candidates))
+	for _, i := range candidates {
+		for _, n := range noteNames(notes[i]) {
+			if s, ok := fuzzyScore(name, n); ok && s > score[i] {
+				score[i] = s
+			}
+		}
+	}
+	ranked := append([]int(nil), candidates...)
+	sort.SliceStable(ranked, func(a, b int) bool { return score[ranked[a]] > score[ranked[b]] })
+	return ranked
+}
+
+// chooseNote returns the candidate name refers to. A single exact match is
+// returned as is; anything else is confirmed or chosen by the user.
+func chooseNote(notes []Note, name string, candidates []int, exact bool) (int, error) {
+	if exact && len(candidates) == 1 {
+		return candidates[0], nil
+	}
+	const shown = 10
+	if len(candidates) > shown {
+		candidates = candidates[:shown]
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		if exact {
+			return 0, fmt.Errorf("'%s' matches several notes; did you mean %s?", name, quotedTitles(notes, candidates))
+		}
+		return 0, fmt.Errorf("note '%s' not found; did you mean %s?", name, quotedTitles(notes, candidates))
+	}
+
+	if len(candidates) == 1 {
+		i := candidates[0]
+		fmt.Fprintf(os.Stderr, "Did you mean '%s' (%s)? [y/N] ", notes[i].Title, notes[i].Filename)
+		input, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if answer := strings.ToLower(strings.TrimSpace(input)); answer != "y" && answer != "yes" {
+			return 0, fmt.Errorf("note '%s' not found", name)
+		}
+		return i, nil
+	}
+
+	fmt.Fprintf(os.Stderr, "'%s' matches several notes:\n", name)
+	for k, i := range candidates {
+		fmt.Fprintf(os.Stderr, "  %d) %s (%s)\n", k+1, notes[i].Title, notes[i].Filename)
+	}
+	fmt.Fprintf(os.Stderr, "Choose a note [1-%d]: ", len(candidates))
+	input, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	choice, err := strconv.Atoi(strings.TrimSpace(input))
+	if err != nil || choice < 1 || choice > len(candidates) {
+		return 0, fmt.Errorf("no note chosen for '%s'", name)
+	}
+	return candidates[choice-1], nil
+}
+
+// similarNotes returns up to three notes whose titles or aliases are a few
+// typos away from name, closest first.
+func similarNotes(notes []Note, name string) []int {
+	key := noteKey(name)
+	limit := max(2, len(key)/3)
+	distance := make(map[int]int)
+	for i, note := range notes {
+		for _, n := range noteNames(note) {
+			d := editDistance(key, noteKey(n))
+			if old, ok := distance[i]; d <= limit && (!ok || d < old) {
+				distance[i] = d
+			}
+		}
+	}
+	similar := make([]int, 0, len(distance))
+	for i := range distance {
+		similar = append(similar, i)
+	}
+	sort.Slice(similar, func(a, b int) bool {
+		if distance[similar[a]] != distance[similar[b]] {
+			return distance[similar[a]] < distance[similar[b]]
+		}
+		return similar[a] < similar[b]
+	})
+	return similar[:min(3, len(similar))]
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func quotedTitles(notes []Note, indexes []int) string {
+	quoted := make([]string, len(indexes))
+	for k, i := range indexes {
+		quoted[k] = fmt.Sprintf("'%s'", notes[i].Title)
+	}
+	if len(quoted) == 1 {
+		return quoted[0]
+	}
+	return strings.Join(quoted[:len(quoted)-1], ", ") + " or " + quoted[len(quoted)-1]
+}
+
+// completeNotes completes the first n arguments of a command with note
+// titles, for shell completion.
+func completeNotes(n int) func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) >= n {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		// Cobra does not run its initializers before completing, so the
+		// config file has not been read yet.
+		initConfig()
+		notes, err := loadNotes(viper.GetString("notes_directory"))
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+
+		lower := strings.ToLower(toComplete)
+		var titles []string
+		for _, note := range notes {
+			if strings.HasPrefix(strings.ToLower(note.Title), lower) {
+				titles = append(titles, note.Title)
+			}
+		}
+		sort.Strings(titles)
+		return titles, cobra.ShellCompDirectiveNoFileComp
+	}
+}
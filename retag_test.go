@@ -0,0 +1,54 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestApplyTagChanges(t *testing.T) {
+	const note = "---\ntitle: Note\ntags: [old]\n---\nbody\n"
+	hash := hashBytes([]byte(note))
+	tests := []struct {
+		name    string
+		change  tagChange
+		wantErr string
+	}{
+		{"applies", tagChange{Note: "Note", File: "sub/note.md", Hash: hash, To: []string{"new"}}, ""},
+		{"parent directory", tagChange{Note: "Outside", File: "../outside.md", Hash: hash, To: []string{"new"}}, "outside the notes directory"},
+		{"hidden parent", tagChange{Note: "Outside", File: "sub/../../outside.md", Hash: hash, To: []string{"new"}}, "outside the notes directory"},
+		{"absolute", tagChange{Note: "Outside", File: "/tmp/outside.md", Hash: hash, To: []string{"new"}}, "relative to the notes directory"},
+		{"no hash", tagChange{Note: "Note", File: "sub/note.md", To: []string{"new"}}, "has no hash"},
+		{"changed since", tagChange{Note: "Note", File: "sub/note.md", Hash: hashBytes([]byte("other")), To: []string{"new"}}, "has changed since"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := writeVault(t, map[string]string{"outside.md": note, "vault/sub/note.md": note})
+			dir := filepath.Join(root, "vault")
+			old := viper.GetBool("git.auto_commit")
+			viper.Set("git.auto_commit", false)
+			t.Cleanup(func() { viper.Set("git.auto_commit", old) })
+
+			err := applyTagChanges(dir, []tagChange{tt.change})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("applyTagChanges() error = %v, want %q", err, tt.wantErr)
+				}
+				for _, path := range []string{filepath.Join(root, "outside.md"), filepath.Join(dir, "sub", "note.md")} {
+					if got := readFile(t, path); got != note {
+						t.Errorf("%s was written:\n%s", path, got)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := readFile(t, filepath.Join(dir, "sub", "note.md")); !strings.Contains(got, "tags: [new]") {
+				t.Errorf("tags not replaced:\n%s", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// stopWords are left out of BM25 indexes; they match almost every note.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "but": true, "by": true, "can": true, "for": true, "from": true,
+	"has": true, "have": true, "in": true, "is": true, "it": true, "its": true,
+	"not": true, "of": true, "on": true, "or": true, "that": true, "the": true,
+	"this": true, "to": true, "was": true, "were": true, "which": true,
+	"will": true, "with": true, "you": true,
+}
+
+// tokenize splits text into lowercase words, dropping stop words and
+// single characters.
+func tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	tokens := words[:0]
+	for _, w := range words {
+		if len(w) > 1 && !stopWords[w] {
+			tokens = append(tokens, w)
+		}
+	}
+	return tokens
+}
+
+// noteText is the text a note is indexed by: its title, weighted by
+// repetition, its tags and its content.
+func noteText(note Note) string {
+	tags := strings.Join(stringList(note.Frontmatter["tags"]), " ")
+	return strings.Join([]string{note.Title, note.Title, tags, note.Content}, "\n")
+}
+
+// bm25Index ranks documents against a bag of query terms with Okapi BM25.
+type bm25Index struct {
+	docs    []map[string]int
+	lengths []int
+	avgLen  float64
+	df      map[string]int
+	// top holds each document's similarityTerms top terms, computed once
+	// so that comparing every pair does not sort them again.
+	top [][]string
+}
+
+// similarityTerms is how many of a document's top terms Similarity
+// queries the other document with.
+const similarityTerms = 25
+
+func newBM25Index(texts []string) *bm25Index {
+	ix := &bm25Index{df: make(map[string]int)}
+	total := 0
+	for _, text := range texts {
+		tokens := tokenize(text)
+		tf := make(map[string]int)
+		for _, t := range tokens {
+			tf[t]++
+		}
+		for t := range tf {
+			ix.df[t]++
+		}
+		ix.docs = append(ix.docs, tf)
+		ix.lengths = append(ix.lengths, len(tokens))
+		total += len(tokens)
+	}
+	if len(texts) > 0 {
+		ix.avgLen = float64(total) / float64(len(texts))
+	}
+	ix.top = make([][]string, len(ix.docs))
+	for doc := range ix.docs {
+		ix.top[doc] = ix.TopTerms(doc, similarityTerms)
+	}
+	return ix
+}
+
+func (ix *bm25Index) idf(term string) float64 {
+	n, df := float64(len(ix.docs)), float64(ix.df[term])
+	return math.Log(1 + (n-df+0.5)/(df+0.5))
+}
+
+// Score returns the BM25 score of document doc for the query terms.
+func (ix *bm25Index) Score(query []string, doc int) float64 {
+	const k1, b = 1.2, 0.75
+	if ix.avgLen == 0 {
+		return 0
+	}
+	norm := k1 * (1 - b + b*float64(ix.lengths[doc])/ix.avgLen)
+	score := 0.0
+	for _, term := range query {
+		tf := float64(ix.docs[doc][term])
+		if tf == 0 {
+			continue
+		}
+		score += ix.idf(term) * tf * (k1 + 1) / (tf + norm)
+	}
+	return score
+}
+
+// TopTerms returns the n terms that best characterize document doc, by
+// tf-idf.
+func (ix *bm25Index) TopTerms(doc, n int) []string {
+	terms := make([]string, 0, len(ix.docs[doc]))
+	weight := make(map[string]float64, len(ix.docs[doc]))
+	for t, tf := range ix.docs[doc] {
+		terms = append(terms, t)
+		weight[t] = float64(tf) * ix.idf(t)
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if weight[terms[i]] != weight[terms[j]] {
+			return weight[terms[i]] > weight[terms[j]]
+		}
+		return terms[i] < terms[j]
+	})
+	if len(terms) > n {
+		terms = terms[:n]
+	}
+	return terms
+}
+
+// Similarity scores how alike documents i and j are, from 0 to about 1:
+// each is queried with the other's top terms, relative to how well it
+// matches its own.
+func (ix *bm25Index) Similarity(i, j int) float64 {
+	rel := func(from, to int) float64 {
+		query := ix.top[from]
+		self := ix.Score(query, from)
+		if self == 0 {
+			return 0
+		}
+		return ix.Score(query, to) / self
+	}
+	return (rel(i, j) + rel(j, i)) / 2
+}
+
+// cosineSimilarity returns the cosine of the angle between two vectors.
+func cosineSimilarity(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		if i >= len(b) {
+			break
+		}
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
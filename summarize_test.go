@@ -0,0 +1,64 @@
+package main
+
+import "testing"
+
+func TestSetNoteSummary(t *testing.T) {
+	const note = `---
+title: Web Server
+date: 2024-01-02
+tags:
+  - go
+  - web
+lastmod: '2024-02-03'
+---
+Body
+`
+	tests := []struct {
+		name     string
+		content  string
+		summary  noteSummary
+		abstract bool
+		want     string
+	}{
+		{
+			name:    "adds the summary at the end",
+			content: note,
+			summary: noteSummary{Summary: "Serves HTTP: fast.", Abstract: []string{"ignored"}},
+			want: `---
+title: Web Server
+date: 2024-01-02
+tags:
+  - go
+  - web
+lastmod: '2024-02-03'
+summary: 'Serves HTTP: fast.'
+---
+Body
+`,
+		},
+		{
+			name:     "replaces the summary and writes the abstract",
+			content:  "---\ntitle: Web Server\nsummary: old\ndate: 2024-01-02\n---\nBody\n",
+			summary:  noteSummary{Summary: "New.", Abstract: []string{"One", "Two"}},
+			abstract: true,
+			want:     "---\ntitle: Web Server\nsummary: New.\ndate: 2024-01-02\nabstract:\n    - One\n    - Two\n---\nBody\n",
+		},
+		{
+			name:    "unchanged summary leaves the note as written",
+			content: "---\ntitle:   Web Server\nsummary: Same.\n---\nBody\n",
+			summary: noteSummary{Summary: "Same."},
+			want:    "---\ntitle:   Web Server\nsummary: Same.\n---\nBody\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := setNoteSummary(tt.content, tt.summary, tt.abstract)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("setNoteSummary() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
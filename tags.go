@@ -0,0 +1,301 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// tagSeparator divides hierarchical tags such as lang/go into levels.
+const tagSeparator = "/"
+
+// tagAliases maps alternative spellings of tags to the tag they stand for,
+// so that notes tagged ml and machine-learning are counted and renamed
+// together. The alias file lists each canonical tag with its aliases:
+//
+//	machine-learning: [ml, machinelearning]
+type tagAliases struct {
+	path      string
+	canonical map[string][]string
+	alias     map[string]string
+}
+
+func tagAliasesPath(notesDir string) string {
+	if path := viper.GetString("tag_aliases_file"); path != "" {
+		return path
+	}
+	return filepath.Join(notesDir, ".kg", "tag-aliases.yaml")
+}
+
+func loadTagAliases(notesDir string) (*tagAliases, error) {
+	a := &tagAliases{
+		path:      tagAliasesPath(notesDir),
+		canonical: make(map[string][]string),
+		alias:     make(map[string]string),
+	}
+	data, err := os.ReadFile(a.path)
+	if os.IsNotExist(err) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tag aliases: %w", err)
+	}
+
+	var entries map[string]interface{}
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", a.path, err)
+	}
+	for tag, aliases := range entries {
+		for _, alias := range stringList(aliases) {
+			a.Add(alias, tag)
+		}
+	}
+	return a, nil
+}
+
+// Canonical returns the tag an alias stands for, or tag itself.
+func (a *tagAliases) Canonical(tag string) string {
+	if canonical, ok := a.alias[strings.ToLower(tag)]; ok {
+		return canonical
+	}
+	return tag
+}
+
+// Add records alias as another name for tag.
+func (a *tagAliases) Add(alias, tag string) {
+	alias = strings.ToLower(strings.TrimSpace(alias))
+	if alias == "" || alias == strings.ToLower(tag) {
+		return
+	}
+	a.Remove(alias)
+	a.alias[alias] = tag
+	a.canonical[tag] = append(a.canonical[tag], alias)
+}
+
+// Remove forgets an alias. It reports whether the alias existed.
+func (a *tagAliases) Remove(alias string) bool {
+	alias = strings.ToLower(alias)
+	tag, ok := a.alias[alias]
+	if !ok {
+		return false
+	}
+	delete(a.alias, alias)
+	var kept []string
+	for _, existing := range a.canonical[tag] {
+		if existing != alias {
+			kept = append(kept, existing)
+		}
+	}
+	if len(kept) == 0 {
+		delete(a.canonical, tag)
+	} else {
+		a.canonical[tag] = kept
+	}
+	return true
+}
+
+// Retarget points the aliases of from at to, for when a tag is renamed or
+// merged.
+func (a *tagAliases) Retarget(from, to string) {
+	for _, alias := range a.canonical[from] {
+		a.alias[alias] = to
+		a.canonical[to] = append(a.canonical[to], alias)
+	}
+	delete(a.canonical, from)
+}
+
+// Tags returns the canonical tags that have aliases, sorted.
+func (a *tagAliases) Tags() []string {
+	tags := make([]string, 0, len(a.canonical))
+	for tag := range a.canonical {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// Aliases returns the aliases of a canonical tag, sorted.
+func (a *tagAliases) Aliases(tag string) []string {
+	aliases := append([]string(nil), a.canonical[tag]...)
+	sort.Strings(aliases)
+	return aliases
+}
+
+func (a *tagAliases) save() error {
+	entries := make(map[string][]string, len(a.canonical))
+	for tag := range a.canonical {
+		entries[tag] = a.Aliases(tag)
+	}
+	data, err := yaml.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("failed to save tag aliases: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(a.path), 0755); err != nil {
+		return fmt.Errorf("failed to save tag aliases: %w", err)
+	}
+	if err := writeFileAtomic(a.path, data); err != nil {
+		return fmt.Errorf("failed to save tag aliases: %w", err)
+	}
+	return nil
+}
+
+// tagAncestors returns the parents of a hierarchical tag, nearest last:
+// lang/go/generics has ancestors lang and lang/go.
+func tagAncestors(tag string) []string {
+	parts := strings.Split(tag, tagSeparator)
+	ancestors := make([]string, 0, len(parts)-1)
+	for i := 1; i < len(parts); i++ {
+		ancestors = append(ancestors, strings.Join(parts[:i], tagSeparator))
+	}
+	return ancestors
+}
+
+// tagWithin reports whether tag is root or one of its descendants.
+func tagWithin(tag, root string) bool {
+	return tag == root || strings.HasPrefix(tag, root+tagSeparator)
+}
+
+// tagLess orders tags level by level, so that children sort directly
+// after their parent.
+func tagLess(a, b string) bool {
+	pa, pb := strings.Split(a, tagSeparator), strings.Split(b, tagSeparator)
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		if pa[i] != pb[i] {
+			return pa[i] < pb[i]
+		}
+	}
+	return len(pa) < len(pb)
+}
+
+// tagCount is how often a tag is used: by notes tagged with it directly,
+// and in total including notes tagged with its descendants.
+type tagCount struct {
+	Tag    string `json:"tag"`
+	Direct int    `json:"direct"`
+	Total  int    `json:"total"`
+}
+
+// countTags counts the notes using each tag, after resolving aliases.
+// Parents of hierarchical tags are included even when no note uses them
+// directly, and a note counts once towards a parent however many of its
+// descendants it has.
+func countTags(notes []Note, aliases *tagAliases) []tagCount {
+	direct := make(map[string]int)
+	total := make(map[string]int)
+	for _, note := range notes {
+		seen := make(map[string]bool)
+		for _, tag := range stringList(note.Frontmatter["tags"]) {
+			tag = aliases.Canonical(tag)
+			if seen[tag] {
+				continue
+			}
+			seen[tag] = true
+			direct[tag]++
+		}
+		rolled := make(map[string]bool)
+		for tag := range seen {
+			for _, t := range append(tagAncestors(tag), tag) {
+				if !rolled[t] {
+					rolled[t] = true
+					total[t]++
+				}
+			}
+		}
+	}
+
+	counts := make([]tagCount, 0, len(total))
+	for tag, n := range total {
+		counts = append(counts, tagCount{Tag: tag, Direct: direct[tag], Total: n})
+	}
+	sort.Slice(counts, func(i, j int) bool { return tagLess(counts[i].Tag, counts[j].Tag) })
+	return counts
+}
+
+// tagRewrite is the change to one note's tags made by a tags command.
+type tagRewrite struct {
+	Path string
+	From []string
+	To   []string
+}
+
+// rewriteTags maps every tag of every note through fn, which returns the
+// replacement tag and whether to keep it, and writes back the notes whose
+// tags changed, all together or not at all. Tags are passed to fn after
+// resolving aliases; a note's tags stay as written unless fn changes them.
+// With dryRun set nothing is written.
+func rewriteTags(notesDir string, aliases *tagAliases, dryRun bool, fn func(tag string) (string, bool)) ([]tagRewrite, error) {
+	var rewrites []tagRewrite
+	files := make(map[string][]byte)
+	err := walkNotes(notesDir, func(path string, note Note) error {
+		from := stringList(note.Frontmatter["tags"])
+		var to []string
+		changed := false
+		for _, tag := range from {
+			canonical := aliases.Canonical(tag)
+			replacement, keep := fn(canonical)
+			if !keep {
+				changed = true
+				continue
+			}
+			if replacement == canonical {
+				replacement = tag
+			}
+			if containsString(to, replacement) {
+				changed = true
+				continue
+			}
+			if replacement != tag {
+				changed = true
+			}
+			to = append(to, replacement)
+		}
+		if !changed {
+			return nil
+		}
+		rewrites = append(rewrites, tagRewrite{Path: path, From: from, To: to})
+		if dryRun {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		updated, err := replaceNoteTags(string(content), to)
+		if err != nil {
+			return fmt.Errorf("failed to update %s: %w", path, err)
+		}
+		files[path] = []byte(updated)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeFilesAtomic(files); err != nil {
+		return nil, fmt.Errorf("failed to rewrite tags: %w", err)
+	}
+	return rewrites, nil
+}
+
+// replaceNoteTags replaces the tags in a note's frontmatter, removing the
+// key when there are none. The rest of the frontmatter is kept as written,
+// and so is the tag list's flow or block style.
+func replaceNoteTags(content string, tags []string) (string, error) {
+	return editFrontmatterNode(content, func(fm *yaml.Node) {
+		if len(tags) == 0 {
+			deleteMappingValue(fm, "tags")
+			return
+		}
+		tagNode := stringSequenceNode(tags)
+		if existing := mappingValue(fm, "tags"); existing != nil && existing.Kind == yaml.SequenceNode {
+			tagNode.Style = existing.Style
+		}
+		setMappingValue(fm, "tags", tagNode)
+	})
+}
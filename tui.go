@@ -0,0 +1,715 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/fatih/color"
+)
+
+// The terminal UI follows bubbletea's model/update/view loop: tuiModel
+// holds all of the interface's state, Update returns the next state for a
+// key press or the result of some work, and View renders a state as text.
+// Reading and writing notes happens in the tea.Cmds Update returns, never in
+// Update itself, so the interface can be driven without a terminal by
+// feeding messages to Update and inspecting View.
+
+type tuiMode int
+
+const (
+	tuiFind    tuiMode = iota // typing filters note titles
+	tuiSearch                 // typing searches note contents
+	tuiConnect                // typing names a note to relate to
+	tuiTag                    // typing edits the note's tags
+)
+
+type tuiFocus int
+
+const (
+	tuiFocusList tuiFocus = iota
+	tuiFocusLinks
+)
+
+// tuiLink is an entry in the links panel. note is -1 for links to notes
+// that do not exist.
+type tuiLink struct {
+	label string
+	note  int
+}
+
+// tuiSearcher runs a full-text search and returns the paths of the
+// matching notes, best first.
+type tuiSearcher func(query string) ([]string, error)
+
+// tuiEffects performs the changes the interface asks for. Each returns the
+// tea.Cmd that does the work, so that tests can substitute their own.
+type tuiEffects struct {
+	edit    func(path, title string) tea.Cmd
+	connect func(fromPath, rel, toPath string) tea.Cmd
+	tag     func(path, title string, tags []string) tea.Cmd
+}
+
+type tuiModel struct {
+	store   *edgeStore
+	search  tuiSearcher
+	effects tuiEffects
+
+	mode   tuiMode
+	focus  tuiFocus
+	query  string
+	input  string
+	rel    int
+	status string
+
+	matches    []int
+	cursor     int
+	offset     int
+	links      []tuiLink
+	linkCursor int
+	scroll     int
+	history    []int
+
+	wikiBacklinks map[int][]int
+	width, height int
+}
+
+// tuiSearchMsg carries the results of a search for query.
+type tuiSearchMsg struct {
+	query string
+	paths []string
+	err   error
+}
+
+// tuiReloadMsg carries the vault as read again after a change, with the
+// path of the note to show and a message about the change.
+type tuiReloadMsg struct {
+	store  *edgeStore
+	path   string
+	status string
+	err    error
+}
+
+func newTUIModel(store *edgeStore, search tuiSearcher, effects tuiEffects) tuiModel {
+	m := tuiModel{
+		store:   store,
+		search:  search,
+		effects: effects,
+		width:   80,
+		height:  24,
+	}
+	m.index()
+	m.filter()
+	return m
+}
+
+func (m tuiModel) Init() tea.Cmd {
+	return nil
+}
+
+// index records which notes link to each note with wikilinks, for the
+// backlinks panel.
+func (m *tuiModel) index() {
+	m.wikiBacklinks = make(map[int][]int)
+	for i, note := range m.store.notes {
+		seen := make(map[int]bool)
+		for _, link := range extractWikilinks(note.Content) {
+			if j, ok := m.store.index[noteKey(link.Target)]; ok && j != i && !seen[j] {
+				seen[j] = true
+				m.wikiBacklinks[j] = append(m.wikiBacklinks[j], i)
+			}
+		}
+	}
+}
+
+// filter updates the picker for the query in find mode: every note by
+// title when the query is empty, otherwise the fuzzy matches, best first.
+func (m *tuiModel) filter() {
+	titles := make([]string, len(m.store.notes))
+	for i, note := range m.store.notes {
+		titles[i] = note.Title
+	}
+	if m.query == "" {
+		m.matches = make([]int, len(titles))
+		for i := range m.matches {
+			m.matches[i] = i
+		}
+		sort.SliceStable(m.matches, func(a, b int) bool {
+			return strings.ToLower(titles[m.matches[a]]) < strings.ToLower(titles[m.matches[b]])
+		})
+	} else {
+		m.matches = fuzzyRank(m.query, titles)
+	}
+	m.cursor, m.offset = 0, 0
+	m.selectionChanged()
+}
+
+// current returns the note under the cursor, or -1.
+func (m tuiModel) current() int {
+	if m.cursor < 0 || m.cursor >= len(m.matches) {
+		return -1
+	}
+	return m.matches[m.cursor]
+}
+
+func (m *tuiModel) selectionChanged() {
+	m.scroll, m.linkCursor = 0, 0
+	m.links = m.noteLinks(m.current())
+}
+
+// noteLinks lists the relations and wikilinks of note i in both
+// directions.
+func (m tuiModel) noteLinks(i int) []tuiLink {
+	if i < 0 {
+		return nil
+	}
+	note := m.store.notes[i]
+	var links []tuiLink
+	resolve := func(title string) int {
+		if j, ok := m.store.index[noteKey(title)]; ok {
+			return j
+		}
+		return -1
+	}
+
+	edges, _ := m.store.List(m.store.paths[i])
+	for _, e := range edges {
+		arrow, other := "→", e.Target
+		if noteKey(e.Source) != noteKey(note.Title) {
+			arrow, other = "←", e.Source
+		}
+		if m.store.vocab.Inverse(e.Type) == e.Type {
+			arrow = "↔"
+		}
+		links = append(links, tuiLink{fmt.Sprintf("%s %s %s", arrow, e.Type, other), resolve(other)})
+	}
+	seen := make(map[string]bool)
+	for _, link := range extractWikilinks(note.Content) {
+		if link.Target == "" || seen[noteKey(link.Target)] {
+			continue
+		}
+		seen[noteKey(link.Target)] = true
+		links = append(links, tuiLink{fmt.Sprintf("→ [[%s]]", link.Target), resolve(link.Target)})
+	}
+	for _, j := range m.wikiBacklinks[i] {
+		links = append(links, tuiLink{fmt.Sprintf("← [[%s]]", m.store.notes[j].Title), j})
+	}
+	return links
+}
+
+// show moves the cursor to note i, clearing the query if i is not among
+// the matches.
+func (m *tuiModel) show(i int) {
+	for k, j := range m.matches {
+		if j == i {
+			m.cursor = k
+			m.selectionChanged()
+			return
+		}
+	}
+	m.mode, m.query = tuiFind, ""
+	m.filter()
+	for k, j := range m.matches {
+		if j == i {
+			m.cursor = k
+		}
+	}
+	m.selectionChanged()
+}
+
+func (m tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		return m, nil
+
+	case tuiSearchMsg:
+		if m.mode != tuiSearch || msg.query != m.query {
+			return m, nil
+		}
+		if msg.err != nil {
+			m.status = msg.err.Error()
+			return m, nil
+		}
+		byPath := make(map[string]int, len(m.store.paths))
+		for i, path := range m.store.paths {
+			byPath[path] = i
+		}
+		m.matches = nil
+		for _, path := range msg.paths {
+			if i, ok := byPath[path]; ok {
+				m.matches = append(m.matches, i)
+			}
+		}
+		m.cursor, m.offset = 0, 0
+		m.selectionChanged()
+		return m, nil
+
+	case tuiReloadMsg:
+		if msg.err != nil {
+			m.status = msg.err.Error()
+			return m, nil
+		}
+		m.status = msg.status
+		if msg.store == nil {
+			return m, nil
+		}
+		m.store = msg.store
+		m.index()
+		m.history = nil
+		if m.mode == tuiSearch {
+			m.mode, m.query = tuiFind, ""
+		}
+		m.filter()
+		for i, path := range m.store.paths {
+			if path == msg.path {
+				m.show(i)
+			}
+		}
+		return m, nil
+
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			return m, tea.Quit
+		}
+		switch m.mode {
+		case tuiConnect, tuiTag:
+			return m.updatePrompt(msg)
+		}
+		if m.focus == tuiFocusLinks {
+			return m.updateLinks(msg)
+		}
+		return m.updateList(msg)
+	}
+	return m, nil
+}
+
+func (m tuiModel) updateList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.status = ""
+	switch msg.String() {
+	case "esc":
+		if m.query == "" && m.mode == tuiFind {
+			return m, tea.Quit
+		}
+		m.mode, m.query = tuiFind, ""
+		m.filter()
+	case "up", "ctrl+p":
+		m.moveCursor(-1)
+	case "down", "ctrl+n":
+		m.moveCursor(1)
+	case "pgup":
+		m.scroll = max(0, m.scroll-m.bodyHeight()/2)
+	case "pgdown":
+		m.scroll += m.bodyHeight() / 2
+	case "tab", "enter":
+		if len(m.links) > 0 {
+			m.focus = tuiFocusLinks
+		}
+	case "ctrl+f":
+		if m.mode == tuiSearch {
+			m.mode = tuiFind
+			m.filter()
+			return m, nil
+		}
+		m.mode = tuiSearch
+		return m, m.runSearch()
+	case "ctrl+e":
+		if i := m.current(); i >= 0 {
+			return m, m.effects.edit(m.store.paths[i], m.store.notes[i].Title)
+		}
+	case "ctrl+l":
+		if m.current() >= 0 {
+			m.mode, m.input, m.rel = tuiConnect, "", 0
+		}
+	case "ctrl+t":
+		if i := m.current(); i >= 0 {
+			m.mode, m.input = tuiTag, strings.Join(m.store.notes[i].Tags, ", ")
+		}
+	case "backspace":
+		if m.query == "" {
+			return m, nil
+		}
+		m.query = trimLastRune(m.query)
+		return m, m.queryChanged()
+	default:
+		if msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace {
+			m.query += string(msg.Runes)
+			return m, m.queryChanged()
+		}
+	}
+	return m, nil
+}
+
+func (m tuiModel) updateLinks(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "tab", "esc":
+		m.focus = tuiFocusList
+	case "up", "k", "ctrl+p":
+		m.linkCursor = max(0, m.linkCursor-1)
+	case "down", "j", "ctrl+n":
+		m.linkCursor = min(len(m.links)-1, m.linkCursor+1)
+	case "enter":
+		if m.linkCursor >= len(m.links) {
+			return m, nil
+		}
+		target := m.links[m.linkCursor].note
+		if target < 0 {
+			m.status = "That note does not exist"
+			return m, nil
+		}
+		m.history = append(m.history, m.current())
+		m.show(target)
+		if len(m.links) == 0 {
+			m.focus = tuiFocusList
+		}
+	case "backspace", "b":
+		if len(m.history) == 0 {
+			return m, nil
+		}
+		prev := m.history[len(m.history)-1]
+		m.history = m.history[:len(m.history)-1]
+		m.show(prev)
+	}
+	return m, nil
+}
+
+func (m tuiModel) updatePrompt(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	i := m.current()
+	switch msg.String() {
+	case "esc":
+		m.mode = tuiFind
+		if m.query != "" {
+			m.filter()
+		}
+	case "tab":
+		if m.mode == tuiConnect {
+			m.rel = (m.rel + 1) % len(m.store.vocab.Types())
+		}
+	case "backspace":
+		m.input = trimLastRune(m.input)
+	case "enter":
+		if i < 0 {
+			m.mode = tuiFind
+			return m, nil
+		}
+		if m.mode == tuiConnect {
+			target := m.connectTarget()
+			if target < 0 {
+				m.status = fmt.Sprintf("No note matches '%s'", m.input)
+				return m, nil
+			}
+			m.mode = tuiFind
+			return m, m.effects.connect(m.store.paths[i], m.store.vocab.Types()[m.rel], m.store.paths[target])
+		}
+		var tags []string
+		for _, tag := range strings.Split(m.input, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" && !containsString(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+		m.mode = tuiFind
+		return m, m.effects.tag(m.store.paths[i], m.store.notes[i].Title, tags)
+	default:
+		if msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace {
+			m.input += string(msg.Runes)
+		}
+	}
+	return m, nil
+}
+
+// connectTarget returns the best match for the connect prompt's input
+// other than the current note, or -1.
+func (m tuiModel) connectTarget() int {
+	if strings.TrimSpace(m.input) == "" {
+		return -1
+	}
+	titles := make([]string, len(m.store.notes))
+	for i, note := range m.store.notes {
+		titles[i] = note.Title
+	}
+	for _, j := range fuzzyRank(m.input, titles) {
+		if j != m.current() {
+			return j
+		}
+	}
+	return -1
+}
+
+func (m *tuiModel) moveCursor(delta int) {
+	if len(m.matches) == 0 {
+		return
+	}
+	m.cursor = max(0, min(len(m.matches)-1, m.cursor+delta))
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+	if height := m.bodyHeight(); m.cursor >= m.offset+height {
+		m.offset = m.cursor - height + 1
+	}
+	m.selectionChanged()
+}
+
+func (m *tuiModel) queryChanged() tea.Cmd {
+	if m.mode == tuiSearch {
+		return m.runSearch()
+	}
+	m.filter()
+	return nil
+}
+
+func (m tuiModel) runSearch() tea.Cmd {
+	query, search := m.query, m.search
+	if strings.TrimSpace(query) == "" {
+		return func() tea.Msg { return tuiSearchMsg{query: query} }
+	}
+	return func() tea.Msg {
+		paths, err := search(query)
+		return tuiSearchMsg{query: query, paths: paths, err: err}
+	}
+}
+
+func trimLastRune(s string) string {
+	r := []rune(s)
+	if len(r) == 0 {
+		return s
+	}
+	return string(r[:len(r)-1])
+}
+
+var (
+	tuiBold      = color.New(color.Bold).SprintFunc()
+	tuiDim       = color.New(color.Faint).SprintFunc()
+	tuiHeading   = color.New(color.FgCyan, color.Bold).SprintFunc()
+	tuiLinkStyle = color.New(color.FgBlue, color.Underline).SprintFunc()
+	tuiSelected  = color.New(color.ReverseVideo).SprintFunc()
+	tuiMissing   = color.New(color.FgRed).SprintFunc()
+)
+
+func (m tuiModel) bodyHeight() int {
+	return max(1, m.height-3)
+}
+
+func (m tuiModel) View() string {
+	listWidth := min(40, max(20, m.width/3))
+	previewWidth := max(10, m.width-listWidth-3)
+	height := m.bodyHeight()
+
+	left := m.viewList(listWidth, height)
+
+	linksHeight := 0
+	if len(m.links) > 0 {
+		linksHeight = min(len(m.links)+1, height/3)
+	}
+	right := m.viewPreview(previewWidth, height-linksHeight)
+	right = append(right, m.viewLinks(previewWidth, linksHeight)...)
+
+	var b strings.Builder
+	b.WriteString(m.viewHeader())
+	b.WriteString("\n")
+	b.WriteString(tuiDim(strings.Repeat("─", max(0, m.width))))
+	b.WriteString("\n")
+	for row := 0; row < height; row++ {
+		b.WriteString(tuiPad(left[row], listWidth))
+		b.WriteString(tuiDim(" │ "))
+		if row < len(right) {
+			b.WriteString(tuiTruncate(right[row], previewWidth))
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(m.viewStatus())
+	return b.String()
+}
+
+func (m tuiModel) viewHeader() string {
+	switch m.mode {
+	case tuiSearch:
+		return fmt.Sprintf("%s %s█", tuiBold("Search:"), m.query)
+	case tuiConnect:
+		target := ""
+		if j := m.connectTarget(); j >= 0 {
+			target = tuiDim(" → " + m.store.notes[j].Title)
+		}
+		return fmt.Sprintf("%s %s█%s", tuiBold(fmt.Sprintf("Connect [%s] to:", m.store.vocab.Types()[m.rel])), m.input, target)
+	case tuiTag:
+		return fmt.Sprintf("%s %s█", tuiBold("Tags:"), m.input)
+	}
+	return fmt.Sprintf("%s %s█", tuiBold("Find:"), m.query)
+}
+
+func (m tuiModel) viewStatus() string {
+	if m.status != "" {
+		return m.status
+	}
+	switch {
+	case m.mode == tuiConnect:
+		return tuiDim("enter connect · tab relation type · esc cancel")
+	case m.mode == tuiTag:
+		return tuiDim("enter save tags (comma separated) · esc cancel")
+	case m.focus == tuiFocusLinks:
+		return tuiDim("↑↓ select · enter follow · b back · tab notes")
+	}
+	return tuiDim("↑↓ select · tab links · ^F search/find · ^E edit · ^L connect · ^T tag · esc quit")
+}
+
+// viewList renders the note picker, scrolled to keep the cursor visible.
+func (m tuiModel) viewList(width, height int) []string {
+	lines := make([]string, height)
+	if len(m.matches) == 0 {
+		lines[0] = tuiDim("No matching notes")
+		return lines
+	}
+	offset := max(0, min(m.offset, m.cursor), m.cursor-height+1)
+	for row := 0; row < height && offset+row < len(m.matches); row++ {
+		k := offset + row
+		title := tuiTruncate(m.store.notes[m.matches[k]].Title, width)
+		if k == m.cursor {
+			title = tuiSelected(tuiPad(title, width))
+			if m.focus == tuiFocusLinks {
+				title = tuiBold(tuiPad(m.store.notes[m.matches[k]].Title, width))
+			}
+		}
+		lines[row] = title
+	}
+	return lines
+}
+
+// viewPreview renders the frontmatter and body of the current note.
+func (m tuiModel) viewPreview(width, height int) []string {
+	i := m.current()
+	if i < 0 || height <= 0 {
+		return make([]string, max(0, height))
+	}
+	note := m.store.notes[i]
+
+	lines := []string{tuiHeading(note.Title)}
+	keys := make([]string, 0, len(note.Frontmatter))
+	for key := range note.Frontmatter {
+		if key != "title" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := formatFieldValue(note.Frontmatter[key])
+		if list := stringList(note.Frontmatter[key]); len(list) > 1 {
+			value = strings.Join(list, ", ")
+		}
+		lines = append(lines, tuiTruncate(fmt.Sprintf("%s %s", tuiDim(key+":"), value), width))
+	}
+	lines = append(lines, "")
+	lines = append(lines, renderMarkdown(note.Content, width)...)
+
+	scroll := min(m.scroll, max(0, len(lines)-height))
+	lines = lines[scroll:]
+	if len(lines) > height {
+		lines = lines[:height]
+	}
+	for len(lines) < height {
+		lines = append(lines, "")
+	}
+	return lines
+}
+
+func (m tuiModel) viewLinks(width, height int) []string {
+	if height <= 0 {
+		return nil
+	}
+	title := "Links"
+	if m.focus == tuiFocusLinks {
+		title = tuiBold("Links")
+	}
+	lines := []string{tuiDim(strings.Repeat("─", 2)) + " " + title + " " + tuiDim(strings.Repeat("─", max(0, width-len("Links")-4)))}
+
+	offset := 0
+	if m.linkCursor >= height-1 {
+		offset = m.linkCursor - height + 2
+	}
+	for k := offset; k < len(m.links) && len(lines) < height; k++ {
+		link := m.links[k]
+		label := tuiTruncate(link.label, width)
+		switch {
+		case m.focus == tuiFocusLinks && k == m.linkCursor:
+			label = tuiSelected(tuiPad(label, width))
+		case link.note < 0:
+			label = tuiMissing(label)
+		}
+		lines = append(lines, label)
+	}
+	return lines
+}
+
+// tuiTruncate shortens s to width columns, marking the cut with an
+// ellipsis.
+func tuiTruncate(s string, width int) string {
+	if ansi.StringWidth(s) <= width {
+		return s
+	}
+	return ansi.Truncate(s, width, "…")
+}
+
+func tuiPad(s string, width int) string {
+	return s + strings.Repeat(" ", max(0, width-ansi.StringWidth(s)))
+}
+
+var (
+	markdownEmphasis = regexp.MustCompile(`(\*\*|__)(.+?)(\*\*|__)`)
+	markdownCode     = regexp.MustCompile("`([^`]+)`")
+	markdownLink     = regexp.MustCompile(`\[([^\]]+)\]\(([^)]+)\)`)
+)
+
+// renderMarkdown renders a note body for the terminal, wrapped to width:
+// headings, emphasis, code, quotes and list bullets are styled, and links
+// are shown by their labels.
+func renderMarkdown(content string, width int) []string {
+	var lines []string
+	inCode := false
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			lines = append(lines, tuiDim("  "+tuiTruncate(line, max(0, width-2))))
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(trimmed, "#"):
+			text := strings.TrimSpace(strings.TrimLeft(trimmed, "#"))
+			lines = append(lines, tuiHeading(tuiTruncate(text, width)))
+			continue
+		case strings.HasPrefix(trimmed, "> "):
+			line = tuiDim("│ " + renderInline(strings.TrimPrefix(trimmed, "> ")))
+		case strings.HasPrefix(trimmed, "- "), strings.HasPrefix(trimmed, "* "):
+			indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+			line = indent + "• " + renderInline(trimmed[2:])
+		default:
+			line = renderInline(line)
+		}
+		lines = append(lines, strings.Split(ansi.Wrap(line, width, " -"), "\n")...)
+	}
+	return lines
+}
+
+func renderInline(s string) string {
+	s = replaceWikilinks(s, func(link wikilink) string {
+		label := link.Label
+		if label == "" {
+			label = link.Target
+		}
+		return tuiLinkStyle(label)
+	})
+	s = markdownLink.ReplaceAllStringFunc(s, func(m string) string {
+		return tuiLinkStyle(markdownLink.FindStringSubmatch(m)[1])
+	})
+	s = markdownEmphasis.ReplaceAllStringFunc(s, func(m string) string {
+		return tuiBold(markdownEmphasis.FindStringSubmatch(m)[2])
+	})
+	return markdownCode.ReplaceAllStringFunc(s, func(m string) string {
+		return tuiDim(markdownCode.FindStringSubmatch(m)[1])
+	})
+}
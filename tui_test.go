@@ -0,0 +1,307 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+var tuiVault = map[string]string{
+	"alpha.md": "---\ntitle: Alpha\ntags: [go, web]\nconnected_to: [Beta]\n---\nSee [[Gamma]].\n",
+	"beta.md":  "---\ntitle: Beta\nconnected_to: [Alpha]\n---\nBeta body\n",
+	"gamma.md": "---\ntitle: Gamma\n---\nGamma body\n",
+	"delta.md": "---\ntitle: Delta Notes\n---\nDelta body\n",
+}
+
+// tuiCalls records what the interface asked its effects to do.
+type tuiCalls struct {
+	edited    []string
+	connected [][3]string
+	tagged    map[string][]string
+	searched  []string
+}
+
+func newTestTUI(t *testing.T) (tuiModel, *tuiCalls, string) {
+	t.Helper()
+	dir := writeVault(t, tuiVault)
+	store, err := openEdgeStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := &tuiCalls{tagged: make(map[string][]string)}
+	search := func(query string) ([]string, error) {
+		calls.searched = append(calls.searched, query)
+		if query == "fail" {
+			return nil, errors.New("index unavailable")
+		}
+		return []string{filepath.Join(dir, "gamma.md"), filepath.Join(dir, "beta.md")}, nil
+	}
+	effects := tuiEffects{
+		edit: func(path, title string) tea.Cmd {
+			calls.edited = append(calls.edited, title)
+			return nil
+		},
+		connect: func(fromPath, rel, toPath string) tea.Cmd {
+			calls.connected = append(calls.connected, [3]string{filepath.Base(fromPath), rel, filepath.Base(toPath)})
+			return nil
+		},
+		tag: func(path, title string, tags []string) tea.Cmd {
+			calls.tagged[title] = tags
+			return nil
+		},
+	}
+	return newTUIModel(store, search, effects), calls, dir
+}
+
+// tuiKey returns the key message for a key name as bubbletea prints it, or
+// for typed text.
+func tuiKey(name string) tea.KeyMsg {
+	keys := map[string]tea.KeyType{
+		"esc":       tea.KeyEsc,
+		"tab":       tea.KeyTab,
+		"enter":     tea.KeyEnter,
+		"backspace": tea.KeyBackspace,
+		"up":        tea.KeyUp,
+		"down":      tea.KeyDown,
+		"ctrl+e":    tea.KeyCtrlE,
+		"ctrl+f":    tea.KeyCtrlF,
+		"ctrl+l":    tea.KeyCtrlL,
+		"ctrl+t":    tea.KeyCtrlT,
+	}
+	if k, ok := keys[name]; ok {
+		return tea.KeyMsg{Type: k}
+	}
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(name)}
+}
+
+// press feeds keys to the model in turn, returning the model and the
+// command the last one produced.
+func press(t *testing.T, m tuiModel, keys ...string) (tuiModel, tea.Cmd) {
+	t.Helper()
+	var cmd tea.Cmd
+	for _, key := range keys {
+		var next tea.Model
+		next, cmd = m.Update(tuiKey(key))
+		m = next.(tuiModel)
+	}
+	return m, cmd
+}
+
+func send(m tuiModel, msg tea.Msg) tuiModel {
+	next, _ := m.Update(msg)
+	return next.(tuiModel)
+}
+
+func currentTitle(m tuiModel) string {
+	if i := m.current(); i >= 0 {
+		return m.store.notes[i].Title
+	}
+	return ""
+}
+
+func matchTitles(m tuiModel) []string {
+	var titles []string
+	for _, i := range m.matches {
+		titles = append(titles, m.store.notes[i].Title)
+	}
+	return titles
+}
+
+func TestTUIPickerFiltering(t *testing.T) {
+	tests := []struct {
+		name  string
+		keys  []string
+		want  []string
+		first string
+	}{
+		{"all notes by title", nil, []string{"Alpha", "Beta", "Delta Notes", "Gamma"}, "Alpha"},
+		{"fuzzy match", []string{"g", "m"}, []string{"Gamma"}, "Gamma"},
+		{"word starts rank first", []string{"d", "n"}, []string{"Delta Notes"}, "Delta Notes"},
+		{"backspace widens", []string{"t", "z", "backspace"}, []string{"Beta", "Delta Notes"}, "Beta"},
+		{"esc clears the query", []string{"b", "e", "esc"}, []string{"Alpha", "Beta", "Delta Notes", "Gamma"}, "Alpha"},
+		{"no matches", []string{"z", "z"}, nil, ""},
+		{"cursor moves", []string{"down", "down"}, []string{"Alpha", "Beta", "Delta Notes", "Gamma"}, "Delta Notes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _, _ := newTestTUI(t)
+			m, _ = press(t, m, tt.keys...)
+			if got := matchTitles(m); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("matches = %q, want %q", got, tt.want)
+			}
+			if got := currentTitle(m); got != tt.first {
+				t.Errorf("selected %q, want %q", got, tt.first)
+			}
+		})
+	}
+}
+
+func TestTUIEscQuitsWithEmptyQuery(t *testing.T) {
+	m, _, _ := newTestTUI(t)
+	_, cmd := press(t, m, "esc")
+	if cmd == nil {
+		t.Fatal("esc with an empty query returned no command")
+	}
+	if _, ok := cmd().(tea.QuitMsg); !ok {
+		t.Errorf("esc with an empty query did not quit")
+	}
+}
+
+func TestTUIFollowLinkAndBack(t *testing.T) {
+	m, _, _ := newTestTUI(t)
+
+	var labels []string
+	for _, link := range m.links {
+		labels = append(labels, link.label)
+	}
+	want := []string{"↔ connected_to Beta", "→ [[Gamma]]"}
+	if !reflect.DeepEqual(labels, want) {
+		t.Fatalf("links of Alpha = %q, want %q", labels, want)
+	}
+
+	m, _ = press(t, m, "tab", "down", "enter")
+	if got := currentTitle(m); got != "Gamma" {
+		t.Fatalf("following [[Gamma]] selected %q", got)
+	}
+	if len(m.links) != 1 || m.links[0].label != "← [[Alpha]]" {
+		t.Errorf("links of Gamma = %v, want a backlink to Alpha", m.links)
+	}
+	if !strings.Contains(m.View(), "Gamma body") {
+		t.Errorf("preview does not show Gamma:\n%s", m.View())
+	}
+
+	m, _ = press(t, m, "b")
+	if got := currentTitle(m); got != "Alpha" {
+		t.Errorf("going back selected %q, want Alpha", got)
+	}
+	m, _ = press(t, m, "b")
+	if got := currentTitle(m); got != "Alpha" {
+		t.Errorf("going back with no history selected %q, want Alpha", got)
+	}
+}
+
+func TestTUIFollowLinkFromFilteredList(t *testing.T) {
+	m, _, _ := newTestTUI(t)
+	m, _ = press(t, m, "a", "l", "p", "tab", "enter")
+	if got := currentTitle(m); got != "Beta" {
+		t.Fatalf("following the relation selected %q, want Beta", got)
+	}
+	if m.query != "" {
+		t.Errorf("query = %q, want it cleared to show Beta", m.query)
+	}
+}
+
+func TestTUISearch(t *testing.T) {
+	m, calls, _ := newTestTUI(t)
+
+	m, cmd := press(t, m, "ctrl+f")
+	if m.mode != tuiSearch {
+		t.Fatalf("ctrl+f did not switch to search")
+	}
+	if msg := cmd().(tuiSearchMsg); msg.query != "" || len(calls.searched) != 0 {
+		t.Errorf("empty search ran the searcher: %+v", msg)
+	}
+
+	m, cmd = press(t, m, "b", "o")
+	msg := cmd().(tuiSearchMsg)
+	if msg.query != "bo" {
+		t.Fatalf("searched for %q, want %q", msg.query, "bo")
+	}
+
+	// Results of an earlier query arriving late are ignored.
+	stale := send(m, tuiSearchMsg{query: "b", paths: msg.paths[1:]})
+	if got := matchTitles(stale); !reflect.DeepEqual(got, []string{"Alpha", "Beta", "Delta Notes", "Gamma"}) {
+		t.Errorf("stale results changed the matches to %q", got)
+	}
+
+	m = send(m, msg)
+	if got := matchTitles(m); !reflect.DeepEqual(got, []string{"Gamma", "Beta"}) {
+		t.Errorf("matches = %q, want the searcher's order", got)
+	}
+
+	m, cmd = press(t, m, "backspace", "backspace", "f", "a", "i", "l")
+	m = send(m, cmd())
+	if m.status != "index unavailable" {
+		t.Errorf("status = %q, want the search error", m.status)
+	}
+
+	m, _ = press(t, m, "ctrl+f")
+	if m.mode != tuiFind || len(m.matches) != 0 {
+		t.Errorf("ctrl+f back to find: mode %v, matches %q", m.mode, matchTitles(m))
+	}
+}
+
+func TestTUIConnectPrompt(t *testing.T) {
+	m, calls, _ := newTestTUI(t)
+	types := m.store.vocab.Types()
+
+	m, _ = press(t, m, "ctrl+l", "g", "a", "m")
+	if m.mode != tuiConnect {
+		t.Fatalf("ctrl+l did not open the connect prompt")
+	}
+	if !strings.Contains(m.View(), "→ Gamma") {
+		t.Errorf("prompt does not preview the target:\n%s", m.View())
+	}
+
+	m, _ = press(t, m, "tab", "enter")
+	want := [][3]string{{"alpha.md", types[1], "gamma.md"}}
+	if !reflect.DeepEqual(calls.connected, want) {
+		t.Errorf("connected %v, want %v", calls.connected, want)
+	}
+	if m.mode != tuiFind {
+		t.Errorf("mode = %v after connecting, want find", m.mode)
+	}
+
+	m, _ = press(t, m, "ctrl+l", "z", "z", "z", "enter")
+	if len(calls.connected) != 1 || !strings.Contains(m.status, "No note matches") {
+		t.Errorf("connecting to no note: calls %v, status %q", calls.connected, m.status)
+	}
+	m, _ = press(t, m, "esc")
+	if m.mode != tuiFind {
+		t.Errorf("esc did not close the prompt")
+	}
+}
+
+func TestTUITagPrompt(t *testing.T) {
+	m, calls, _ := newTestTUI(t)
+
+	m, _ = press(t, m, "ctrl+t")
+	if m.input != "go, web" {
+		t.Fatalf("tag prompt starts with %q, want the note's tags", m.input)
+	}
+	m, _ = press(t, m, "backspace", "backspace", "backspace", "g", "o", ",", " ", "d", "b", "enter")
+	if want := []string{"go", "db"}; !reflect.DeepEqual(calls.tagged["Alpha"], want) {
+		t.Errorf("tagged %q, want %q", calls.tagged["Alpha"], want)
+	}
+
+	press(t, m, "ctrl+e")
+	if !reflect.DeepEqual(calls.edited, []string{"Alpha"}) {
+		t.Errorf("edited %q, want Alpha", calls.edited)
+	}
+}
+
+func TestTUIReloadKeepsSelection(t *testing.T) {
+	m, _, dir := newTestTUI(t)
+	store, err := openEdgeStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m = send(m, tuiReloadMsg{store: store, path: filepath.Join(dir, "gamma.md"), status: "Saved 'Gamma'"})
+	if got := currentTitle(m); got != "Gamma" {
+		t.Errorf("selected %q after reload, want Gamma", got)
+	}
+	if m.status != "Saved 'Gamma'" {
+		t.Errorf("status = %q", m.status)
+	}
+
+	m = send(m, tuiReloadMsg{err: errors.New("disk full")})
+	if m.status != "disk full" {
+		t.Errorf("status = %q, want the error", m.status)
+	}
+}